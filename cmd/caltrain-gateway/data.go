@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+
+	"golang.org/x/time/rate"
+)
+
+// Output formats of inspect
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// runFetch downloads every configured operator into the data directory in args,
+// taking API keys from the pool within its rate limits
+func runFetch(ctx context.Context, args []string) error {
+	cfg, positional, err := caltraingateway.LoadConfigArgs(args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("fetch expects the data directory as its only argument, got %d arguments", len(positional))
+	}
+	if len(cfg.APIKeys) == 0 {
+		return errors.New("no API keys found in environment variables FIVEONEONE_API_KEY_1, FIVEONEONE_API_KEY_2, etc. or the config file")
+	}
+	dataDir := positional[0]
+
+	loader := &caltraingateway.Loader{
+		BaseURL: cfg.APIBaseURL,
+		Keys:    caltraingateway.NewKeyPool(cfg.APIKeys, rate.Limit(cfg.KeyRateLimit), cfg.KeyBurst),
+		Delay:   cfg.LoaderDelay,
+	}
+	var errs []error
+	for _, operatorID := range cfg.Operators {
+		if err := loader.FetchOperator(ctx, operatorID, caltraingateway.OperatorDir(dataDir, operatorID)); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, fmt.Errorf("failed to fetch operator %s: %w", operatorID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// dataFlags are the flags of the commands reading a data directory
+type dataFlags struct {
+	operators string
+}
+
+// register adds the flags to the flag set
+func (f *dataFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.operators, "operators", "", "comma-separated operator IDs to read (default every operator directory)")
+}
+
+// operatorIDs returns the operators to read from the data directory: the ones
+// set with -operators, or else every subdirectory
+func (f *dataFlags) operatorIDs(dataDir string) ([]string, error) {
+	if f.operators != "" {
+		return strings.Split(f.operators, ","), nil
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read data directory: %w", err)
+	}
+	var ids []string
+	for _, entry := range entries {
+		// Hidden directories are left behind by interrupted fetches
+		if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+			ids = append(ids, entry.Name())
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no operator directories in %s", dataDir)
+	}
+	return ids, nil
+}
+
+// parseDataArgs parses the flags of a data command and returns the data directory
+func parseDataArgs(fs *flag.FlagSet, args []string) (string, error) {
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("%s expects the data directory as its only argument, got %d arguments", fs.Name(), fs.NArg())
+	}
+	return fs.Arg(0), nil
+}
+
+// runValidate prints the issues of every operator directory and fails if any
+// of them is not a warning
+func runValidate(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags dataFlags
+	flags.register(fs)
+	dataDir, err := parseDataArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	operatorIDs, err := flags.operatorIDs(dataDir)
+	if err != nil {
+		return err
+	}
+
+	var issues []caltraingateway.Issue
+	for _, operatorID := range operatorIDs {
+		issues = append(issues, caltraingateway.ValidateDir(caltraingateway.OperatorDir(dataDir, operatorID), time.Now())...)
+	}
+	warnings := 0
+	for _, issue := range issues {
+		fmt.Fprintln(stdout, issue)
+		if issue.Warning {
+			warnings++
+		}
+	}
+	fmt.Fprintf(stdout, "Checked %s: %d errors, %d warnings\n", strings.Join(operatorIDs, ", "), len(issues)-warnings, warnings)
+
+	if caltraingateway.HasErrors(issues) {
+		return fmt.Errorf("%s is invalid", dataDir)
+	}
+	return nil
+}
+
+// operatorSummary is the summary of an operator directory printed by inspect
+type operatorSummary struct {
+	Operator string `json:"operator"`
+	Dir      string `json:"dir"`
+	caltraingateway.DatasetSummary
+}
+
+// runInspect prints summary statistics of every operator directory
+func runInspect(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var flags dataFlags
+	flags.register(fs)
+	var format string
+	fs.StringVar(&format, "format", formatTable, "output format: table or json")
+	dataDir, err := parseDataArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("invalid format %q, must be %s or %s", format, formatTable, formatJSON)
+	}
+	operatorIDs, err := flags.operatorIDs(dataDir)
+	if err != nil {
+		return err
+	}
+
+	summaries := make([]operatorSummary, 0, len(operatorIDs))
+	for _, operatorID := range operatorIDs {
+		dir := caltraingateway.OperatorDir(dataDir, operatorID)
+		data, err := caltraingateway.LoadDatasetDir(dir)
+		if err != nil {
+			return fmt.Errorf("failed to load operator %s: %w", operatorID, err)
+		}
+		summary, err := caltraingateway.SummarizeDataset(data)
+		if err != nil {
+			return fmt.Errorf("failed to summarize operator %s: %w", operatorID, err)
+		}
+		summaries = append(summaries, operatorSummary{Operator: operatorID, Dir: dir, DatasetSummary: summary})
+	}
+
+	if format == formatJSON {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(summaries)
+	}
+	tw := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	for i, s := range summaries {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintf(tw, "Operator %s (%s)\n", s.Operator, s.Dir)
+		fmt.Fprintf(tw, "  Lines\t%d, %d with timetable\n", s.Lines, s.LinesWithTimetable)
+		fmt.Fprintf(tw, "  Stops\t%d, %d served\n", s.Stops, s.StopsServed)
+		fmt.Fprintf(tw, "  Timetables\t%d\n", s.Timetables)
+		fmt.Fprintf(tw, "  Routes\t%d\n", s.Routes)
+		fmt.Fprintf(tw, "  Trains\t%d\n", s.Trains)
+		days := make([]string, 0, len(caltraingateway.Weekdays))
+		for _, weekday := range caltraingateway.Weekdays {
+			days = append(days, fmt.Sprintf("%s %d", string(weekday)[:3], s.TrainsByWeekday[weekday]))
+		}
+		fmt.Fprintf(tw, "  Trains by day\t%s\n", strings.Join(days, ", "))
+		fmt.Fprintf(tw, "  Calls\t%d\n", s.Calls)
+		if s.ValidFrom != "" || s.ValidTo != "" {
+			fmt.Fprintf(tw, "  Valid\t%s to %s\n", s.ValidFrom, s.ValidTo)
+		}
+		fmt.Fprintf(tw, "  Version\t%s\n", s.Version)
+	}
+	return tw.Flush()
+}
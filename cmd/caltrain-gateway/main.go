@@ -1,105 +1,77 @@
+// Command caltrain-gateway serves Caltrain timetables and proxies the 511 API.
+// Its data commands prepare and check data directories for offline mode.
+//
+//	caltrain-gateway serve -data-dir data
+//	caltrain-gateway fetch data
+//	caltrain-gateway validate data
+//	caltrain-gateway inspect data
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
-	"net/http"
-	"net/url"
-	"time"
-
-	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
-)
-
-const (
-	baseAPIURL = "http://api.511.org/"
-	operatorID = "CT"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 )
 
-func main() {
-	apiKeyPool := caltraingateway.NewKeyPool(
-		caltraingateway.LoadAPIKeysFromEnv(),
-		1, // 1 request per second
-		5, // burst size of 5
-	)
+const usage = `Usage: caltrain-gateway [command] [flags] [arguments]
 
-	if len(apiKeyPool.Keys) == 0 {
-		log.Fatal("No API keys found in environment variables FIVEONEONE_API_KEY_1, FIVEONEONE_API_KEY_2, etc.")
-	}
+Commands:
+  serve             Run the gateway (default)
+  fetch <dir>       Download lines, stops and timetables from the 511 API into a data directory
+  validate <dir>    Check a data directory for structural problems
+  inspect <dir>     Print summary statistics of a data directory
 
-	// Get an API key for loading data
-	apiKey, ok := apiKeyPool.GetAvailableKey()
-	if !ok {
-		log.Fatal("No available API key to load timetables")
-	}
+serve and fetch accept the configuration flags, see caltrain-gateway serve -h.
+Run caltrain-gateway <command> -h for the flags of the other commands.
+`
 
-	// Load all lines and timetables
-	tc, err := loadAllTimetables(apiKey.Value)
-	if err != nil {
-		log.Printf("Warning: Failed to load timetables: %v", err)
-	} else {
-		caltraingateway.SetTimetableCollection(tc)
-		log.Println("Timetables loaded successfully")
-	}
-
-	// Load the secret from environment variable
-	secret := caltraingateway.LoadSecretFromEnv()
-
-	caltraingateway.SetupRoutes(apiKeyPool, secret)
-
-	log.Println("Caltrain Proxy running on :8080...")
-	log.Fatal(http.ListenAndServe(":8080", nil))
-}
-
-// loadAllTimetables loads all lines from the API and then loads timetables for each line
-func loadAllTimetables(apiKey string) (*caltraingateway.TimetableCollection, error) {
-	// Build URL for lines
-	u, err := url.Parse(baseAPIURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse base API URL: %w", err)
+func main() {
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
 	}
-
-	u.Path = "transit/lines"
-	q := u.Query()
-	q.Set("operator_id", operatorID)
-	q.Set("format", "json")
-	q.Set("api_key", apiKey)
-	u.RawQuery = q.Encode()
-
-	log.Println("Loading lines from API ...")
-	lines, err := caltraingateway.LoadLinesFromURL(u.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to load lines: %w", err)
+	if command == "serve" {
+		if err := serve(args); err != nil {
+			// serve has made the configured logger the default by now, if it got that far
+			slog.Error("Gateway stopped", "error", err)
+			os.Exit(1)
+		}
+		return
 	}
-	log.Printf("Loaded %d lines", len(lines))
 
-	// Create timetable collection
-	tc := caltraingateway.NewTimetableCollection()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// Load timetable for each line
-	for _, line := range lines {
-		// Sleep for two seconds to respect rate limiting
-		time.Sleep(2 * time.Second)
-
-		timetableURL, err := url.Parse(baseAPIURL)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse base API URL: %w", err)
-		}
-		timetableURL.Path = "transit/timetable"
-		q := timetableURL.Query()
-		q.Set("operator_id", operatorID)
-		q.Set("format", "json")
-		q.Set("line_id", line.ID)
-		q.Set("api_key", apiKey)
-		timetableURL.RawQuery = q.Encode()
-
-		log.Printf("Loading timetable for line: %s", line.ID)
-		tt, err := caltraingateway.LoadTimetableFromURL(timetableURL.String())
-		if err != nil {
-			log.Printf("Warning: Failed to load timetable for line %s: %v", line.ID, err)
-			continue
+	if err := run(ctx, command, args, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "caltrain-gateway:", err)
 		}
-		tc.AddTimetable(tt)
+		os.Exit(1)
 	}
+}
 
-	return tc, nil
+// run executes a data command with its arguments
+func run(ctx context.Context, command string, args []string, stdout, stderr io.Writer) error {
+	switch command {
+	case "fetch":
+		return runFetch(ctx, args)
+	case "validate":
+		return runValidate(args, stdout, stderr)
+	case "inspect":
+		return runInspect(args, stdout, stderr)
+	case "help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
 }
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+const exampleDir = "../../internal/app/caltrain-gateway/"
+
+// newMock511Server serves the example lines, stops and the timetable of the
+// Limited line for requests with the given API key
+func newMock511Server(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+
+	files := make(map[string][]byte)
+	for path, filename := range map[string]string{
+		"/transit/lines":     "example_lines.json",
+		"/transit/stops":     "example_stops.json",
+		"/transit/timetable": "example_timetable.json",
+	} {
+		data, err := os.ReadFile(exampleDir + filename)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", filename, err)
+		}
+		files[path] = data
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		data, ok := files[r.URL.Path]
+		if q.Get("api_key") != apiKey || q.Get("operator_id") != "CT" || !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/transit/timetable" && q.Get("line_id") != "Limited" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	}))
+}
+
+func TestRun_DataCommands(t *testing.T) {
+	mockAPI := newMock511Server(t, "fetch-key")
+	defer mockAPI.Close()
+	t.Setenv("FIVEONEONE_API_KEY_1", "fetch-key")
+	t.Setenv("CALTRAIN_GATEWAY_CONFIG", "")
+	t.Setenv("DATA_DIR", "")
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	var stdout, stderr bytes.Buffer
+	fetchArgs := []string{"-api-base-url", mockAPI.URL + "/", "-loader-delay", "0s", "-key-rate-limit", "100", dataDir}
+	// Only the Limited line has a timetable, so the fetch fails but keeps it
+	if err := run(context.Background(), "fetch", fetchArgs, &stdout, &stderr); err == nil || !strings.Contains(err.Error(), "4 of 5 lines") {
+		t.Fatalf("Expected fetch to report the failed lines, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "CT", "timetables", "Limited.json")); err != nil {
+		t.Errorf("Expected the Limited timetable to be fetched: %v", err)
+	}
+
+	stdout.Reset()
+	if err := run(context.Background(), "validate", []string{dataDir}, &stdout, &stderr); err != nil {
+		t.Fatalf("Expected validate to succeed, got %v\n%s", err, stdout.String())
+	}
+	if !strings.Contains(stdout.String(), "warning: ") || !strings.Contains(stdout.String(), "Checked CT: 0 errors") {
+		t.Errorf("Expected warnings and no errors, got:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	if err := run(context.Background(), "inspect", []string{"-format", "json", dataDir}, &stdout, &stderr); err != nil {
+		t.Fatalf("Expected inspect to succeed, got %v", err)
+	}
+	var summaries []operatorSummary
+	if err := json.Unmarshal(stdout.Bytes(), &summaries); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if len(summaries) != 1 || summaries[0].Operator != "CT" || summaries[0].Lines != 5 || summaries[0].Trains == 0 {
+		t.Errorf("Expected a summary of CT with 5 lines and trains, got %+v", summaries)
+	}
+
+	stdout.Reset()
+	if err := run(context.Background(), "inspect", []string{dataDir}, &stdout, &stderr); err != nil {
+		t.Fatalf("Expected inspect to succeed, got %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Operator CT") {
+		t.Errorf("Expected a table for CT, got:\n%s", stdout.String())
+	}
+
+	// A broken timetable fails validation
+	if err := os.WriteFile(filepath.Join(dataDir, "CT", "timetables", "Express.json"), []byte("{"), 0o644); err != nil {
+		t.Fatalf("failed to write timetable: %v", err)
+	}
+	stdout.Reset()
+	if err := run(context.Background(), "validate", []string{dataDir}, &stdout, &stderr); err == nil {
+		t.Errorf("Expected validate to fail, got:\n%s", stdout.String())
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	t.Setenv("CALTRAIN_GATEWAY_CONFIG", "")
+	t.Setenv("FIVEONEONE_API_KEY_1", "fetch-key")
+
+	tests := []struct {
+		name    string
+		command string
+		args    []string
+	}{
+		{name: "unknown command", command: "download"},
+		{name: "fetch without directory", command: "fetch", args: []string{"-loader-delay", "0s"}},
+		{name: "validate without directory", command: "validate"},
+		{name: "validate missing directory", command: "validate", args: []string{"nonexistent"}},
+		{name: "inspect with invalid format", command: "inspect", args: []string{"-format", "xml", exampleDir}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			if err := run(context.Background(), tt.command, tt.args, &stdout, &stderr); err == nil {
+				t.Errorf("Expected error, got output '%s'", stdout.String())
+			}
+		})
+	}
+}
+
+func TestServe_Errors(t *testing.T) {
+	t.Setenv("CALTRAIN_GATEWAY_CONFIG", "")
+	t.Setenv("DATA_DIR", "")
+	t.Setenv("FIVEONEONE_API_KEY_1", "")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{name: "invalid configuration", args: []string{"-port", "0"}, expected: "failed to load configuration"},
+		{name: "no API keys", expected: "no API keys found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// serve returns instead of exiting, so deferred shutdowns run
+			if err := serve(tt.args); err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestWarnUngrantedScopes(t *testing.T) {
+	tests := []struct {
+		name     string
+		secret   string
+		admin    string
+		dataDir  string
+		expected []string
+	}{
+		{name: "no authentication", expected: []string{"This is not recommended"}},
+		{name: "shared secret", secret: "secret"},
+		{name: "admin secret only", admin: "admin-secret", expected: []string{"scope=proxy", "scope=timetable"}},
+		{name: "admin secret only offline", admin: "admin-secret", dataDir: "data", expected: []string{"scope=timetable"}},
+		{name: "shared and admin secret", secret: "secret", admin: "admin-secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := caltraingateway.DefaultConfig()
+			cfg.Secret = tt.secret
+			cfg.AdminSecret = tt.admin
+			cfg.DataDir = tt.dataDir
+			clients, err := caltraingateway.LoadClients(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("LoadClients() error: %v", err)
+			}
+
+			var logs bytes.Buffer
+			warnUngrantedScopes(slog.New(slog.NewTextHandler(&logs, nil)), cfg, clients)
+
+			if lines := strings.Count(logs.String(), "level=WARN"); lines != len(tt.expected) {
+				t.Errorf("Expected %d warnings, got:\n%s", len(tt.expected), logs.String())
+			}
+			for _, want := range tt.expected {
+				if !strings.Contains(logs.String(), want) {
+					t.Errorf("Expected a warning containing %q, got:\n%s", want, logs.String())
+				}
+			}
+		})
+	}
+}
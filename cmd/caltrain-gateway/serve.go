@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+
+	"go.opentelemetry.io/otel"
+	"golang.org/x/time/rate"
+)
+
+// warnUngrantedScopes warns if the gateway runs without authentication, or if
+// no client can use the proxy or timetable routes, which then reject every request
+func warnUngrantedScopes(logger *slog.Logger, cfg *caltraingateway.Config, clients *caltraingateway.ClientRegistry) {
+	if clients.Len() == 0 && !cfg.JWT.Enabled() {
+		logger.Warn("Neither CALTRAIN_GATEWAY_SECRET, a clients file nor a JWT issuer is set. This is not recommended for production environments.")
+		return
+	}
+
+	scopes := []caltraingateway.Scope{caltraingateway.ScopeTimetable}
+	// Offline the proxy is disabled anyway
+	if !cfg.Offline() {
+		scopes = append([]caltraingateway.Scope{caltraingateway.ScopeProxy}, scopes...)
+	}
+	for _, scope := range scopes {
+		if !clients.HasScope(scope) {
+			logger.Warn("No client is granted the scope, so its routes reject every request", "scope", scope)
+		}
+	}
+}
+
+// serve runs the gateway with the configuration from the arguments until it is stopped.
+// Errors are returned rather than exiting, so pending spans are flushed first.
+func serve(args []string) error {
+	cfg, err := caltraingateway.LoadConfig(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+
+	logger, err := caltraingateway.NewLogger(os.Stderr, cfg.LogFormat, cfg.LogLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	// Route the standard library logger through slog as well
+	slog.SetDefault(logger)
+
+	apiKeyPool := caltraingateway.NewKeyPool(cfg.APIKeys, rate.Limit(cfg.KeyRateLimit), cfg.KeyBurst)
+
+	// Offline the timetables come from files and there is no proxy to use the keys
+	if len(apiKeyPool.Keys) == 0 && !cfg.Offline() {
+		return errors.New("no API keys found in environment variables FIVEONEONE_API_KEY_1, FIVEONEONE_API_KEY_2, etc. or the config file")
+	}
+
+	// Stop serving on SIGTERM (e.g. during deploys) or Ctrl+C
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	clients, err := caltraingateway.LoadClients(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load clients: %w", err)
+	}
+	warnUngrantedScopes(logger, cfg, clients)
+
+	tracerProvider, shutdownTracing, err := caltraingateway.NewTracerProvider(ctx, cfg.TracingExporter, os.Stdout)
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+	defer func() {
+		// Flush pending spans, the signal context is already cancelled at this point
+		flushCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(flushCtx); err != nil {
+			logger.Error("Failed to flush traces", "error", err)
+		}
+	}()
+	otel.SetTracerProvider(tracerProvider)
+
+	store := caltraingateway.NewStore(caltraingateway.NewOperators(cfg.Operators))
+	metrics := caltraingateway.NewMetrics(apiKeyPool, store)
+	loader := &caltraingateway.Loader{
+		Metrics:        metrics,
+		TracerProvider: tracerProvider,
+	}
+	if cfg.Offline() {
+		logger.Info("Serving timetables from the data directory, the 511 proxy is disabled", "data_dir", cfg.DataDir)
+		loader.Dir = cfg.DataDir
+	} else {
+		// Loads share the keys and their rate limits with the proxy, so keys
+		// disabled through the admin API are not used for reloads either
+		loader.BaseURL = cfg.APIBaseURL
+		loader.Keys = apiKeyPool
+		loader.Delay = cfg.LoaderDelay
+	}
+
+	handler, err := caltraingateway.NewHandler(caltraingateway.Deps{
+		Config:         cfg,
+		KeyPool:        apiKeyPool,
+		Store:          store,
+		Clients:        clients,
+		Metrics:        metrics,
+		Logger:         logger,
+		Loader:         loader,
+		TracerProvider: tracerProvider,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create handler: %w", err)
+	}
+
+	server := caltraingateway.NewServer(cfg, handler)
+	// Load all lines and timetables for every configured operator in the background
+	server.Go(func(ctx context.Context) {
+		loader.Run(ctx, store, cfg.RefreshInterval)
+	})
+
+	if err := server.Run(ctx); err != nil {
+		return fmt.Errorf("server failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+// Output formats
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// station is a named station with the stops serving it, e.g. one per direction
+type station struct {
+	Name    string   `json:"name"`
+	StopIDs []string `json:"stopIds"`
+}
+
+// stationName strips the direction from a stop name, as stations have a stop per direction
+func stationName(stopName string) string {
+	for _, suffix := range []string{" Northbound", " Southbound", " Eastbound", " Westbound"} {
+		if name, ok := strings.CutSuffix(stopName, suffix); ok {
+			return name
+		}
+	}
+	return stopName
+}
+
+// findStation returns the station whose name starts with the query, ignoring case.
+// A stop ID is accepted as well, and works without any stops loaded.
+func findStation(stops []caltraingateway.Stop, query string) (station, error) {
+	query = strings.TrimSpace(query)
+	byName := make(map[string][]string)
+	var names []string
+	for _, stop := range stops {
+		name := stationName(stop.Name)
+		if stop.ID == query {
+			return station{Name: name, StopIDs: []string{stop.ID}}, nil
+		}
+		if !strings.HasPrefix(strings.ToLower(name), strings.ToLower(query)) {
+			continue
+		}
+		if _, ok := byName[name]; !ok {
+			names = append(names, name)
+		}
+		byName[name] = append(byName[name], stop.ID)
+	}
+
+	switch len(names) {
+	case 0:
+		if _, err := strconv.Atoi(query); err == nil {
+			return station{Name: query, StopIDs: []string{query}}, nil
+		}
+		return station{}, fmt.Errorf("no station matches %q", query)
+	case 1:
+		return station{Name: names[0], StopIDs: byName[names[0]]}, nil
+	default:
+		return station{}, fmt.Errorf("%q matches several stations: %s", query, strings.Join(names, ", "))
+	}
+}
+
+// serviceMinutes returns the minutes since the start of the service day for a
+// time like "05:43:00" and its days offset, so trains after midnight sort last
+func serviceMinutes(clock, daysOffset string) (int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) < 2 {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", clock)
+	}
+	days, _ := strconv.Atoi(daysOffset)
+	return days*24*60 + hours*60 + minutes, nil
+}
+
+// formatClock returns the minutes of the service day as HH:MM
+func formatClock(minutes int) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60%24, minutes%60)
+}
+
+// departure is a train leaving a station
+type departure struct {
+	Time        string `json:"time"`
+	TrainID     string `json:"trainId"`
+	Line        string `json:"line"`
+	Direction   string `json:"direction"`
+	Destination string `json:"destination"`
+	StopID      string `json:"stopId"`
+	minutes     int
+}
+
+// nextDepartures returns the departures from the station at or after the given
+// minute of the service day, optionally only in one direction
+func nextDepartures(departuresByStop map[string][]caltraingateway.TrainDeparture, st station, direction string, after, limit int) []departure {
+	result := make([]departure, 0)
+	for _, stopID := range st.StopIDs {
+		for _, d := range departuresByStop[stopID] {
+			if direction != "" && !strings.EqualFold(strings.TrimSpace(d.Direction), direction) {
+				continue
+			}
+			minutes, err := serviceMinutes(d.DepartureTime, d.DaysOffset)
+			if err != nil || minutes < after {
+				continue
+			}
+			result = append(result, departure{
+				Time:        formatClock(minutes),
+				TrainID:     d.TrainID,
+				Line:        d.Line,
+				Direction:   strings.TrimSpace(d.Direction),
+				Destination: d.Destination,
+				StopID:      stopID,
+				minutes:     minutes,
+			})
+		}
+	}
+	slices.SortStableFunc(result, func(a, b departure) int {
+		return a.minutes - b.minutes
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// trip is a train that stops at both stations, in that order
+type trip struct {
+	TrainID   string `json:"trainId"`
+	Line      string `json:"line"`
+	Direction string `json:"direction"`
+	Departure string `json:"departure"`
+	Arrival   string `json:"arrival"`
+	Minutes   int    `json:"minutes"`
+}
+
+// findTrips returns the trains leaving from at or after the given minute that
+// later arrive at to, ordered by departure
+func findTrips(departuresByStop map[string][]caltraingateway.TrainDeparture, from, to station, after, limit int) []trip {
+	// Arrivals at the destination by train
+	arrivals := make(map[string]int)
+	for _, stopID := range to.StopIDs {
+		for _, d := range departuresByStop[stopID] {
+			if minutes, err := serviceMinutes(d.ArrivalTime, d.DaysOffset); err == nil {
+				arrivals[d.TrainID] = minutes
+			}
+		}
+	}
+
+	result := make([]trip, 0)
+	for _, d := range nextDepartures(departuresByStop, from, "", after, 0) {
+		arrives, ok := arrivals[d.TrainID]
+		if !ok || arrives <= d.minutes {
+			continue
+		}
+		result = append(result, trip{
+			TrainID:   d.TrainID,
+			Line:      d.Line,
+			Direction: d.Direction,
+			Departure: d.Time,
+			Arrival:   formatClock(arrives),
+			Minutes:   arrives - d.minutes,
+		})
+	}
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// writeJSON writes v as indented JSON
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// writeTable writes the rows below the header as aligned columns
+func writeTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// queryTime is the service day and time a command looks at
+type queryTime struct {
+	weekday caltraingateway.Weekday
+	minutes int
+}
+
+// resolveQueryTime applies the -weekday and -at flags to the current time
+func resolveQueryTime(now time.Time, weekday, at string) (queryTime, error) {
+	q := queryTime{
+		weekday: caltraingateway.Weekday(now.Weekday().String()),
+		minutes: now.Hour()*60 + now.Minute(),
+	}
+	if weekday != "" {
+		q.weekday = caltraingateway.ParseWeekday(weekday)
+		if q.weekday == "" {
+			return q, fmt.Errorf("invalid weekday %q", weekday)
+		}
+	}
+	if at != "" {
+		t, err := time.Parse("15:04", at)
+		if err != nil {
+			return q, fmt.Errorf("invalid time %q, expected HH:MM", at)
+		}
+		q.minutes = t.Hour()*60 + t.Minute()
+	}
+	return q, nil
+}
+
+// runNext prints the next departures from a station
+func runNext(ctx context.Context, w io.Writer, src source, format, query, direction string, when queryTime, limit int) error {
+	stops, err := src.stops(ctx)
+	if err != nil {
+		return err
+	}
+	st, err := findStation(stops, query)
+	if err != nil {
+		return err
+	}
+	departuresByStop, err := src.departures(ctx, when.weekday)
+	if err != nil {
+		return err
+	}
+
+	departures := nextDepartures(departuresByStop, st, direction, when.minutes, limit)
+	if format == formatJSON {
+		return writeJSON(w, struct {
+			Station    station     `json:"station"`
+			Weekday    string      `json:"weekday"`
+			Departures []departure `json:"departures"`
+		}{st, string(when.weekday), departures})
+	}
+
+	if len(departures) == 0 {
+		fmt.Fprintf(w, "No more departures from %s on %s after %s\n", st.Name, when.weekday, formatClock(when.minutes))
+		return nil
+	}
+	rows := make([][]string, 0, len(departures))
+	for _, d := range departures {
+		rows = append(rows, []string{d.Time, d.TrainID, d.Line, d.Direction, d.Destination})
+	}
+	return writeTable(w, []string{"TIME", "TRAIN", "LINE", "DIR", "DESTINATION"}, rows)
+}
+
+// runTrain prints the stopping pattern of a train
+func runTrain(ctx context.Context, w io.Writer, src source, format, id string) error {
+	train, err := src.train(ctx, id)
+	if err != nil {
+		if err == errTrainNotFound {
+			return fmt.Errorf("train %s not found", id)
+		}
+		return err
+	}
+	if format == formatJSON {
+		return writeJSON(w, train)
+	}
+
+	days := make([]string, 0, len(train.Days))
+	for _, day := range train.Days {
+		days = append(days, string(day)[:3])
+	}
+	fmt.Fprintf(w, "Train %s, %s, direction %s, runs %s\n\n", train.TrainID, train.Line, train.Direction, strings.Join(days, " "))
+
+	rows := make([][]string, 0, len(train.Calls))
+	for _, call := range train.Calls {
+		name := call.StationName
+		if name == "" {
+			name = call.StopID
+		}
+		rows = append(rows, []string{stationName(name), clock(call.ArrivalTime, call.ArrivalDaysOffset), clock(call.DepartureTime, call.DepartureDaysOffset)})
+	}
+	return writeTable(w, []string{"STATION", "ARRIVE", "DEPART"}, rows)
+}
+
+// clock formats a timetable time as HH:MM, or returns it unchanged if it is malformed
+func clock(t, daysOffset string) string {
+	minutes, err := serviceMinutes(t, daysOffset)
+	if err != nil {
+		return t
+	}
+	return formatClock(minutes)
+}
+
+// runTrip prints the trains between two stations
+func runTrip(ctx context.Context, w io.Writer, src source, format, fromQuery, toQuery string, when queryTime, limit int) error {
+	stops, err := src.stops(ctx)
+	if err != nil {
+		return err
+	}
+	from, err := findStation(stops, fromQuery)
+	if err != nil {
+		return err
+	}
+	to, err := findStation(stops, toQuery)
+	if err != nil {
+		return err
+	}
+	departuresByStop, err := src.departures(ctx, when.weekday)
+	if err != nil {
+		return err
+	}
+
+	trips := findTrips(departuresByStop, from, to, when.minutes, limit)
+	if format == formatJSON {
+		return writeJSON(w, struct {
+			From    station `json:"from"`
+			To      station `json:"to"`
+			Weekday string  `json:"weekday"`
+			Trips   []trip  `json:"trips"`
+		}{from, to, string(when.weekday), trips})
+	}
+
+	if len(trips) == 0 {
+		fmt.Fprintf(w, "No trains from %s to %s on %s after %s\n", from.Name, to.Name, when.weekday, formatClock(when.minutes))
+		return nil
+	}
+	rows := make([][]string, 0, len(trips))
+	for _, t := range trips {
+		rows = append(rows, []string{t.Departure, t.Arrival, strconv.Itoa(t.Minutes) + " min", t.TrainID, t.Line})
+	}
+	return writeTable(w, []string{"DEPART", "ARRIVE", "DURATION", "TRAIN", "LINE"}, rows)
+}
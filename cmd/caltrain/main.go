@@ -0,0 +1,177 @@
+// Command caltrain shows Caltrain departures, trains and trips from a running
+// gateway or from local timetable files.
+//
+//	caltrain next "Palo Alto" --dir N
+//	caltrain train 401
+//	caltrain trip "Palo Alto" "San Francisco" --at 08:00
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+	_ "time/tzdata"
+
+	"caltrain-gateway/pkg/client"
+)
+
+// caltrainTimezone is the timezone of the timetables, used for the current time
+const caltrainTimezone = "America/Los_Angeles"
+
+const usage = `Usage: caltrain <command> [flags] [arguments]
+
+Commands:
+  next <station>        Next departures from a station
+  train <id>            Stopping pattern of a train
+  trip <from> <to>      Trains between two stations
+
+Stations are matched by the start of their name, e.g. "Palo Alto", or by stop ID.
+Data comes from the gateway at -gateway, or from local files with -timetable.
+Run caltrain <command> -h for the flags of a command.
+`
+
+// options are the flags shared by all commands
+type options struct {
+	gateway    string
+	secret     string
+	operator   string
+	timetables string
+	stops      string
+	format     string
+}
+
+// register adds the shared flags to the flag set, with defaults from the environment
+func (o *options) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.gateway, "gateway", os.Getenv("CALTRAIN_GATEWAY_URL"), "base URL of the gateway (env CALTRAIN_GATEWAY_URL)")
+	fs.StringVar(&o.secret, "secret", os.Getenv("CALTRAIN_GATEWAY_SECRET"), "client secret for the gateway (env CALTRAIN_GATEWAY_SECRET)")
+	fs.StringVar(&o.operator, "operator", "CT", "511 operator ID")
+	fs.StringVar(&o.timetables, "timetable", "", "comma-separated timetable JSON files to read instead of a gateway")
+	fs.StringVar(&o.stops, "stops", "", "stops JSON file for station names when reading local files")
+	fs.StringVar(&o.format, "format", formatTable, "output format: table or json")
+}
+
+// source returns the data source selected by the flags
+func (o *options) source() (source, error) {
+	if o.format != formatTable && o.format != formatJSON {
+		return nil, fmt.Errorf("invalid format %q, must be %s or %s", o.format, formatTable, formatJSON)
+	}
+	if o.timetables != "" {
+		return newLocalSource(strings.Split(o.timetables, ","), o.stops)
+	}
+	if o.gateway == "" {
+		return nil, errors.New("set -gateway or CALTRAIN_GATEWAY_URL, or read local files with -timetable")
+	}
+
+	var opts []client.Option
+	if o.secret != "" {
+		opts = append(opts, client.WithSecret(o.secret))
+	}
+	c, err := client.New(o.gateway, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &gatewaySource{client: c, operator: o.operator}, nil
+}
+
+// parseArgs parses flags that may appear before, between or after the
+// positional arguments, which it returns
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr, time.Now()); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "caltrain:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// run executes the command in args at the given time
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, now time.Time) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, usage)
+		if len(args) == 0 {
+			return errors.New("missing command")
+		}
+		return nil
+	}
+	if loc, err := time.LoadLocation(caltrainTimezone); err == nil {
+		now = now.In(loc)
+	}
+
+	command := args[0]
+	fs := flag.NewFlagSet("caltrain "+command, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var opts options
+	opts.register(fs)
+
+	var direction, weekday, at string
+	var limit int
+	switch command {
+	case "next", "trip":
+		if command == "next" {
+			fs.StringVar(&direction, "dir", "", "only show trains in this direction, N or S")
+		}
+		fs.StringVar(&weekday, "weekday", "", "day of the timetable, e.g. Monday (default today)")
+		fs.StringVar(&at, "at", "", "earliest departure as HH:MM (default now)")
+		fs.IntVar(&limit, "limit", 5, "maximum number of trains, 0 for all")
+	case "train":
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", command)
+	}
+
+	positional, err := parseArgs(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	expected := map[string]int{"next": 1, "train": 1, "trip": 2}[command]
+	if len(positional) != expected {
+		fs.Usage()
+		return fmt.Errorf("%s expects %d argument(s), got %d", command, expected, len(positional))
+	}
+
+	src, err := opts.source()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "train":
+		return runTrain(ctx, stdout, src, opts.format, positional[0])
+	case "next":
+		when, err := resolveQueryTime(now, weekday, at)
+		if err != nil {
+			return err
+		}
+		return runNext(ctx, stdout, src, opts.format, positional[0], direction, when, limit)
+	default:
+		when, err := resolveQueryTime(now, weekday, at)
+		if err != nil {
+			return err
+		}
+		return runTrip(ctx, stdout, src, opts.format, positional[0], positional[1], when, limit)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+const exampleDir = "../../internal/app/caltrain-gateway/"
+
+// monday7am is a Monday at 07:00 in California
+var monday7am = time.Date(2026, time.March, 2, 15, 0, 0, 0, time.UTC)
+
+func TestFindStation(t *testing.T) {
+	stops, err := caltraingateway.LoadStopsFromFile(exampleDir + "example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+
+	tests := []struct {
+		query         string
+		expectedName  string
+		expectedStops []string
+		expectError   bool
+	}{
+		{query: "Palo Alto", expectedName: "Palo Alto Caltrain Station", expectedStops: []string{"70171", "70172"}},
+		{query: "palo", expectedName: "Palo Alto Caltrain Station", expectedStops: []string{"70171", "70172"}},
+		{query: "San Francisco", expectedName: "San Francisco Caltrain Station", expectedStops: []string{"70011", "70012"}},
+		{query: "70261", expectedName: "San Jose Diridon Caltrain Station", expectedStops: []string{"70261"}},
+		{query: "San", expectError: true},
+		{query: "Oakland", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			st, err := findStation(stops, tt.query)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got station %+v", st)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if st.Name != tt.expectedName {
+				t.Errorf("Expected name '%s', got '%s'", tt.expectedName, st.Name)
+			}
+			if strings.Join(st.StopIDs, ",") != strings.Join(tt.expectedStops, ",") {
+				t.Errorf("Expected stops %v, got %v", tt.expectedStops, st.StopIDs)
+			}
+		})
+	}
+}
+
+func TestRun_LocalFiles(t *testing.T) {
+	files := []string{"--timetable", exampleDir + "example_timetable.json", "--stops", exampleDir + "example_stops.json"}
+
+	tests := []struct {
+		name         string
+		args         []string
+		expectError  bool
+		expectedRows []string
+	}{
+		{
+			name:         "next departures northbound",
+			args:         []string{"next", "Palo Alto", "--dir", "N", "--limit", "2"},
+			expectedRows: []string{"TIME", "07:10  405", "08:10  409"},
+		},
+		{
+			name:         "next departures at a given time",
+			args:         []string{"next", "--at", "16:00", "Palo Alto", "--dir", "N", "--limit", "1"},
+			expectedRows: []string{"TIME", "16:10  417"},
+		},
+		{
+			name:         "train stopping pattern",
+			args:         []string{"train", "401"},
+			expectedRows: []string{"Train 401, Limited, direction N, runs Mon Tue Wed Thu Fri", "", "STATION", "San Jose Diridon Caltrain Station"},
+		},
+		{
+			name:         "trip between stations",
+			args:         []string{"trip", "Palo Alto", "San Francisco", "--limit", "1"},
+			expectedRows: []string{"DEPART", "07:10   07:53   43 min    405"},
+		},
+		{name: "unknown train", args: []string{"train", "999"}, expectError: true},
+		{name: "ambiguous station", args: []string{"next", "San"}, expectError: true},
+		{name: "invalid weekday", args: []string{"next", "Palo Alto", "--weekday", "Someday"}, expectError: true},
+		{name: "missing argument", args: []string{"trip", "Palo Alto"}, expectError: true},
+		{name: "unknown command", args: []string{"depart"}, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := run(context.Background(), append(tt.args, files...), &stdout, &stderr, monday7am)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got output '%s'", stdout.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			rows := strings.Split(stdout.String(), "\n")
+			for i, expected := range tt.expectedRows {
+				if i >= len(rows) || !strings.HasPrefix(rows[i], expected) {
+					t.Errorf("Expected row %d to start with '%s', got:\n%s", i, expected, stdout.String())
+				}
+			}
+		})
+	}
+}
+
+func TestRun_Gateway(t *testing.T) {
+	stops, err := caltraingateway.LoadStopsFromFile(exampleDir + "example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+	tc := caltraingateway.NewTimetableCollection()
+	if err := tc.LoadTimetableFiles(exampleDir + "example_timetable.json"); err != nil {
+		t.Fatalf("failed to load timetable: %v", err)
+	}
+	store := caltraingateway.NewStore([]caltraingateway.Operator{caltraingateway.NewOperator("CT")})
+	store.Set("CT", &caltraingateway.Dataset{Stops: stops, Timetables: tc})
+
+	cfg := caltraingateway.DefaultConfig()
+	cfg.Secret = "mysecret"
+	// Stations are looked up in the loaded stops, not through the 511 proxy
+	cfg.Proxy.AllowedPaths = []string{"transit/StopMonitoring"}
+	handler, err := caltraingateway.NewHandler(caltraingateway.Deps{
+		Config:  cfg,
+		KeyPool: caltraingateway.NewKeyPool([]string{"key"}, 100, 100),
+		Store:   store,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	gateway := httptest.NewServer(handler)
+	defer gateway.Close()
+
+	var stdout, stderr bytes.Buffer
+	args := []string{"next", "Palo Alto", "--dir", "S", "--format", "json", "--gateway", gateway.URL, "--secret", "mysecret"}
+	if err := run(context.Background(), args, &stdout, &stderr, monday7am); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	var result struct {
+		Station    station     `json:"station"`
+		Departures []departure `json:"departures"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode output: %v", err)
+	}
+	if result.Station.Name != "Palo Alto Caltrain Station" {
+		t.Errorf("Expected station 'Palo Alto Caltrain Station', got '%s'", result.Station.Name)
+	}
+	if len(result.Departures) == 0 {
+		t.Fatal("Expected departures")
+	}
+	for _, d := range result.Departures {
+		if d.Direction != "S" {
+			t.Errorf("Expected only southbound departures, got %+v", d)
+		}
+	}
+
+	// A wrong secret is reported
+	args[len(args)-1] = "wrong"
+	if err := run(context.Background(), args, &stdout, &stderr, monday7am); err == nil || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Errorf("Expected unauthorized error, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+	"caltrain-gateway/pkg/client"
+)
+
+// source provides the timetable data the commands work on
+type source interface {
+	// departures returns the departures on the weekday keyed by stop ID
+	departures(ctx context.Context, weekday caltraingateway.Weekday) (map[string][]caltraingateway.TrainDeparture, error)
+	// train returns a train with its stopping pattern and station names
+	train(ctx context.Context, id string) (*caltraingateway.TrainDetail, error)
+	// stops returns the stops of the operator, used to find stations by name
+	stops(ctx context.Context) ([]caltraingateway.Stop, error)
+}
+
+// errTrainNotFound is returned by sources for unknown trains
+var errTrainNotFound = errors.New("train not found")
+
+// gatewaySource reads timetables from a running gateway
+type gatewaySource struct {
+	client   *client.Client
+	operator string // 511 operator ID, e.g. "CT"
+}
+
+func (s *gatewaySource) departures(ctx context.Context, weekday caltraingateway.Weekday) (map[string][]caltraingateway.TrainDeparture, error) {
+	return s.client.Timetable(ctx, s.operator, client.TimetableQuery{Weekday: weekday})
+}
+
+func (s *gatewaySource) train(ctx context.Context, id string) (*caltraingateway.TrainDetail, error) {
+	train, err := s.client.Train(ctx, s.operator, id)
+	var apiErr *client.APIError
+	if errors.As(err, &apiErr) && apiErr.Code == caltraingateway.ErrCodeTrainNotFound {
+		return nil, errTrainNotFound
+	}
+	return train, err
+}
+
+func (s *gatewaySource) stops(ctx context.Context) ([]caltraingateway.Stop, error) {
+	stops, err := s.client.Stops(ctx, s.operator)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stops: %w", err)
+	}
+	return stops, nil
+}
+
+// localSource reads timetables from files
+type localSource struct {
+	timetables *caltraingateway.TimetableCollection
+	stopList   []caltraingateway.Stop
+}
+
+// newLocalSource loads the timetable files and, if set, the stops file
+func newLocalSource(timetableFiles []string, stopsFile string) (*localSource, error) {
+	s := &localSource{timetables: caltraingateway.NewTimetableCollection()}
+	if err := s.timetables.LoadTimetableFiles(timetableFiles...); err != nil {
+		return nil, err
+	}
+	if stopsFile != "" {
+		stops, err := caltraingateway.LoadStopsFromFile(stopsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.stopList = stops
+	}
+	return s, nil
+}
+
+func (s *localSource) departures(ctx context.Context, weekday caltraingateway.Weekday) (map[string][]caltraingateway.TrainDeparture, error) {
+	return s.timetables.GetDeparturesByStopAndWeekday(weekday), nil
+}
+
+func (s *localSource) train(ctx context.Context, id string) (*caltraingateway.TrainDetail, error) {
+	train, ok := s.timetables.GetTrain(id)
+	if !ok {
+		return nil, errTrainNotFound
+	}
+	names := caltraingateway.GetStopNames(s.stopList)
+	for i := range train.Calls {
+		train.Calls[i].StationName = names[train.Calls[i].StopID]
+	}
+	return train, nil
+}
+
+func (s *localSource) stops(ctx context.Context) ([]caltraingateway.Stop, error) {
+	return s.stopList, nil
+}
@@ -0,0 +1,139 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// KeyInfo describes an API key and its limiter state without revealing the key
+type KeyInfo struct {
+	Index     int     `json:"index"`     // 1-based position in the pool
+	Key       string  `json:"key"`       // masked key, e.g. "****abcd"
+	Enabled   bool    `json:"enabled"`   // false if disabled through the admin API
+	Tokens    float64 `json:"tokens"`    // tokens currently available in the limiter
+	Limit     float64 `json:"limit"`     // requests per second
+	Burst     int     `json:"burst"`     // burst size
+	Used      int64   `json:"used"`      // requests made with the key
+	Throttled int64   `json:"throttled"` // times the key was skipped for lack of tokens
+}
+
+// SnapshotInfo describes the snapshot loaded for an operator
+type SnapshotInfo struct {
+	OperatorStatus
+	Stops      int `json:"stops"`      // number of loaded stops
+	Timetables int `json:"timetables"` // number of loaded line timetables
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// newKeyInfo returns the admin view of a key
+func newKeyInfo(key *APIKey) KeyInfo {
+	return KeyInfo{
+		Index:     key.Index(),
+		Key:       key.Masked(),
+		Enabled:   key.Enabled(),
+		Tokens:    key.Limiter.Tokens(),
+		Limit:     float64(key.Limiter.Limit()),
+		Burst:     key.Limiter.Burst(),
+		Used:      key.Used(),
+		Throttled: key.Throttled(),
+	}
+}
+
+// adminPurgeCacheHandler removes proxy cache entries whose key starts with the
+// prefix query parameter, e.g. /transit/StopMonitoring. Without a prefix the
+// whole cache is purged.
+func adminPurgeCacheHandler(responseCache *ResponseCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		prefix := r.URL.Query().Get("prefix")
+		purged := responseCache.DeletePrefix(prefix)
+		loggerFrom(r.Context()).Info("Purged proxy cache", "prefix", prefix, "entries", purged)
+		writeJSON(w, http.StatusOK, map[string]any{"prefix": prefix, "purged": purged})
+	}
+}
+
+// adminReloadHandler asks the loader to reload all timetables immediately
+func adminReloadHandler(loader *Loader) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if loader == nil {
+			writeError(w, r, newAPIError(http.StatusServiceUnavailable, ErrCodeReloadUnavailable, "Reloading is not available"))
+			return
+		}
+		queued := loader.Reload()
+		loggerFrom(r.Context()).Info("Timetable reload requested", "queued", queued)
+		// A reload that is already pending will pick up the latest data as well
+		writeJSON(w, http.StatusAccepted, map[string]any{"queued": queued})
+	}
+}
+
+// adminKeysHandler lists the API keys with their limiter state
+func adminKeysHandler(pool *KeyPool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		keys := make([]KeyInfo, 0, len(pool.Keys))
+		for _, key := range pool.Keys {
+			keys = append(keys, newKeyInfo(key))
+		}
+		writeJSON(w, http.StatusOK, keys)
+	}
+}
+
+// adminSetKeyEnabledHandler enables or disables the API key at the {index} path value
+func adminSetKeyEnabledHandler(pool *KeyPool, enabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		index, err := strconv.Atoi(r.PathValue("index"))
+		if err != nil {
+			writeError(w, r, newAPIError(http.StatusBadRequest, ErrCodeInvalidKeyIndex, "Invalid key index"))
+			return
+		}
+		key, ok := pool.Key(index)
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusNotFound, ErrCodeKeyNotFound, "Key not found"))
+			return
+		}
+
+		key.SetEnabled(enabled)
+		loggerFrom(r.Context()).Info("API key updated", slog.Int("key_index", index), slog.Bool("enabled", enabled))
+		writeJSON(w, http.StatusOK, newKeyInfo(key))
+	}
+}
+
+// adminSnapshotsHandler returns metadata of the snapshot loaded for each operator
+func adminSnapshotsHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		now := time.Now()
+		snapshots := make([]SnapshotInfo, 0, len(store.Operators()))
+		for _, operator := range store.Operators() {
+			info := SnapshotInfo{OperatorStatus: operatorStatus(store, operator, now)}
+			if snapshot := store.Snapshot(operator.ID); snapshot != nil {
+				info.Stops = len(snapshot.Stops)
+				info.Timetables = snapshot.Timetables.Len()
+			}
+			snapshots = append(snapshots, info)
+		}
+		writeJSON(w, http.StatusOK, snapshots)
+	}
+}
+
+// registerAdminRoutes adds the /admin API to the mux, restricted to clients with the admin scope.
+// Like its responses, its errors are JSON.
+func registerAdminRoutes(mux *http.ServeMux, deps Deps) {
+	admin := func(next http.HandlerFunc) http.HandlerFunc {
+		return jsonErrorsMiddleware(authMiddleware(deps.Clients, ScopeAdmin, next))
+	}
+
+	mux.HandleFunc("POST /admin/cache/purge", admin(adminPurgeCacheHandler(deps.Cache)))
+	mux.HandleFunc("POST /admin/reload", admin(adminReloadHandler(deps.Loader)))
+	mux.HandleFunc("GET /admin/keys", admin(adminKeysHandler(deps.KeyPool)))
+	mux.HandleFunc("POST /admin/keys/{index}/enable", admin(adminSetKeyEnabledHandler(deps.KeyPool, true)))
+	mux.HandleFunc("POST /admin/keys/{index}/disable", admin(adminSetKeyEnabledHandler(deps.KeyPool, false)))
+	mux.HandleFunc("GET /admin/snapshots", admin(adminSnapshotsHandler(deps.Store)))
+}
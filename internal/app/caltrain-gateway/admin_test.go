@@ -0,0 +1,166 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeAdminError returns the code of the error envelope in the response
+func decodeAdminError(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected a JSON error, got Content-Type %q", ct)
+	}
+	var envelope ErrorEnvelope
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("failed to decode error envelope: %v", err)
+	}
+	return envelope.Error.Code
+}
+
+func TestAdminAPI(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminSecret = "admin-secret"
+	keyPool := NewKeyPool([]string{"first-key-1234", "second-key-5678"}, 1, 1)
+	responseCache := NewResponseCache(time.Minute, time.Minute)
+	responseCache.Set("/transit/stops?agency=CT", &apiResponse{fetchedAt: time.Now()})
+	responseCache.Set("/transit/StopMonitoring?agency=CT", &apiResponse{fetchedAt: time.Now()})
+	loader := &Loader{}
+
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: keyPool,
+		Store:   newExampleStore(t),
+		Cache:   responseCache,
+		Loader:  loader,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	do := func(method, url, secret string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		if secret != "" {
+			req.Header.Set("X-API-SECRET", secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("requires admin secret", func(t *testing.T) {
+		for _, secret := range []string{"", "wrong"} {
+			rec := do("GET", "/admin/keys", secret)
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("Expected status %d with secret %q, got %d", http.StatusUnauthorized, secret, rec.Code)
+			}
+			if code := decodeAdminError(t, rec); code != ErrCodeUnauthorized {
+				t.Errorf("Expected error code %s, got %s", ErrCodeUnauthorized, code)
+			}
+		}
+	})
+
+	t.Run("list keys masked", func(t *testing.T) {
+		rec := do("GET", "/admin/keys", "admin-secret")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if strings.Contains(rec.Body.String(), "first-key") {
+			t.Errorf("Expected keys to be masked, got %s", rec.Body.String())
+		}
+		var keys []KeyInfo
+		if err := json.NewDecoder(rec.Body).Decode(&keys); err != nil {
+			t.Fatalf("failed to decode keys: %v", err)
+		}
+		if len(keys) != 2 || keys[0].Key != "****1234" || keys[1].Index != 2 || !keys[0].Enabled {
+			t.Errorf("Unexpected keys: %+v", keys)
+		}
+	})
+
+	t.Run("disable and enable key", func(t *testing.T) {
+		if rec := do("POST", "/admin/keys/1/disable", "admin-secret"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		for range 2 {
+			// Only the second key is handed out while the first is disabled
+			if key, ok := keyPool.GetAvailableKey(); ok && key.Index() != 2 {
+				t.Errorf("Expected key 2, got %d", key.Index())
+			}
+		}
+		if rec := do("POST", "/admin/keys/1/enable", "admin-secret"); rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if key, _ := keyPool.Key(1); !key.Enabled() {
+			t.Error("Expected key 1 to be enabled again")
+		}
+		rec := do("POST", "/admin/keys/3/disable", "admin-secret")
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected status %d for unknown key, got %d", http.StatusNotFound, rec.Code)
+		}
+		if code := decodeAdminError(t, rec); code != ErrCodeKeyNotFound {
+			t.Errorf("Expected error code %s, got %s", ErrCodeKeyNotFound, code)
+		}
+		rec = do("POST", "/admin/keys/first/disable", "admin-secret")
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status %d for invalid index, got %d", http.StatusBadRequest, rec.Code)
+		}
+		if code := decodeAdminError(t, rec); code != ErrCodeInvalidKeyIndex {
+			t.Errorf("Expected error code %s, got %s", ErrCodeInvalidKeyIndex, code)
+		}
+	})
+
+	t.Run("purge cache by prefix", func(t *testing.T) {
+		rec := do("POST", "/admin/cache/purge?prefix=/transit/stops", "admin-secret")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"purged":1`) {
+			t.Errorf("Expected one purged entry, got %s", rec.Body.String())
+		}
+		if _, status := responseCache.Get("/transit/StopMonitoring?agency=CT"); status != cacheHit {
+			t.Error("Expected entries outside the prefix to be kept")
+		}
+	})
+
+	t.Run("trigger reload", func(t *testing.T) {
+		rec := do("POST", "/admin/reload", "admin-secret")
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("Expected status %d, got %d", http.StatusAccepted, rec.Code)
+		}
+		if !strings.Contains(rec.Body.String(), `"queued":true`) {
+			t.Errorf("Expected the reload to be queued, got %s", rec.Body.String())
+		}
+		// The loader is not running, so the reload is still pending
+		if loader.Reload() {
+			t.Error("Expected the reload requested through the admin API to be pending")
+		}
+	})
+
+	t.Run("snapshot metadata", func(t *testing.T) {
+		rec := do("GET", "/admin/snapshots", "admin-secret")
+		var snapshots []SnapshotInfo
+		if err := json.NewDecoder(rec.Body).Decode(&snapshots); err != nil {
+			t.Fatalf("failed to decode snapshots: %v", err)
+		}
+		if len(snapshots) != 1 || snapshots[0].ID != "CT" || snapshots[0].Version == "" || snapshots[0].Stops == 0 || snapshots[0].Timetables != 1 {
+			t.Errorf("Unexpected snapshots: %+v", snapshots)
+		}
+	})
+}
+
+func TestAdminAPI_Disabled(t *testing.T) {
+	handler, err := NewHandler(Deps{Config: DefaultConfig(), KeyPool: NewKeyPool([]string{"key"}, 1, 1), Store: newExampleStore(t)})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/admin/keys", nil))
+	if rec.Code == http.StatusOK {
+		t.Errorf("Expected the admin API to be unavailable without an admin secret, got status %d", rec.Code)
+	}
+}
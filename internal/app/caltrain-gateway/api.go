@@ -0,0 +1,138 @@
+package caltraingateway
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"caltrain-gateway/pkg/api"
+)
+
+// apiV1Prefix is the path prefix of the versioned API
+const apiV1Prefix = "/v1"
+
+// legacyRoutesDeprecated is when the unversioned routes were deprecated in favor of /v1
+var legacyRoutesDeprecated = time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+
+// Error codes of the /v1 API
+const (
+	ErrCodeUnauthorized        = "unauthorized"
+	ErrCodeForbidden           = "forbidden"
+	ErrCodeRateLimited         = "rate_limited"
+	ErrCodeKeysExhausted       = "keys_exhausted"
+	ErrCodeMethodNotAllowed    = "method_not_allowed"
+	ErrCodeQueryTooLong        = "query_too_long"
+	ErrCodeEndpointNotAllowed  = "endpoint_not_allowed"
+	ErrCodeOperatorNotAllowed  = "operator_not_allowed"
+	ErrCodeMissingOperator     = "missing_operator"
+	ErrCodeUnknownOperator     = "unknown_operator"
+	ErrCodeTimetableNotLoaded  = "timetable_not_loaded"
+	ErrCodeInvalidWeekday      = "invalid_weekday"
+	ErrCodeInvalidDate         = "invalid_date"
+	ErrCodeLineNotFound        = "line_not_found"
+	ErrCodeTrainNotFound       = "train_not_found"
+	ErrCodeUpstreamUnavailable = "upstream_unavailable"
+	ErrCodeUpstreamError       = "upstream_error"
+	ErrCodeProxyDisabled       = "proxy_disabled"
+	ErrCodeInvalidKeyIndex     = "invalid_key_index"
+	ErrCodeKeyNotFound         = "key_not_found"
+	ErrCodeReloadUnavailable   = "reload_unavailable"
+	ErrCodeInternal            = "internal_error"
+)
+
+// Types of the /v1 responses, shared with clients
+type (
+	APIError      = api.APIError
+	ErrorEnvelope = api.ErrorEnvelope
+	Meta          = api.Meta
+)
+
+// DataEnvelope is the body of a successful /v1 response
+type DataEnvelope[T any] = api.DataEnvelope[T]
+
+// retryableStatus reports whether a request failing with the status code may succeed later
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// newAPIError returns an error with the status code, code and message
+func newAPIError(status int, code, message string) *APIError {
+	return &APIError{Status: status, Code: code, Message: message, Retryable: retryableStatus(status)}
+}
+
+// apiVersionKey is the context key marking requests to the /v1 API
+type apiVersionKey struct{}
+
+// isV1 reports whether the request was made to the /v1 API
+func isV1(r *http.Request) bool {
+	v, _ := r.Context().Value(apiVersionKey{}).(bool)
+	return v
+}
+
+// jsonErrorsKey is the context key marking requests outside /v1 whose errors are JSON envelopes
+type jsonErrorsKey struct{}
+
+// jsonErrorsMiddleware makes writeError answer with JSON envelopes on routes
+// outside /v1 that return JSON, like the admin API
+func jsonErrorsMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), jsonErrorsKey{}, true)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requestPathKey is the context key of the escaped path requested by the client,
+// before the /v1 prefix was stripped
+type requestPathKey struct{}
+
+// requestPath returns the escaped path requested by the client, including the /v1 prefix
+func requestPath(r *http.Request) string {
+	if path, ok := r.Context().Value(requestPathKey{}).(string); ok {
+		return path
+	}
+	return r.URL.EscapedPath()
+}
+
+// apiV1Middleware marks requests as made to the /v1 API and strips the prefix,
+// so the handlers and the proxy see the same paths as for the legacy routes.
+// The requested path is kept for checking signatures, which cover the prefix.
+func apiV1Middleware(next http.HandlerFunc) http.HandlerFunc {
+	stripped := http.StripPrefix(apiV1Prefix, next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), apiVersionKey{}, true)
+		ctx = context.WithValue(ctx, requestPathKey{}, r.URL.EscapedPath())
+		stripped.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
+// deprecatedMiddleware marks responses of the legacy routes as deprecated and
+// links to their /v1 successor
+func deprecatedMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	deprecation := "@" + strconv.FormatInt(legacyRoutesDeprecated.Unix(), 10)
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", deprecation)
+		w.Header().Set("Link", "<"+apiV1Prefix+r.URL.EscapedPath()+`>; rel="successor-version"`)
+		next(w, r)
+	}
+}
+
+// writeError writes the error as a JSON envelope for /v1 requests and as plain
+// text for the legacy routes
+func writeError(w http.ResponseWriter, r *http.Request, e *APIError) {
+	jsonErrors, _ := r.Context().Value(jsonErrorsKey{}).(bool)
+	if !isV1(r) && !jsonErrors {
+		http.Error(w, e.Message, e.Status)
+		return
+	}
+	e.RequestID = RequestID(r.Context())
+	// Headers set for a successful response do not describe the error
+	w.Header().Del("Content-Length")
+	w.Header().Del("Content-Encoding")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, e.Status, ErrorEnvelope{Error: e})
+}
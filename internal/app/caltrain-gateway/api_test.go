@@ -0,0 +1,207 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNewHandler_V1(t *testing.T) {
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/transit/VehicleMonitoring") {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer mockAPI.Close()
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	cfg.Secret = "mysecret"
+	cfg.Proxy.AllowedPaths = append(cfg.Proxy.AllowedPaths, "transit/lines", "transit/VehicleMonitoring")
+
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"test-key"}, 100, 10),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name              string
+		url               string
+		secret            string
+		expectedStatus    int
+		expectedCode      string
+		expectedUpstream  int
+		expectedRetryable bool
+		expectedBody      string
+	}{
+		{name: "timetable", url: "/v1/caltrain/timetable?station=70261", secret: "mysecret", expectedStatus: http.StatusOK, expectedBody: `"data":{"70261"`},
+		{name: "train detail", url: "/v1/caltrain/trains/401", secret: "mysecret", expectedStatus: http.StatusOK, expectedBody: `"calls"`},
+		{name: "stops", url: "/v1/caltrain/stops", secret: "mysecret", expectedStatus: http.StatusOK, expectedBody: `"Name":"San Jose Diridon Caltrain Station Northbound"`},
+		{name: "missing secret", url: "/v1/caltrain/timetable", expectedStatus: http.StatusUnauthorized, expectedCode: ErrCodeUnauthorized},
+		{name: "invalid weekday", url: "/v1/caltrain/timetable?weekday=Someday", secret: "mysecret", expectedStatus: http.StatusBadRequest, expectedCode: ErrCodeInvalidWeekday},
+		{name: "unknown operator", url: "/v1/bart/timetable", secret: "mysecret", expectedStatus: http.StatusNotFound, expectedCode: ErrCodeUnknownOperator},
+		{name: "unknown train", url: "/v1/caltrain/trains/999", secret: "mysecret", expectedStatus: http.StatusNotFound, expectedCode: ErrCodeTrainNotFound},
+		{name: "proxied request", url: "/v1/transit/StopMonitoring?agency=CT", secret: "mysecret", expectedStatus: http.StatusOK, expectedBody: "/transit/StopMonitoring"},
+		{name: "allowlisted upstream path shaped like an operator route", url: "/v1/transit/lines?operator_id=CT", secret: "mysecret", expectedStatus: http.StatusOK, expectedBody: "/transit/lines"},
+		{name: "endpoint not allowed", url: "/v1/transit/secret?agency=CT", secret: "mysecret", expectedStatus: http.StatusForbidden, expectedCode: ErrCodeEndpointNotAllowed},
+		{name: "upstream error", url: "/v1/transit/VehicleMonitoring?agency=CT", secret: "mysecret", expectedStatus: http.StatusServiceUnavailable, expectedCode: ErrCodeUpstreamError, expectedUpstream: http.StatusServiceUnavailable, expectedRetryable: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.secret != "" {
+				req.Header.Set("X-API-SECRET", tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if rec.Header().Get("Deprecation") != "" {
+				t.Errorf("Expected no Deprecation header, got '%s'", rec.Header().Get("Deprecation"))
+			}
+			if tt.expectedCode == "" {
+				if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+					t.Errorf("Expected body to contain %q, got '%s'", tt.expectedBody, rec.Body.String())
+				}
+				return
+			}
+
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Expected Content-Type 'application/json', got '%s'", ct)
+			}
+			var envelope ErrorEnvelope
+			if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+				t.Fatalf("Failed to decode error: %v", err)
+			}
+			e := envelope.Error
+			if e == nil {
+				t.Fatal("Expected error in envelope")
+			}
+			if e.Code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, e.Code)
+			}
+			if e.Message == "" {
+				t.Error("Expected error message")
+			}
+			if e.UpstreamStatus != tt.expectedUpstream {
+				t.Errorf("Expected upstream status %d, got %d", tt.expectedUpstream, e.UpstreamStatus)
+			}
+			if e.Retryable != tt.expectedRetryable {
+				t.Errorf("Expected retryable %v, got %v", tt.expectedRetryable, e.Retryable)
+			}
+			if e.RequestID == "" || e.RequestID != rec.Header().Get(requestIDHeader) {
+				t.Errorf("Expected request ID '%s', got '%s'", rec.Header().Get(requestIDHeader), e.RequestID)
+			}
+		})
+	}
+}
+
+func TestNewHandler_V1DataEnvelope(t *testing.T) {
+	cfg := DefaultConfig()
+	store := newExampleStore(t)
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   store,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/v1/caltrain/lines", nil)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body := rec.Body.String()
+	etag := rec.Header().Get("ETag")
+	var envelope DataEnvelope[[]Line]
+	if err := json.NewDecoder(rec.Body).Decode(&envelope); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(envelope.Data) == 0 {
+		t.Error("Expected lines in data")
+	}
+	snapshot := store.Snapshot("CT")
+	if envelope.Meta == nil || envelope.Meta.Version != snapshot.Version {
+		t.Errorf("Expected meta with version '%s', got %+v", snapshot.Version, envelope.Meta)
+	}
+
+	// The snapshot version stays the validator of the enveloped representation
+	req = httptest.NewRequest("GET", "/v1/caltrain/lines", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, rec.Code)
+	}
+
+	// Reloading unchanged data keeps the representation behind the ETag
+	store.Set("CT", snapshot.Dataset)
+	if !store.Snapshot("CT").LoadedAt.After(snapshot.LoadedAt) {
+		t.Fatal("Expected the reload to update the load time")
+	}
+	req = httptest.NewRequest("GET", "/v1/caltrain/lines", nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("ETag") != etag || rec.Body.String() != body {
+		t.Errorf("Expected the same ETag %s and body after reloading unchanged data, got %s and '%s'", etag, rec.Header().Get("ETag"), rec.Body.String())
+	}
+}
+
+func TestNewHandler_DeprecatedRoutes(t *testing.T) {
+	cfg := DefaultConfig()
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		url            string
+		expectedStatus int
+		expectedLink   string
+	}{
+		{url: "/caltrain/timetable", expectedStatus: http.StatusOK, expectedLink: `</v1/caltrain/timetable>; rel="successor-version"`},
+		{url: "/caltrain/trains/999", expectedStatus: http.StatusNotFound, expectedLink: `</v1/caltrain/trains/999>; rel="successor-version"`},
+		{url: "/up", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Link"); got != tt.expectedLink {
+				t.Errorf("Expected Link '%s', got '%s'", tt.expectedLink, got)
+			}
+			if got := rec.Header().Get("Deprecation") != ""; got != (tt.expectedLink != "") {
+				t.Errorf("Expected Deprecation header to be set: %v, got %v", tt.expectedLink != "", got)
+			}
+			// Legacy errors stay plain text
+			if tt.expectedStatus >= 400 && !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") {
+				t.Errorf("Expected plain text error, got '%s'", rec.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
@@ -1,12 +1,76 @@
 package caltraingateway
 
 import (
+	"strings"
 	"time"
 
 	"github.com/patrickmn/go-cache"
 )
 
-// Cache is a global cache instance with 2 minute TTL and 10 minute cleanup interval.
-var Cache = cache.New(2*time.Minute, 10*time.Minute)
+// cacheStatus is the result of a cache lookup
+type cacheStatus string
 
-var DefaultExpiration = cache.DefaultExpiration
+const (
+	cacheHit   cacheStatus = "hit"
+	cacheMiss  cacheStatus = "miss"
+	cacheStale cacheStatus = "stale" // the entry expired but was not purged yet
+)
+
+// ResponseCache stores successful upstream responses.
+// Entries are fresh for the TTL and are purged by the first cleanup after it,
+// so lookups of expired entries can be told apart from keys never seen before.
+type ResponseCache struct {
+	items *cache.Cache
+	ttl   time.Duration
+}
+
+// NewResponseCache creates a cache with the given TTL and cleanup interval
+func NewResponseCache(ttl, cleanupInterval time.Duration) *ResponseCache {
+	return &ResponseCache{
+		// Expired entries are kept until the next cleanup, at most one interval
+		items: cache.New(ttl+cleanupInterval, cleanupInterval),
+		ttl:   ttl,
+	}
+}
+
+// Get returns the fresh response stored for the key
+func (c *ResponseCache) Get(key string) (*apiResponse, cacheStatus) {
+	item, found := c.items.Get(key)
+	if !found {
+		return nil, cacheMiss
+	}
+
+	response := item.(*apiResponse)
+	if time.Since(response.fetchedAt) >= c.ttl {
+		return nil, cacheStale
+	}
+	return response, cacheHit
+}
+
+// Set stores a response for the key
+func (c *ResponseCache) Set(key string, response *apiResponse) {
+	c.items.Set(key, response, cache.DefaultExpiration)
+}
+
+// Flush removes all entries
+func (c *ResponseCache) Flush() {
+	c.items.Flush()
+}
+
+// DeletePrefix removes all entries whose key starts with the prefix and returns
+// how many were removed. An empty prefix removes every entry.
+func (c *ResponseCache) DeletePrefix(prefix string) int {
+	removed := 0
+	for key := range c.items.Items() {
+		if strings.HasPrefix(key, prefix) {
+			c.items.Delete(key)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Len returns the number of stored entries, including expired ones
+func (c *ResponseCache) Len() int {
+	return c.items.ItemCount()
+}
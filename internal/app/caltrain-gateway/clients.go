@@ -0,0 +1,416 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"golang.org/x/time/rate"
+	"gopkg.in/yaml.v3"
+)
+
+// Scope grants a client access to a group of routes
+type Scope string
+
+const (
+	// ScopeProxy allows requests proxied to the 511 API
+	ScopeProxy Scope = "proxy"
+	// ScopeTimetable allows the operator routes served from loaded timetables
+	ScopeTimetable Scope = "timetable"
+	// ScopeAdmin allows the /admin API
+	ScopeAdmin Scope = "admin"
+)
+
+// validScopes are the scopes a client can be granted
+var validScopes = []Scope{ScopeProxy, ScopeTimetable, ScopeAdmin}
+
+// secretHashPrefix marks a secret given as the hex-encoded SHA-256 hash of its value
+const secretHashPrefix = "sha256:"
+
+// HashSecret returns the hash of a secret in the form accepted wherever a secret is configured
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return secretHashPrefix + hex.EncodeToString(sum[:])
+}
+
+// parseSecret returns the SHA-256 hash of a secret, which is either given in
+// plain text or already hashed in the form returned by HashSecret
+func parseSecret(secret string) ([sha256.Size]byte, error) {
+	var sum [sha256.Size]byte
+	hexHash, hashed := strings.CutPrefix(secret, secretHashPrefix)
+	if !hashed {
+		return sha256.Sum256([]byte(secret)), nil
+	}
+	if len(hexHash) != hex.EncodedLen(sha256.Size) {
+		return sum, errors.New("invalid SHA-256 hash, expected sha256: followed by 64 hex characters")
+	}
+	if _, err := hex.Decode(sum[:], []byte(hexHash)); err != nil {
+		return sum, errors.New("invalid SHA-256 hash, expected sha256: followed by 64 hex characters")
+	}
+	return sum, nil
+}
+
+// ClientKey is one of the secrets a client may authenticate with
+type ClientKey struct {
+	// Key is the secret in plain text or as a hash in the form returned by HashSecret
+	Key string `yaml:"key"`
+	// Expires is when the key stops being accepted, used to retire the old key after
+	// a rotation. Keys without an expiry are accepted until they are removed.
+	Expires time.Time `yaml:"expires"`
+}
+
+// Client is a named consumer of the gateway with its own keys, scopes and rate limit
+type Client struct {
+	// Name identifies the client in logs
+	Name string `yaml:"name"`
+	// Key is the secret the client sends in the X-API-SECRET or Authorization header,
+	// in plain text or as a hash in the form returned by HashSecret
+	Key string `yaml:"key"`
+	// Keys are further secrets accepted for the client, e.g. while rotating its key
+	Keys []ClientKey `yaml:"keys"`
+	// SigningKey is the HMAC-SHA256 key of a device that signs its requests instead
+	// of sending a secret. Unlike keys it must be given in plain text.
+	SigningKey string `yaml:"signing_key"`
+	// Scopes are the route groups the client may access
+	Scopes []Scope `yaml:"scopes"`
+	// RateLimit is the number of requests per second allowed, 0 means unlimited
+	RateLimit float64 `yaml:"rate_limit"`
+	// Burst is the burst size allowed on top of the rate limit
+	Burst int `yaml:"burst"`
+}
+
+// allKeys returns the key and the further keys of the client
+func (c *Client) allKeys() []ClientKey {
+	keys := c.Keys
+	if c.Key != "" {
+		keys = append([]ClientKey{{Key: c.Key}}, keys...)
+	}
+	return keys
+}
+
+// hasScope reports whether the client was granted the scope
+func (c *Client) hasScope(scope Scope) bool {
+	return slices.Contains(c.Scopes, scope)
+}
+
+// registeredClient is a client together with its rate limiter
+type registeredClient struct {
+	Client
+	limiter *rate.Limiter
+}
+
+// credential is the hash of a client key. Only hashes are kept in memory.
+type credential struct {
+	hash    [sha256.Size]byte
+	expires time.Time
+	client  *registeredClient
+}
+
+// ClientRegistry holds the clients allowed to use the gateway
+type ClientRegistry struct {
+	clients     []*registeredClient
+	credentials []credential
+	byName      map[string]*registeredClient
+	// nonces remembers the nonces of signed requests to reject replays
+	nonces *cache.Cache
+	// maxSkew is how far the timestamp of a signed request may be off
+	maxSkew time.Duration
+	// jwt verifies bearer tokens of an identity provider, nil if not configured
+	jwt *jwtVerifier
+}
+
+// clientsFile is the format of the client registry file
+type clientsFile struct {
+	Clients []Client `yaml:"clients"`
+}
+
+// NewClientRegistry creates a registry of the given clients.
+// Names and keys must be unique and every client needs a key or signing key and
+// at least one known scope.
+func NewClientRegistry(clients []Client) (*ClientRegistry, error) {
+	registry := &ClientRegistry{
+		byName:  make(map[string]*registeredClient),
+		nonces:  cache.New(cache.NoExpiration, time.Minute),
+		maxSkew: defaultSignatureMaxSkew,
+	}
+	names := make(map[string]bool)
+	owners := make(map[[sha256.Size]byte]string)
+
+	var errs []error
+	for i, c := range clients {
+		switch {
+		case c.Name == "":
+			errs = append(errs, fmt.Errorf("client %d has no name", i+1))
+			continue
+		case names[c.Name]:
+			errs = append(errs, fmt.Errorf("client %s is defined more than once", c.Name))
+			continue
+		case len(c.allKeys()) == 0 && c.SigningKey == "":
+			errs = append(errs, fmt.Errorf("client %s has no key", c.Name))
+			continue
+		case c.SigningKey != "" && len(c.SigningKey) < minSigningKeyLength:
+			errs = append(errs, fmt.Errorf("signing key of client %s must be at least %d characters", c.Name, minSigningKeyLength))
+			continue
+		case len(c.Scopes) == 0:
+			errs = append(errs, fmt.Errorf("client %s has no scopes", c.Name))
+			continue
+		case c.RateLimit < 0:
+			errs = append(errs, fmt.Errorf("client %s has a negative rate limit", c.Name))
+			continue
+		}
+		for _, scope := range c.Scopes {
+			if !slices.Contains(validScopes, scope) {
+				errs = append(errs, fmt.Errorf("client %s has unknown scope %q", c.Name, scope))
+			}
+		}
+
+		limit := rate.Inf
+		if c.RateLimit > 0 {
+			limit = rate.Limit(c.RateLimit)
+		}
+		burst := max(c.Burst, 1)
+
+		rc := &registeredClient{Client: c, limiter: rate.NewLimiter(limit, burst)}
+		names[c.Name] = true
+		registry.byName[c.Name] = rc
+		registry.clients = append(registry.clients, rc)
+
+		for j, key := range c.allKeys() {
+			hash, err := parseSecret(key.Key)
+			switch {
+			case key.Key == "":
+				errs = append(errs, fmt.Errorf("key %d of client %s is empty", j+1, c.Name))
+			case err != nil:
+				errs = append(errs, fmt.Errorf("key %d of client %s: %w", j+1, c.Name, err))
+			case owners[hash] != "":
+				errs = append(errs, fmt.Errorf("client %s uses the same key as client %s", c.Name, owners[hash]))
+			default:
+				owners[hash] = c.Name
+				registry.credentials = append(registry.credentials, credential{hash: hash, expires: key.Expires, client: rc})
+			}
+		}
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid clients: %w", err)
+	}
+	return registry, nil
+}
+
+// LoadClientRegistry loads the clients from a YAML file of the form
+//
+//	clients:
+//	  - name: dashboard
+//	    key: some-secret
+//	    scopes: [proxy, timetable]
+//	    rate_limit: 5
+//	    burst: 10
+func LoadClientRegistry(filename string) (*ClientRegistry, error) {
+	clients, err := readClientsFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return NewClientRegistry(clients)
+}
+
+// readClientsFile reads the clients defined in a YAML file
+func readClientsFile(filename string) ([]Client, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clients file: %w", err)
+	}
+
+	var file clientsFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse clients file %s: %w", filename, err)
+	}
+	return file.Clients, nil
+}
+
+// sharedSecretClients returns the clients for the shared secrets of the configuration.
+// The secret grants the proxy and timetable scopes, the admin secret the admin scope.
+// The previous secret is accepted as well until it expires.
+func sharedSecretClients(cfg *Config) []Client {
+	var clients []Client
+	if cfg.Secret != "" {
+		client := Client{Name: "shared-secret", Key: cfg.Secret, Scopes: []Scope{ScopeProxy, ScopeTimetable}}
+		if cfg.PreviousSecret != "" {
+			client.Keys = []ClientKey{{Key: cfg.PreviousSecret, Expires: cfg.PreviousSecretExpires}}
+		}
+		clients = append(clients, client)
+	}
+	if cfg.AdminSecret != "" {
+		if cfg.AdminSecret == cfg.Secret {
+			clients[0].Scopes = append(clients[0].Scopes, ScopeAdmin)
+		} else {
+			clients = append(clients, Client{Name: "admin-secret", Key: cfg.AdminSecret, Scopes: []Scope{ScopeAdmin}})
+		}
+	}
+	return clients
+}
+
+// LoadClients builds the client registry from the configured clients file, shared
+// secrets and JWT issuer, whose keys are loaded right away
+func LoadClients(ctx context.Context, cfg *Config) (*ClientRegistry, error) {
+	var clients []Client
+	if cfg.ClientsFile != "" {
+		var err error
+		if clients, err = readClientsFile(cfg.ClientsFile); err != nil {
+			return nil, err
+		}
+	}
+	registry, err := NewClientRegistry(append(clients, sharedSecretClients(cfg)...))
+	if err != nil {
+		return nil, err
+	}
+	registry.maxSkew = cfg.SignatureMaxSkew
+
+	if cfg.JWT.Enabled() {
+		if registry.jwt, err = newJWTVerifier(ctx, cfg.JWT); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Len returns the number of registered clients
+func (reg *ClientRegistry) Len() int {
+	if reg == nil {
+		return 0
+	}
+	return len(reg.clients)
+}
+
+// configured reports whether any client or JWT issuer is configured
+func (reg *ClientRegistry) configured() bool {
+	return reg != nil && (len(reg.clients) > 0 || reg.jwt != nil)
+}
+
+// HasScope reports whether any client or token can be granted the scope
+func (reg *ClientRegistry) HasScope(scope Scope) bool {
+	if reg == nil {
+		return false
+	}
+	if reg.jwt != nil && reg.jwt.grants(scope) {
+		return true
+	}
+	for _, c := range reg.clients {
+		if c.hasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// bearerToken returns the token of the Authorization header if it uses the Bearer scheme
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// requestSecret returns the secret sent in the X-API-SECRET header or as a bearer token
+func requestSecret(r *http.Request) string {
+	if secret := r.Header.Get("X-API-SECRET"); secret != "" {
+		return secret
+	}
+	return bearerToken(r)
+}
+
+// authenticate returns the client that signed the request, the client of its JWT
+// or the client whose unexpired key it carries.
+// The hash of the secret is compared with every known key in constant time, so
+// the response time reveals neither the keys nor whether one partially matched.
+func (reg *ClientRegistry) authenticate(r *http.Request, now time.Time) (*registeredClient, bool) {
+	if isSigned(r) {
+		client, err := reg.verifySignature(r, now)
+		if err != nil {
+			loggerFrom(r.Context()).Debug("Rejected signed request", "error", err)
+			return nil, false
+		}
+		return client, true
+	}
+	if token := bearerToken(r); reg.jwt != nil && isJWT(token) {
+		client, err := reg.jwt.verify(r.Context(), token)
+		if err != nil {
+			loggerFrom(r.Context()).Debug("Rejected bearer token", "error", err)
+			return nil, false
+		}
+		return client, true
+	}
+
+	secret := requestSecret(r)
+	if secret == "" {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(secret))
+
+	var match *credential
+	for i := range reg.credentials {
+		if subtle.ConstantTimeCompare(hash[:], reg.credentials[i].hash[:]) == 1 {
+			match = &reg.credentials[i]
+		}
+	}
+	if match == nil || (!match.expires.IsZero() && now.After(match.expires)) {
+		return nil, false
+	}
+	return match.client, true
+}
+
+// retryAfter returns the Retry-After header value for the given delay in whole seconds
+func retryAfter(delay float64) string {
+	return strconv.Itoa(int(math.Ceil(delay)))
+}
+
+// authMiddleware checks that the request carries an unexpired key, a signature or a
+// JWT of a client granted the scope and applies the client's rate limit.
+// Authentication is only skipped if no clients are configured at all, so a
+// scope that no client is granted is forbidden rather than open.
+func authMiddleware(clients *ClientRegistry, scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !clients.configured() {
+			next(w, r)
+			return
+		}
+
+		client, ok := clients.authenticate(r, time.Now())
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusUnauthorized, ErrCodeUnauthorized, "Unauthorized"))
+			return
+		}
+		addLogAttrs(r.Context(), slog.String("client", client.Name))
+
+		if !client.hasScope(scope) {
+			writeError(w, r, newAPIError(http.StatusForbidden, ErrCodeForbidden, "Forbidden"))
+			return
+		}
+
+		reservation := client.limiter.Reserve()
+		if delay := reservation.Delay(); delay > 0 {
+			// Give the token back, the request is rejected instead of delayed
+			reservation.Cancel()
+			w.Header().Set("Retry-After", retryAfter(delay.Seconds()))
+			writeError(w, r, newAPIError(http.StatusTooManyRequests, ErrCodeRateLimited, "Rate limit exceeded for client"))
+			return
+		}
+		next(w, r)
+	}
+}
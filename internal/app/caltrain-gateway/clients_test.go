@@ -0,0 +1,298 @@
+package caltraingateway
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNewClientRegistry_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		clients  []Client
+		contains string
+	}{
+		{
+			name:     "missing name",
+			clients:  []Client{{Key: "k", Scopes: []Scope{ScopeProxy}}},
+			contains: "client 1 has no name",
+		},
+		{
+			name:     "duplicate name",
+			clients:  []Client{{Name: "a", Key: "k1", Scopes: []Scope{ScopeProxy}}, {Name: "a", Key: "k2", Scopes: []Scope{ScopeProxy}}},
+			contains: "client a is defined more than once",
+		},
+		{
+			name:     "duplicate key",
+			clients:  []Client{{Name: "a", Key: "k", Scopes: []Scope{ScopeProxy}}, {Name: "b", Key: "k", Scopes: []Scope{ScopeProxy}}},
+			contains: "client b uses the same key as client a",
+		},
+		{
+			name:     "missing scopes",
+			clients:  []Client{{Name: "a", Key: "k"}},
+			contains: "client a has no scopes",
+		},
+		{
+			name:     "unknown scope",
+			clients:  []Client{{Name: "a", Key: "k", Scopes: []Scope{"everything"}}},
+			contains: `client a has unknown scope "everything"`,
+		},
+		{
+			name:     "invalid key hash",
+			clients:  []Client{{Name: "a", Key: "sha256:zz", Scopes: []Scope{ScopeProxy}}},
+			contains: "key 1 of client a: invalid SHA-256 hash",
+		},
+		{
+			name:     "same key in plain text and hashed",
+			clients:  []Client{{Name: "a", Key: "k", Scopes: []Scope{ScopeProxy}}, {Name: "b", Keys: []ClientKey{{Key: HashSecret("k")}}, Scopes: []Scope{ScopeProxy}}},
+			contains: "client b uses the same key as client a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewClientRegistry(tt.clients)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadClients(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "clients.yaml")
+	content := `clients:
+  - name: dashboard
+    key: dashboard-key
+    scopes: [proxy, timetable]
+    rate_limit: 1
+    burst: 2
+  - name: ops
+    key: ops-key
+    scopes: [admin]
+`
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write clients file: %v", err)
+	}
+
+	cfg := DefaultConfig()
+	cfg.ClientsFile = filename
+	cfg.Secret = "shared"
+	clients, err := LoadClients(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("LoadClients() error: %v", err)
+	}
+	if clients.Len() != 3 {
+		t.Errorf("Expected 3 clients including the shared secret, got %d", clients.Len())
+	}
+
+	cfg.ClientsFile = filepath.Join(t.TempDir(), "missing.yaml")
+	if _, err := LoadClients(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), "failed to read clients file") {
+		t.Errorf("Expected error for missing file, got %v", err)
+	}
+}
+
+func TestAuthMiddleware_Clients(t *testing.T) {
+	clients, err := NewClientRegistry([]Client{
+		{Name: "dashboard", Key: "dashboard-key", Scopes: []Scope{ScopeTimetable}, RateLimit: 0.5, Burst: 2},
+		{Name: "ops", Key: "ops-key", Scopes: []Scope{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler := authMiddleware(clients, ScopeTimetable, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name           string
+		key            string
+		expectedStatus int
+	}{
+		{name: "unknown key", key: "wrong", expectedStatus: http.StatusUnauthorized},
+		{name: "missing scope", key: "ops-key", expectedStatus: http.StatusForbidden},
+		{name: "first request within burst", key: "dashboard-key", expectedStatus: http.StatusOK},
+		{name: "second request within burst", key: "dashboard-key", expectedStatus: http.StatusOK},
+		{name: "rate limited", key: "dashboard-key", expectedStatus: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+			req.Header.Set("X-API-SECRET", tt.key)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if tt.expectedStatus == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "2" {
+				t.Errorf("Expected Retry-After '2', got '%s'", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestAuthMiddleware_KeyRotation(t *testing.T) {
+	now := time.Now()
+	clients, err := NewClientRegistry([]Client{{
+		Name: "display",
+		Key:  HashSecret("new-key"),
+		Keys: []ClientKey{
+			{Key: "old-key", Expires: now.Add(time.Hour)},
+			{Key: HashSecret("retired-key"), Expires: now.Add(-time.Hour)},
+		},
+		Scopes: []Scope{ScopeTimetable},
+	}})
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler := authMiddleware(clients, ScopeTimetable, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{name: "hashed key", header: "X-API-SECRET", value: "new-key", expectedStatus: http.StatusOK},
+		{name: "hash is not a key", header: "X-API-SECRET", value: HashSecret("new-key"), expectedStatus: http.StatusUnauthorized},
+		{name: "old key within overlap window", header: "X-API-SECRET", value: "old-key", expectedStatus: http.StatusOK},
+		{name: "expired key", header: "X-API-SECRET", value: "retired-key", expectedStatus: http.StatusUnauthorized},
+		{name: "bearer token", header: "Authorization", value: "Bearer new-key", expectedStatus: http.StatusOK},
+		{name: "lowercase bearer scheme", header: "Authorization", value: "bearer old-key", expectedStatus: http.StatusOK},
+		{name: "basic auth is not accepted", header: "Authorization", value: "Basic new-key", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong bearer token", header: "Authorization", value: "Bearer wrong", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+			req.Header.Set(tt.header, tt.value)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestSharedSecretClients_PreviousSecret(t *testing.T) {
+	cfg := &Config{
+		Secret:                "new-secret",
+		PreviousSecret:        HashSecret("old-secret"),
+		PreviousSecretExpires: time.Now().Add(time.Hour),
+	}
+	clients, err := NewClientRegistry(sharedSecretClients(cfg))
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+
+	for _, secret := range []string{"new-secret", "old-secret"} {
+		req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+		req.Header.Set("X-API-SECRET", secret)
+		if _, ok := clients.authenticate(req, time.Now()); !ok {
+			t.Errorf("Expected %s to be accepted", secret)
+		}
+		if _, ok := clients.authenticate(req, cfg.PreviousSecretExpires.Add(time.Second)); ok != (secret == "new-secret") {
+			t.Errorf("Expected only the new secret to be accepted after the overlap window, got %v for %s", ok, secret)
+		}
+	}
+}
+
+func TestNewHandler_AdminSecretOnly(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.AdminSecret = "admin-secret"
+	clients, err := NewClientRegistry(sharedSecretClients(cfg))
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+		Clients: clients,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	for _, url := range []string{"/transit/stops?agency=CT", "/caltrain/timetable"} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected status %d for %s with only an admin secret, got %d", http.StatusUnauthorized, url, rec.Code)
+		}
+	}
+
+	// The admin secret only grants the admin API
+	for url, expectedStatus := range map[string]int{"/admin/keys": http.StatusOK, "/caltrain/timetable": http.StatusForbidden} {
+		req := httptest.NewRequest("GET", url, nil)
+		req.Header.Set("X-API-SECRET", "admin-secret")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != expectedStatus {
+			t.Errorf("Expected status %d for %s with the admin secret, got %d", expectedStatus, url, rec.Code)
+		}
+	}
+}
+
+func TestNewHandler_ClientScopes(t *testing.T) {
+	clients, err := NewClientRegistry([]Client{
+		{Name: "display", Key: "display-key", Scopes: []Scope{ScopeTimetable}},
+		{Name: "ops", Key: "ops-key", Scopes: []Scope{ScopeAdmin}},
+	})
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler, err := NewHandler(Deps{
+		Config:  DefaultConfig(),
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+		Clients: clients,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		key            string
+		expectedStatus int
+	}{
+		{name: "timetable client reads timetable", method: "GET", url: "/caltrain/timetable", key: "display-key", expectedStatus: http.StatusOK},
+		{name: "admin client cannot read timetable", method: "GET", url: "/caltrain/timetable", key: "ops-key", expectedStatus: http.StatusForbidden},
+		// No client is granted the proxy scope, which must not leave the proxy open
+		{name: "proxy requires a key without proxy clients", method: "GET", url: "/transit/stops?agency=CT", expectedStatus: http.StatusUnauthorized},
+		{name: "timetable client cannot use proxy", method: "GET", url: "/transit/stops?agency=CT", key: "display-key", expectedStatus: http.StatusForbidden},
+		{name: "timetable client cannot use admin API", method: "GET", url: "/admin/keys", key: "display-key", expectedStatus: http.StatusForbidden},
+		{name: "admin client uses admin API", method: "GET", url: "/admin/keys", key: "ops-key", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.key != "" {
+				req.Header.Set("X-API-SECRET", tt.key)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
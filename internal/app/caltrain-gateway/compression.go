@@ -0,0 +1,313 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Supported content encodings
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+	encodingBrotli  = "br"
+	encodingZstd    = "zstd"
+)
+
+// supportedEncodings are the content encodings the gateway can produce
+var supportedEncodings = []string{encodingZstd, encodingBrotli, encodingGzip, encodingDeflate}
+
+// CompressionPolicy configures how responses are compressed
+type CompressionPolicy struct {
+	// Encodings are the content encodings offered to clients, in order of preference.
+	// Compression is disabled if empty.
+	Encodings []string `yaml:"encodings"`
+	// MinSize is the minimum body size in bytes worth compressing
+	MinSize int `yaml:"min_size"`
+	// ContentTypes are the media types compressed, e.g. "application/json".
+	// Entries ending in a slash, like "text/", match every subtype.
+	ContentTypes []string `yaml:"content_types"`
+}
+
+// DefaultCompressionPolicy returns the policy used when nothing else is configured
+func DefaultCompressionPolicy() CompressionPolicy {
+	return CompressionPolicy{
+		Encodings:    slices.Clone(supportedEncodings),
+		MinSize:      1024,
+		ContentTypes: []string{"application/json", "application/xml", "application/javascript", "text/"},
+	}
+}
+
+// Enabled reports whether any encoding is offered
+func (p CompressionPolicy) Enabled() bool {
+	return len(p.Encodings) > 0
+}
+
+// negotiate returns the encoding to use for a request's Accept-Encoding header,
+// or an empty string if the response should not be encoded. The client's
+// q-values decide first, the order of the policy's encodings breaks ties.
+func (p CompressionPolicy) negotiate(acceptEncoding string) string {
+	if acceptEncoding == "" {
+		return ""
+	}
+
+	accepted := make(map[string]float64)
+	for part := range strings.SplitSeq(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, encoding := range p.Encodings {
+		q, ok := accepted[encoding]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+// allowsContentType reports whether responses of the content type are compressed
+func (p CompressionPolicy) allowsContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return slices.ContainsFunc(p.ContentTypes, func(allowed string) bool {
+		if strings.HasSuffix(allowed, "/") {
+			return strings.HasPrefix(mediaType, allowed)
+		}
+		return mediaType == allowed
+	})
+}
+
+// compressible reports whether a body of the content type and size should be compressed
+func (p CompressionPolicy) compressible(contentType string, size int) bool {
+	return size >= p.MinSize && p.allowsContentType(contentType)
+}
+
+// validate checks the policy for unknown encodings and invalid sizes
+func (p CompressionPolicy) validate() []error {
+	var errs []error
+	for _, encoding := range p.Encodings {
+		if !slices.Contains(supportedEncodings, encoding) {
+			errs = append(errs, fmt.Errorf("compression.encodings must only contain %s, got %q", strings.Join(supportedEncodings, ", "), encoding))
+		}
+	}
+	if p.MinSize < 0 {
+		errs = append(errs, fmt.Errorf("compression.min_size must not be negative, got %d", p.MinSize))
+	}
+	return errs
+}
+
+// encoder is a compressor that can be reused for another destination
+type encoder interface {
+	io.WriteCloser
+	Reset(w io.Writer)
+}
+
+// encoderPools reuse encoders, whose buffers are expensive to allocate per response
+var encoderPools = map[string]*sync.Pool{
+	encodingGzip: {New: func() any {
+		return gzip.NewWriter(nil)
+	}},
+	encodingDeflate: {New: func() any {
+		// HTTP's deflate encoding is the zlib format, not raw deflate
+		return zlib.NewWriter(nil)
+	}},
+	encodingBrotli: {New: func() any {
+		return brotli.NewWriterLevel(nil, brotli.DefaultCompression)
+	}},
+	encodingZstd: {New: func() any {
+		// Options are valid, so the error can be ignored
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+		return enc
+	}},
+}
+
+// getEncoder returns a pooled encoder writing to w
+func getEncoder(encoding string, w io.Writer) encoder {
+	enc := encoderPools[encoding].Get().(encoder)
+	enc.Reset(w)
+	return enc
+}
+
+// putEncoder returns a closed encoder to its pool
+func putEncoder(encoding string, enc encoder) {
+	encoderPools[encoding].Put(enc)
+}
+
+// compressBytes returns the body compressed with the encoding
+func compressBytes(encoding string, body []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := getEncoder(encoding, &buf)
+	defer putEncoder(encoding, enc)
+
+	if _, err := enc.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to compress body with %s: %w", encoding, err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress body with %s: %w", encoding, err)
+	}
+	return buf.Bytes(), nil
+}
+
+// setContentEncoding marks the response as encoded. A strong ETag is made weak,
+// as it identifies the unencoded bytes and stays valid for conditional requests
+// under the weak comparison.
+func setContentEncoding(h http.Header, encoding string) {
+	h.Set("Content-Encoding", encoding)
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		h.Set("ETag", "W/"+etag)
+	}
+}
+
+// bodyAllowed reports whether a response with the status code may be compressed.
+// Error pages, empty and partial responses are sent as they are.
+func bodyAllowed(status int) bool {
+	return status >= 200 && status < 300 && status != http.StatusNoContent && status != http.StatusPartialContent
+}
+
+// compressWriter buffers the start of a response until it knows whether the body
+// is worth compressing, then writes it either compressed or as it is
+type compressWriter struct {
+	http.ResponseWriter
+	policy   CompressionPolicy
+	encoding string
+
+	status  int
+	buf     []byte
+	decided bool
+	encoder encoder
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	switch {
+	case w.decided || code < 200:
+		w.ResponseWriter.WriteHeader(code)
+	case w.status != 0:
+		// Superfluous call before the body was written, ignored like net/http does
+	default:
+		w.status = code
+		// Responses without a compressible body, e.g. 304 Not Modified, are written right away
+		if !bodyAllowed(code) {
+			w.decide()
+		}
+	}
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if w.decided {
+		if w.encoder != nil {
+			return w.encoder.Write(b)
+		}
+		return w.ResponseWriter.Write(b)
+	}
+
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.buf = append(w.buf, b...)
+	if len(w.buf) >= w.policy.MinSize {
+		if err := w.decide(); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// decide writes the header, compressing the body if it is allowed and not
+// already encoded, and flushes the buffered start of the body
+func (w *compressWriter) decide() error {
+	w.decided = true
+	h := w.Header()
+	if h.Get("Content-Type") == "" && len(w.buf) > 0 {
+		// Sniff the type now, as net/http would sniff the compressed bytes
+		h.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	if bodyAllowed(w.status) && h.Get("Content-Encoding") == "" && w.policy.compressible(h.Get("Content-Type"), len(w.buf)) {
+		h.Del("Content-Length")
+		setContentEncoding(h, w.encoding)
+		w.encoder = getEncoder(w.encoding, w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if w.encoder != nil {
+		_, err := w.encoder.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// close writes a response that stayed below the minimum size and finishes the compressed stream
+func (w *compressWriter) close() error {
+	if !w.decided {
+		// Nothing was written, leave the default response to net/http
+		if w.status == 0 {
+			return nil
+		}
+		if err := w.decide(); err != nil {
+			return err
+		}
+	}
+	if w.encoder == nil {
+		return nil
+	}
+	err := w.encoder.Close()
+	putEncoder(w.encoding, w.encoder)
+	w.encoder = nil
+	return err
+}
+
+// compressMiddleware compresses responses with the best encoding the client accepts.
+// Bodies that are small, of another content type, errors or already encoded are
+// sent as they are.
+func compressMiddleware(policy CompressionPolicy, next http.HandlerFunc) http.HandlerFunc {
+	if !policy.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on Accept-Encoding even when it is not compressed
+		w.Header().Add("Vary", "Accept-Encoding")
+
+		encoding := policy.negotiate(r.Header.Get("Accept-Encoding"))
+		if encoding == "" || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, policy: policy, encoding: encoding}
+		defer cw.close()
+		next(cw, r)
+	}
+}
@@ -0,0 +1,355 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// decodeBody decompresses a response body with the given content encoding
+func decodeBody(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "":
+		return string(body)
+	case encodingGzip:
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case encodingDeflate:
+		r, err = zlib.NewReader(bytes.NewReader(body))
+	case encodingBrotli:
+		r = brotli.NewReader(bytes.NewReader(body))
+	case encodingZstd:
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer dec.Close()
+		}
+		r = dec
+	default:
+		t.Fatalf("unknown encoding %q", encoding)
+	}
+	if err != nil {
+		t.Fatalf("failed to create %s reader: %v", encoding, err)
+	}
+	decoded, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("failed to decode %s body: %v", encoding, err)
+	}
+	return string(decoded)
+}
+
+func TestCompressionPolicy_Negotiate(t *testing.T) {
+	policy := DefaultCompressionPolicy()
+
+	tests := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "identity", expected: ""},
+		{acceptEncoding: "gzip", expected: "gzip"},
+		{acceptEncoding: "gzip, deflate, br, zstd", expected: "zstd"},
+		{acceptEncoding: "gzip, deflate, br", expected: "br"},
+		{acceptEncoding: "deflate", expected: "deflate"},
+		{acceptEncoding: "GZIP", expected: "gzip"},
+		{acceptEncoding: "br;q=0.5, gzip;q=0.8", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0, deflate", expected: "deflate"},
+		{acceptEncoding: "*", expected: "zstd"},
+		{acceptEncoding: "*;q=0.1, gzip", expected: "gzip"},
+		{acceptEncoding: "zstd;q=0, *", expected: "br"},
+		{acceptEncoding: "x-gzip-ish", expected: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.acceptEncoding, func(t *testing.T) {
+			if got := policy.negotiate(tt.acceptEncoding); got != tt.expected {
+				t.Errorf("Expected encoding '%s', got '%s'", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCompressMiddleware(t *testing.T) {
+	large := strings.Repeat(`{"stop":"Palo Alto","departure":"08:15"}`, 100)
+	policy := DefaultCompressionPolicy()
+
+	tests := []struct {
+		name             string
+		method           string
+		acceptEncoding   string
+		handler          http.HandlerFunc
+		expectedEncoding string
+		expectedStatus   int
+		expectedBody     string
+	}{
+		{
+			name:           "gzip",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Length", "4000")
+				w.Write([]byte(large))
+			},
+			expectedEncoding: "gzip",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     large,
+		},
+		{
+			name:           "deflate",
+			acceptEncoding: "deflate",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(large))
+			},
+			expectedEncoding: "deflate",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     large,
+		},
+		{
+			name:           "brotli",
+			acceptEncoding: "gzip, br",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(large))
+			},
+			expectedEncoding: "br",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     large,
+		},
+		{
+			name:           "zstd written in small chunks",
+			acceptEncoding: "zstd",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				for chunk := range slices.Chunk([]byte(large), 10) {
+					w.Write(chunk)
+				}
+			},
+			expectedEncoding: "zstd",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     large,
+		},
+		{
+			name:           "sniffed content type",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(strings.Repeat("plain text ", 200)))
+			},
+			expectedEncoding: "gzip",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     strings.Repeat("plain text ", 200),
+		},
+		{
+			name:           "client does not accept compression",
+			acceptEncoding: "",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(large))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   large,
+		},
+		{
+			name:           "small body",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{"ok":true}`))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   `{"ok":true}`,
+		},
+		{
+			name:           "error page",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.Error(w, strings.Repeat("Timetable not loaded ", 100), http.StatusServiceUnavailable)
+			},
+			expectedStatus: http.StatusServiceUnavailable,
+			expectedBody:   strings.Repeat("Timetable not loaded ", 100) + "\n",
+		},
+		{
+			name:           "content type not in allowlist",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "image/png")
+				w.Write([]byte(large))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   large,
+		},
+		{
+			name:           "already encoded",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Content-Encoding", "gzip")
+				body, _ := compressBytes(encodingGzip, []byte(large))
+				w.Write(body)
+			},
+			expectedEncoding: "gzip",
+			expectedStatus:   http.StatusOK,
+			expectedBody:     large,
+		},
+		{
+			name:           "not modified",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"abc"`)
+				w.WriteHeader(http.StatusNotModified)
+			},
+			expectedStatus: http.StatusNotModified,
+		},
+		{
+			name:           "HEAD request",
+			method:         "HEAD",
+			acceptEncoding: "gzip",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(large))
+			},
+			expectedStatus: http.StatusOK,
+			expectedBody:   large,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = "GET"
+			}
+			req := httptest.NewRequest(method, "/caltrain/timetable", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			compressMiddleware(policy, tt.handler)(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			encoding := rec.Header().Get("Content-Encoding")
+			if encoding != tt.expectedEncoding {
+				t.Errorf("Expected Content-Encoding '%s', got '%s'", tt.expectedEncoding, encoding)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Expected Vary 'Accept-Encoding', got '%s'", rec.Header().Get("Vary"))
+			}
+			if encoding != "" && rec.Header().Get("Content-Length") != "" {
+				t.Errorf("Expected no Content-Length on a compressed response, got '%s'", rec.Header().Get("Content-Length"))
+			}
+			if body := decodeBody(t, encoding, rec.Body.Bytes()); body != tt.expectedBody {
+				t.Errorf("Expected body of %d bytes, got %d bytes", len(tt.expectedBody), len(body))
+			}
+		})
+	}
+}
+
+func TestCompressMiddleware_WeakensETag(t *testing.T) {
+	handler := compressMiddleware(DefaultCompressionPolicy(), func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(strings.Repeat("x", 2000)))
+	})
+
+	req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if got := rec.Header().Get("ETag"); got != `W/"abc"` {
+		t.Errorf("Expected ETag 'W/\"abc\"', got '%s'", got)
+	}
+}
+
+func TestProxyHandler_PrecompressedVariants(t *testing.T) {
+	body := strings.Repeat(`{"MonitoredStopVisit":"Palo Alto"}`, 100)
+	requests := 0
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(body))
+	}))
+	defer mockAPI.Close()
+
+	policy := DefaultCompressionPolicy()
+	responseCache := NewResponseCache(time.Minute, time.Minute)
+	keyPool := NewKeyPool([]string{"key"}, 10, 10)
+	handler := compressMiddleware(policy, proxyHandler(keyPool, mockAPI.URL+"/", responseCache, policy, nil, newTracer(nil)))
+
+	for i, acceptEncoding := range []string{"gzip", "gzip", "br", ""} {
+		req := httptest.NewRequest("GET", "/transit/StopMonitoring?agency=CT", nil)
+		if acceptEncoding != "" {
+			req.Header.Set("Accept-Encoding", acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Header().Get("Content-Encoding") != acceptEncoding {
+			t.Errorf("Request %d: expected Content-Encoding '%s', got '%s'", i+1, acceptEncoding, rec.Header().Get("Content-Encoding"))
+		}
+		if got := decodeBody(t, acceptEncoding, rec.Body.Bytes()); got != body {
+			t.Errorf("Request %d: expected the upstream body, got %d bytes", i+1, len(got))
+		}
+		if acceptEncoding != "" && rec.Header().Get("Content-Length") != "" && rec.Header().Get("Content-Length") != strconv.Itoa(rec.Body.Len()) {
+			t.Errorf("Request %d: Content-Length '%s' does not match body of %d bytes", i+1, rec.Header().Get("Content-Length"), rec.Body.Len())
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("Expected 1 upstream request, got %d", requests)
+	}
+	cached, status := responseCache.Get("/transit/StopMonitoring?agency=CT")
+	if status != cacheHit {
+		t.Fatalf("Expected cached response, got %s", status)
+	}
+	if len(cached.variants) != 2 {
+		t.Errorf("Expected gzip and br variants to be cached, got %d variants", len(cached.variants))
+	}
+}
+
+func TestNewHandler_CompressedTimetable(t *testing.T) {
+	handler, err := NewHandler(Deps{
+		Config:  DefaultConfig(),
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected gzip-encoded 200 response, got %d with encoding '%s'", rec.Code, rec.Header().Get("Content-Encoding"))
+	}
+	etag := rec.Header().Get("ETag")
+
+	// The revalidation of the compressed copy must not carry a gzip body
+	req = httptest.NewRequest("GET", "/caltrain/timetable", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d for ETag %s, got %d", http.StatusNotModified, etag, rec.Code)
+	}
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected empty unencoded 304 response, got %d bytes with encoding '%s'", rec.Body.Len(), rec.Header().Get("Content-Encoding"))
+	}
+}
@@ -0,0 +1,84 @@
+package caltraingateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// strongETag returns a quoted strong entity tag derived from the given body
+func strongETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// setValidators sets the ETag and Last-Modified response headers
+func setValidators(w http.ResponseWriter, etag string, lastModified time.Time) {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+}
+
+// checkNotModified sets the validators on the response and evaluates the
+// conditional request headers. If the client's cached copy is still fresh,
+// it writes a 304 Not Modified response and returns true.
+// If-None-Match takes precedence over If-Modified-Since as per RFC 9110.
+func checkNotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	setValidators(w, etag, lastModified)
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if etag == "" || !etagListMatches(inm, etag) {
+			return false
+		}
+		writeNotModified(w)
+		return true
+	}
+
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil {
+			return false
+		}
+		// HTTP dates only have second precision
+		if lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+		writeNotModified(w)
+		return true
+	}
+
+	return false
+}
+
+// etagListMatches reports whether the If-None-Match header value matches the
+// given entity tag using the weak comparison function
+func etagListMatches(header, etag string) bool {
+	for candidate := range strings.SplitSeq(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified writes a 304 response, dropping headers that describe a body
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	w.WriteHeader(http.StatusNotModified)
+}
@@ -0,0 +1,120 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckNotModified(t *testing.T) {
+	lastModified := time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC)
+	etag := `"abc123"`
+
+	tests := []struct {
+		name           string
+		method         string
+		headers        map[string]string
+		expectedStatus int
+		notModified    bool
+	}{
+		{
+			name:           "no conditional headers",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+		{
+			name:           "matching If-None-Match",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"abc123"`},
+			expectedStatus: http.StatusNotModified,
+			notModified:    true,
+		},
+		{
+			name:           "matching weak If-None-Match in list",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"other", W/"abc123"`},
+			expectedStatus: http.StatusNotModified,
+			notModified:    true,
+		},
+		{
+			name:           "wildcard If-None-Match",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": "*"},
+			expectedStatus: http.StatusNotModified,
+			notModified:    true,
+		},
+		{
+			name:           "non-matching If-None-Match",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-None-Match": `"stale"`},
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+		{
+			name:   "If-None-Match takes precedence over If-Modified-Since",
+			method: http.MethodGet,
+			headers: map[string]string{
+				"If-None-Match":     `"stale"`,
+				"If-Modified-Since": lastModified.Format(http.TimeFormat),
+			},
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+		{
+			name:           "If-Modified-Since equal to Last-Modified",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-Modified-Since": lastModified.Format(http.TimeFormat)},
+			expectedStatus: http.StatusNotModified,
+			notModified:    true,
+		},
+		{
+			name:           "If-Modified-Since before Last-Modified",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-Modified-Since": lastModified.Add(-time.Hour).Format(http.TimeFormat)},
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+		{
+			name:           "invalid If-Modified-Since",
+			method:         http.MethodGet,
+			headers:        map[string]string{"If-Modified-Since": "yesterday"},
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+		{
+			name:           "non-GET request is never not modified",
+			method:         http.MethodPost,
+			headers:        map[string]string{"If-None-Match": `"abc123"`},
+			expectedStatus: http.StatusOK,
+			notModified:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/test", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+
+			notModified := checkNotModified(rec, req, etag, lastModified)
+			if notModified != tt.notModified {
+				t.Errorf("Expected notModified=%v, got %v", tt.notModified, notModified)
+			}
+
+			resp := rec.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.Header.Get("ETag") != etag {
+				t.Errorf("Expected ETag %s, got %s", etag, resp.Header.Get("ETag"))
+			}
+			if resp.Header.Get("Last-Modified") != lastModified.Format(http.TimeFormat) {
+				t.Errorf("Expected Last-Modified %s, got %s", lastModified.Format(http.TimeFormat), resp.Header.Get("Last-Modified"))
+			}
+		})
+	}
+}
@@ -0,0 +1,555 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds the gateway configuration.
+// Values are resolved in the following order, later sources taking precedence:
+// defaults, the config file, environment variables and command-line flags.
+type Config struct {
+	// Port is the TCP port the HTTP server listens on
+	Port int `yaml:"port"`
+	// APIBaseURL is the base URL of the 511 API
+	APIBaseURL string `yaml:"api_base_url"`
+	// Operators are the 511 operator IDs to load lines and timetables for
+	Operators []string `yaml:"operators"`
+	// DataDir is a directory of lines, stops and timetables to serve instead of loading
+	// them from the 511 API. The proxy is disabled and no API keys are needed if set.
+	DataDir string `yaml:"data_dir"`
+	// APIKeys are the 511 API keys used by the key pool
+	APIKeys []string `yaml:"api_keys"`
+	// Secret is the shared secret clients must send in the X-API-SECRET or Authorization
+	// header, in plain text or hashed as "sha256:" followed by the hex-encoded hash
+	Secret string `yaml:"secret"`
+	// PreviousSecret is the secret replaced by Secret, still accepted while clients switch over
+	PreviousSecret string `yaml:"previous_secret"`
+	// PreviousSecretExpires is when PreviousSecret stops being accepted, never if zero
+	PreviousSecretExpires time.Time `yaml:"previous_secret_expires"`
+	// AdminSecret is the secret required for the /admin API, which is disabled if empty.
+	// Like any client it makes every other route require a key too, so setting it
+	// without Secret, clients or JWT leaves the proxy and timetable routes closed.
+	AdminSecret string `yaml:"admin_secret"`
+	// SignatureMaxSkew is how far the timestamp of a signed request may differ from the server's clock
+	SignatureMaxSkew time.Duration `yaml:"signature_max_skew"`
+	// JWT configures authentication with tokens of an identity provider
+	JWT JWTConfig `yaml:"jwt"`
+	// ClientsFile is a YAML file of named clients with their own keys, scopes and rate limits
+	ClientsFile string `yaml:"clients_file"`
+	// KeyRateLimit is the number of requests per second allowed per API key
+	KeyRateLimit float64 `yaml:"key_rate_limit"`
+	// KeyBurst is the burst size allowed per API key
+	KeyBurst int `yaml:"key_burst"`
+	// CacheTTL is how long successful proxy responses are cached
+	CacheTTL time.Duration `yaml:"cache_ttl"`
+	// CacheCleanupInterval is how often expired cache entries are purged
+	CacheCleanupInterval time.Duration `yaml:"cache_cleanup_interval"`
+	// LoaderDelay is the pause between 511 requests while loading timetables
+	LoaderDelay time.Duration `yaml:"loader_delay"`
+	// RefreshInterval is how often timetables are reloaded in the background, 0 disables reloading
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	// ReadTimeout is the maximum duration for reading a request including its headers
+	ReadTimeout time.Duration `yaml:"read_timeout"`
+	// WriteTimeout is the maximum duration for writing a response
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// IdleTimeout is how long keep-alive connections may stay idle
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	// ShutdownTimeout is how long in-flight requests may take to finish on shutdown
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// Proxy restricts which requests are forwarded to the 511 API
+	Proxy ProxyPolicy `yaml:"proxy"`
+	// CORS configures which browser origins may call the proxy and operator routes
+	CORS CORSPolicy `yaml:"cors"`
+	// Compression configures how responses are compressed
+	Compression CompressionPolicy `yaml:"compression"`
+	// LogFormat is the log output format, text or json
+	LogFormat string `yaml:"log_format"`
+	// LogLevel is the minimum level of logged records: debug, info, warn or error
+	LogLevel string `yaml:"log_level"`
+	// TracingExporter is where OpenTelemetry spans are sent: none, stdout or otlp
+	TracingExporter string `yaml:"tracing_exporter"`
+}
+
+// DefaultConfig returns the configuration used when nothing else is set
+func DefaultConfig() *Config {
+	return &Config{
+		Port:                 8080,
+		APIBaseURL:           defaultAPIBaseURL,
+		Operators:            []string{DefaultOperatorID},
+		KeyRateLimit:         1, // 1 request per second
+		KeyBurst:             5, // burst size of 5
+		CacheTTL:             2 * time.Minute,
+		CacheCleanupInterval: 10 * time.Minute,
+		LoaderDelay:          2 * time.Second,
+		RefreshInterval:      12 * time.Hour,
+		ReadTimeout:          15 * time.Second,
+		WriteTimeout:         60 * time.Second,
+		IdleTimeout:          120 * time.Second,
+		ShutdownTimeout:      20 * time.Second,
+		SignatureMaxSkew:     defaultSignatureMaxSkew,
+		JWT:                  JWTConfig{ScopesClaim: "scope"},
+		Proxy:                DefaultProxyPolicy(),
+		CORS:                 DefaultCORSPolicy(),
+		Compression:          DefaultCompressionPolicy(),
+		LogFormat:            "text",
+		LogLevel:             "info",
+		TracingExporter:      TracingExporterNone,
+	}
+}
+
+// Addr returns the listen address of the HTTP server
+func (c *Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+// Offline reports whether timetables are served from DataDir without the 511 API
+func (c *Config) Offline() bool {
+	return c.DataDir != ""
+}
+
+// LoadConfig builds the configuration from defaults, an optional config file,
+// environment variables and the given command-line arguments.
+// The config file is set with the -config flag or the CALTRAIN_GATEWAY_CONFIG
+// environment variable.
+func LoadConfig(args []string) (*Config, error) {
+	cfg, _, err := LoadConfigArgs(args)
+	return cfg, err
+}
+
+// LoadConfigArgs is like LoadConfig but also returns the arguments after the
+// flags, for commands that take positional arguments
+func LoadConfigArgs(args []string) (*Config, []string, error) {
+	cfg := DefaultConfig()
+
+	fs, flags := newConfigFlagSet()
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	configFile := os.Getenv("CALTRAIN_GATEWAY_CONFIG")
+	if flags.configFile != "" {
+		configFile = flags.configFile
+	}
+	if configFile != "" {
+		if err := cfg.loadFile(configFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return nil, nil, err
+	}
+	flags.apply(fs, cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, fs.Args(), nil
+}
+
+// loadFile merges the YAML config file into the configuration
+func (c *Config) loadFile(filename string) error {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// applyEnv overrides the configuration with the environment variables that are set
+func (c *Config) applyEnv() error {
+	var errs []error
+
+	if keys := LoadAPIKeysFromEnv(); len(keys) > 0 {
+		c.APIKeys = keys
+	}
+	if secret := LoadSecretFromEnv(); secret != "" {
+		c.Secret = secret
+	}
+	if secret := os.Getenv("CALTRAIN_GATEWAY_PREVIOUS_SECRET"); secret != "" {
+		c.PreviousSecret = secret
+	}
+	if v := os.Getenv("CALTRAIN_GATEWAY_PREVIOUS_SECRET_EXPIRES"); v != "" {
+		expires, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid CALTRAIN_GATEWAY_PREVIOUS_SECRET_EXPIRES %q: %w", v, err))
+		}
+		c.PreviousSecretExpires = expires
+	}
+	if secret := LoadAdminSecretFromEnv(); secret != "" {
+		c.AdminSecret = secret
+	}
+	if v := os.Getenv("PORT"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid PORT %q: %w", v, err))
+		}
+		c.Port = port
+	}
+	if v := os.Getenv("CALTRAIN_GATEWAY_CLIENTS_FILE"); v != "" {
+		c.ClientsFile = v
+	}
+	if v := os.Getenv("JWT_ISSUER"); v != "" {
+		c.JWT.Issuer = v
+	}
+	if v := os.Getenv("JWT_AUDIENCE"); v != "" {
+		c.JWT.Audience = v
+	}
+	if v := os.Getenv("JWT_JWKS"); v != "" {
+		c.JWT.JWKS = v
+	}
+	if v := os.Getenv("JWT_SCOPES_CLAIM"); v != "" {
+		c.JWT.ScopesClaim = v
+	}
+	if v := os.Getenv("FIVEONEONE_API_BASE_URL"); v != "" {
+		c.APIBaseURL = v
+	}
+	if v := splitList(os.Getenv("OPERATORS")); len(v) > 0 {
+		c.Operators = v
+	}
+	if v := os.Getenv("DATA_DIR"); v != "" {
+		c.DataDir = v
+	}
+	if v := os.Getenv("KEY_RATE_LIMIT"); v != "" {
+		limit, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid KEY_RATE_LIMIT %q: %w", v, err))
+		}
+		c.KeyRateLimit = limit
+	}
+	if v := os.Getenv("KEY_BURST"); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid KEY_BURST %q: %w", v, err))
+		}
+		c.KeyBurst = burst
+	}
+	for name, target := range map[string]*time.Duration{
+		"CACHE_TTL":              &c.CacheTTL,
+		"CACHE_CLEANUP_INTERVAL": &c.CacheCleanupInterval,
+		"LOADER_DELAY":           &c.LoaderDelay,
+		"REFRESH_INTERVAL":       &c.RefreshInterval,
+		"READ_TIMEOUT":           &c.ReadTimeout,
+		"WRITE_TIMEOUT":          &c.WriteTimeout,
+		"IDLE_TIMEOUT":           &c.IdleTimeout,
+		"SHUTDOWN_TIMEOUT":       &c.ShutdownTimeout,
+		"SIGNATURE_MAX_SKEW":     &c.SignatureMaxSkew,
+		"CORS_MAX_AGE":           &c.CORS.MaxAge,
+	} {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q: %w", name, v, err))
+			}
+			*target = d
+		}
+	}
+	if v := splitList(os.Getenv("PROXY_ALLOWED_PATHS")); len(v) > 0 {
+		c.Proxy.AllowedPaths = v
+	}
+	if v := splitList(os.Getenv("PROXY_ALLOWED_OPERATORS")); len(v) > 0 {
+		c.Proxy.AllowedOperators = v
+	}
+	if v := os.Getenv("PROXY_MAX_QUERY_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid PROXY_MAX_QUERY_LENGTH %q: %w", v, err))
+		}
+		c.Proxy.MaxQueryLength = n
+	}
+	if v := splitList(os.Getenv("CORS_ALLOWED_ORIGINS")); len(v) > 0 {
+		c.CORS.AllowedOrigins = v
+	}
+	if v := splitList(os.Getenv("CORS_ALLOWED_HEADERS")); len(v) > 0 {
+		c.CORS.AllowedHeaders = v
+	}
+	if v, ok := os.LookupEnv("COMPRESSION_ENCODINGS"); ok {
+		// An empty value disables compression
+		c.Compression.Encodings = splitList(v)
+	}
+	if v := os.Getenv("COMPRESSION_MIN_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid COMPRESSION_MIN_SIZE %q: %w", v, err))
+		}
+		c.Compression.MinSize = n
+	}
+	if v := splitList(os.Getenv("COMPRESSION_CONTENT_TYPES")); len(v) > 0 {
+		c.Compression.ContentTypes = v
+	}
+	if v := os.Getenv("LOG_FORMAT"); v != "" {
+		c.LogFormat = v
+	}
+	if v := os.Getenv("LOG_LEVEL"); v != "" {
+		c.LogLevel = v
+	}
+	if v := os.Getenv("TRACING_EXPORTER"); v != "" {
+		c.TracingExporter = v
+	}
+
+	return errors.Join(errs...)
+}
+
+// Validate checks the configuration for invalid values
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535, got %d", c.Port))
+	}
+	if u, err := url.Parse(c.APIBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs = append(errs, fmt.Errorf("api_base_url must be an absolute http(s) URL, got %q", c.APIBaseURL))
+	}
+	if len(c.Operators) == 0 {
+		errs = append(errs, errors.New("at least one operator must be configured"))
+	}
+	if c.Offline() {
+		if err := checkDataDir(c.DataDir); err != nil {
+			errs = append(errs, fmt.Errorf("data_dir: %w", err))
+		}
+	}
+	if c.KeyRateLimit <= 0 {
+		errs = append(errs, fmt.Errorf("key_rate_limit must be positive, got %g", c.KeyRateLimit))
+	}
+	if c.KeyBurst < 1 {
+		errs = append(errs, fmt.Errorf("key_burst must be at least 1, got %d", c.KeyBurst))
+	}
+	if c.CacheTTL <= 0 {
+		errs = append(errs, fmt.Errorf("cache_ttl must be positive, got %s", c.CacheTTL))
+	}
+	if c.CacheCleanupInterval <= 0 {
+		errs = append(errs, fmt.Errorf("cache_cleanup_interval must be positive, got %s", c.CacheCleanupInterval))
+	}
+	if c.LoaderDelay < 0 {
+		errs = append(errs, fmt.Errorf("loader_delay must not be negative, got %s", c.LoaderDelay))
+	}
+	if c.RefreshInterval < 0 {
+		errs = append(errs, fmt.Errorf("refresh_interval must not be negative, got %s", c.RefreshInterval))
+	}
+	for name, d := range map[string]time.Duration{
+		"read_timeout":       c.ReadTimeout,
+		"write_timeout":      c.WriteTimeout,
+		"idle_timeout":       c.IdleTimeout,
+		"shutdown_timeout":   c.ShutdownTimeout,
+		"signature_max_skew": c.SignatureMaxSkew,
+	} {
+		if d <= 0 {
+			errs = append(errs, fmt.Errorf("%s must be positive, got %s", name, d))
+		}
+	}
+	for name, secret := range map[string]string{
+		"secret":          c.Secret,
+		"previous_secret": c.PreviousSecret,
+		"admin_secret":    c.AdminSecret,
+	} {
+		if _, err := parseSecret(secret); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	if c.PreviousSecret != "" && c.Secret == "" {
+		errs = append(errs, errors.New("previous_secret requires secret to be set"))
+	}
+	errs = append(errs, c.JWT.validate()...)
+	if len(c.Proxy.AllowedPaths) == 0 {
+		errs = append(errs, errors.New("proxy.allowed_paths must not be empty"))
+	}
+	if len(c.Proxy.AllowedOperators) == 0 {
+		errs = append(errs, errors.New("proxy.allowed_operators must not be empty"))
+	}
+	if c.Proxy.MaxQueryLength < 0 {
+		errs = append(errs, fmt.Errorf("proxy.max_query_length must not be negative, got %d", c.Proxy.MaxQueryLength))
+	}
+	for _, origin := range c.CORS.AllowedOrigins {
+		if u, err := url.Parse(origin); origin != "*" && (err != nil || u.Scheme == "" || u.Host == "" || u.Path != "") {
+			errs = append(errs, fmt.Errorf("cors.allowed_origins must contain origins like https://example.com or *, got %q", origin))
+		}
+	}
+	errs = append(errs, c.Compression.validate()...)
+	if c.CORS.MaxAge < 0 {
+		errs = append(errs, fmt.Errorf("cors.max_age must not be negative, got %s", c.CORS.MaxAge))
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log_format must be text or json, got %q", c.LogFormat))
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("log_level must be debug, info, warn or error, got %q", c.LogLevel))
+	}
+	switch c.TracingExporter {
+	case TracingExporterNone, TracingExporterStdout, TracingExporterOTLP:
+	default:
+		errs = append(errs, fmt.Errorf("tracing_exporter must be none, stdout or otlp, got %q", c.TracingExporter))
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+	return nil
+}
+
+// configFlags holds the values of the command-line flags
+type configFlags struct {
+	configFile           string
+	clientsFile          string
+	jwtIssuer            string
+	jwtAudience          string
+	jwtJWKS              string
+	port                 int
+	apiBaseURL           string
+	operators            string
+	dataDir              string
+	keyRateLimit         float64
+	keyBurst             int
+	cacheTTL             time.Duration
+	cacheCleanupInterval time.Duration
+	loaderDelay          time.Duration
+	refreshInterval      time.Duration
+	readTimeout          time.Duration
+	writeTimeout         time.Duration
+	idleTimeout          time.Duration
+	shutdownTimeout      time.Duration
+	signatureMaxSkew     time.Duration
+	proxyPaths           string
+	proxyOperators       string
+	proxyMaxQueryLength  int
+	corsOrigins          string
+	corsHeaders          string
+	corsMaxAge           time.Duration
+	compressEncodings    string
+	compressMinSize      int
+	compressContentTypes string
+	logFormat            string
+	logLevel             string
+	tracingExporter      string
+}
+
+// newConfigFlagSet defines the command-line flags.
+// Secrets and API keys are deliberately not available as flags so they do not
+// show up in process listings.
+func newConfigFlagSet() (*flag.FlagSet, *configFlags) {
+	defaults := DefaultConfig()
+	f := &configFlags{}
+	fs := flag.NewFlagSet("caltrain-gateway", flag.ContinueOnError)
+	fs.StringVar(&f.configFile, "config", "", "path to a YAML config file")
+	fs.StringVar(&f.clientsFile, "clients-file", "", "path to a YAML file of clients with keys, scopes and rate limits")
+	fs.StringVar(&f.jwtIssuer, "jwt-issuer", "", "issuer of accepted JWTs")
+	fs.StringVar(&f.jwtAudience, "jwt-audience", "", "audience of accepted JWTs")
+	fs.StringVar(&f.jwtJWKS, "jwt-jwks", "", "file or URL of the JWT issuer's public keys, enables JWT authentication")
+	fs.IntVar(&f.port, "port", defaults.Port, "HTTP server port")
+	fs.StringVar(&f.apiBaseURL, "api-base-url", defaults.APIBaseURL, "base URL of the 511 API")
+	fs.StringVar(&f.operators, "operators", DefaultOperatorID, "comma-separated 511 operator IDs")
+	fs.StringVar(&f.dataDir, "data-dir", "", "directory of lines and timetables to serve offline, disables the proxy")
+	fs.Float64Var(&f.keyRateLimit, "key-rate-limit", defaults.KeyRateLimit, "requests per second per API key")
+	fs.IntVar(&f.keyBurst, "key-burst", defaults.KeyBurst, "burst size per API key")
+	fs.DurationVar(&f.cacheTTL, "cache-ttl", defaults.CacheTTL, "TTL of cached proxy responses")
+	fs.DurationVar(&f.cacheCleanupInterval, "cache-cleanup-interval", defaults.CacheCleanupInterval, "interval for purging expired cache entries")
+	fs.DurationVar(&f.loaderDelay, "loader-delay", defaults.LoaderDelay, "pause between 511 requests while loading timetables")
+	fs.DurationVar(&f.refreshInterval, "refresh-interval", defaults.RefreshInterval, "interval for reloading timetables, 0 disables reloading")
+	fs.DurationVar(&f.readTimeout, "read-timeout", defaults.ReadTimeout, "maximum duration for reading a request")
+	fs.DurationVar(&f.writeTimeout, "write-timeout", defaults.WriteTimeout, "maximum duration for writing a response")
+	fs.DurationVar(&f.idleTimeout, "idle-timeout", defaults.IdleTimeout, "maximum idle time of keep-alive connections")
+	fs.DurationVar(&f.shutdownTimeout, "shutdown-timeout", defaults.ShutdownTimeout, "time allowed for in-flight requests on shutdown")
+	fs.DurationVar(&f.signatureMaxSkew, "signature-max-skew", defaults.SignatureMaxSkew, "maximum clock skew of signed requests")
+	fs.StringVar(&f.proxyPaths, "proxy-allowed-paths", "", "comma-separated 511 endpoints the proxy forwards")
+	fs.StringVar(&f.proxyOperators, "proxy-allowed-operators", "", "comma-separated operator IDs the proxy accepts")
+	fs.IntVar(&f.proxyMaxQueryLength, "proxy-max-query-length", defaults.Proxy.MaxQueryLength, "maximum length of a proxied query string")
+	fs.StringVar(&f.corsOrigins, "cors-allowed-origins", "", "comma-separated browser origins allowed to call the gateway, * for all")
+	fs.StringVar(&f.corsHeaders, "cors-allowed-headers", "", "comma-separated request headers allowed in cross-origin requests")
+	fs.DurationVar(&f.corsMaxAge, "cors-max-age", defaults.CORS.MaxAge, "how long browsers may cache preflight results")
+	fs.StringVar(&f.compressEncodings, "compression-encodings", strings.Join(defaults.Compression.Encodings, ","), "comma-separated response encodings in order of preference, empty disables compression")
+	fs.IntVar(&f.compressMinSize, "compression-min-size", defaults.Compression.MinSize, "minimum response size in bytes to compress")
+	fs.StringVar(&f.compressContentTypes, "compression-content-types", "", "comma-separated media types to compress, entries ending in / match all subtypes")
+	fs.StringVar(&f.logFormat, "log-format", defaults.LogFormat, "log output format, text or json")
+	fs.StringVar(&f.logLevel, "log-level", defaults.LogLevel, "minimum log level: debug, info, warn or error")
+	fs.StringVar(&f.tracingExporter, "tracing-exporter", defaults.TracingExporter, "OpenTelemetry span exporter: none, stdout or otlp")
+	return fs, f
+}
+
+// apply overrides the configuration with the flags that were set explicitly
+func (f *configFlags) apply(fs *flag.FlagSet, c *Config) {
+	fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "clients-file":
+			c.ClientsFile = f.clientsFile
+		case "jwt-issuer":
+			c.JWT.Issuer = f.jwtIssuer
+		case "jwt-audience":
+			c.JWT.Audience = f.jwtAudience
+		case "jwt-jwks":
+			c.JWT.JWKS = f.jwtJWKS
+		case "port":
+			c.Port = f.port
+		case "api-base-url":
+			c.APIBaseURL = f.apiBaseURL
+		case "operators":
+			c.Operators = splitList(f.operators)
+		case "data-dir":
+			c.DataDir = f.dataDir
+		case "key-rate-limit":
+			c.KeyRateLimit = f.keyRateLimit
+		case "key-burst":
+			c.KeyBurst = f.keyBurst
+		case "cache-ttl":
+			c.CacheTTL = f.cacheTTL
+		case "cache-cleanup-interval":
+			c.CacheCleanupInterval = f.cacheCleanupInterval
+		case "loader-delay":
+			c.LoaderDelay = f.loaderDelay
+		case "refresh-interval":
+			c.RefreshInterval = f.refreshInterval
+		case "read-timeout":
+			c.ReadTimeout = f.readTimeout
+		case "write-timeout":
+			c.WriteTimeout = f.writeTimeout
+		case "idle-timeout":
+			c.IdleTimeout = f.idleTimeout
+		case "shutdown-timeout":
+			c.ShutdownTimeout = f.shutdownTimeout
+		case "signature-max-skew":
+			c.SignatureMaxSkew = f.signatureMaxSkew
+		case "proxy-allowed-paths":
+			c.Proxy.AllowedPaths = splitList(f.proxyPaths)
+		case "proxy-allowed-operators":
+			c.Proxy.AllowedOperators = splitList(f.proxyOperators)
+		case "proxy-max-query-length":
+			c.Proxy.MaxQueryLength = f.proxyMaxQueryLength
+		case "cors-allowed-origins":
+			c.CORS.AllowedOrigins = splitList(f.corsOrigins)
+		case "cors-allowed-headers":
+			c.CORS.AllowedHeaders = splitList(f.corsHeaders)
+		case "cors-max-age":
+			c.CORS.MaxAge = f.corsMaxAge
+		case "compression-encodings":
+			c.Compression.Encodings = splitList(f.compressEncodings)
+		case "compression-min-size":
+			c.Compression.MinSize = f.compressMinSize
+		case "compression-content-types":
+			c.Compression.ContentTypes = splitList(f.compressContentTypes)
+		case "log-format":
+			c.LogFormat = f.logFormat
+		case "log-level":
+			c.LogLevel = f.logLevel
+		case "tracing-exporter":
+			c.TracingExporter = f.tracingExporter
+		}
+	})
+}
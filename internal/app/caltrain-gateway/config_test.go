@@ -0,0 +1,293 @@
+package caltraingateway
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// clearConfigEnv unsets all environment variables read by LoadConfig for the duration of the test
+func clearConfigEnv(t *testing.T) {
+	t.Helper()
+	names := []string{
+		"CALTRAIN_GATEWAY_CONFIG", "CALTRAIN_GATEWAY_SECRET", "CALTRAIN_GATEWAY_PREVIOUS_SECRET", "CALTRAIN_GATEWAY_PREVIOUS_SECRET_EXPIRES", "CALTRAIN_GATEWAY_ADMIN_SECRET", "CALTRAIN_GATEWAY_CLIENTS_FILE", "JWT_ISSUER", "JWT_AUDIENCE", "JWT_JWKS", "JWT_SCOPES_CLAIM", "PORT", "FIVEONEONE_API_BASE_URL",
+		"OPERATORS", "DATA_DIR", "KEY_RATE_LIMIT", "KEY_BURST", "CACHE_TTL", "CACHE_CLEANUP_INTERVAL",
+		"LOADER_DELAY", "REFRESH_INTERVAL", "READ_TIMEOUT", "WRITE_TIMEOUT", "IDLE_TIMEOUT",
+		"SHUTDOWN_TIMEOUT", "SIGNATURE_MAX_SKEW", "PROXY_ALLOWED_PATHS", "PROXY_ALLOWED_OPERATORS", "PROXY_MAX_QUERY_LENGTH", "CORS_ALLOWED_ORIGINS", "CORS_ALLOWED_HEADERS", "CORS_MAX_AGE", "COMPRESSION_ENCODINGS", "COMPRESSION_MIN_SIZE", "COMPRESSION_CONTENT_TYPES",
+		"LOG_FORMAT", "LOG_LEVEL", "TRACING_EXPORTER",
+	}
+	for i := 1; i <= 10; i++ {
+		names = append(names, "FIVEONEONE_API_KEY_"+strconv.Itoa(i))
+	}
+	for _, name := range names {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+// writeConfigFile writes a YAML config file to a temporary directory and returns its path
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filename, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+	return filename
+}
+
+func TestLoadConfig_Defaults(t *testing.T) {
+	clearConfigEnv(t)
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		t.Fatalf("LoadConfig() error: %v", err)
+	}
+
+	if cfg.Addr() != ":8080" {
+		t.Errorf("Expected address ':8080', got '%s'", cfg.Addr())
+	}
+	if cfg.APIBaseURL != "http://api.511.org/" {
+		t.Errorf("Expected default API base URL, got '%s'", cfg.APIBaseURL)
+	}
+	if len(cfg.Operators) != 1 || cfg.Operators[0] != "CT" {
+		t.Errorf("Expected operators [CT], got %v", cfg.Operators)
+	}
+	if cfg.KeyRateLimit != 1 || cfg.KeyBurst != 5 {
+		t.Errorf("Expected rate limit 1/5, got %g/%d", cfg.KeyRateLimit, cfg.KeyBurst)
+	}
+	if cfg.CacheTTL != 2*time.Minute || cfg.LoaderDelay != 2*time.Second {
+		t.Errorf("Unexpected durations: cache TTL %s, loader delay %s", cfg.CacheTTL, cfg.LoaderDelay)
+	}
+	if cfg.Offline() {
+		t.Error("Expected the gateway not to be offline by default")
+	}
+}
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	clearConfigEnv(t)
+
+	configFile := writeConfigFile(t, `
+port: 9000
+operators: [CT, BA]
+secret: file-secret
+api_keys: [file-key]
+key_burst: 10
+cache_ttl: 5m
+proxy:
+  allowed_paths: [transit/StopMonitoring]
+`)
+
+	t.Run("file overrides defaults", func(t *testing.T) {
+		cfg, err := LoadConfig([]string{"-config", configFile})
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if cfg.Port != 9000 {
+			t.Errorf("Expected port 9000, got %d", cfg.Port)
+		}
+		if len(cfg.Operators) != 2 || cfg.Operators[1] != "BA" {
+			t.Errorf("Expected operators [CT BA], got %v", cfg.Operators)
+		}
+		if cfg.Secret != "file-secret" || len(cfg.APIKeys) != 1 {
+			t.Errorf("Expected secret and API key from file, got %q and %v", cfg.Secret, cfg.APIKeys)
+		}
+		if cfg.CacheTTL != 5*time.Minute {
+			t.Errorf("Expected cache TTL 5m, got %s", cfg.CacheTTL)
+		}
+		if len(cfg.Proxy.AllowedPaths) != 1 {
+			t.Errorf("Expected 1 allowed path, got %v", cfg.Proxy.AllowedPaths)
+		}
+		// Unset nested values keep their defaults
+		if cfg.Proxy.MaxQueryLength != defaultMaxQueryLength {
+			t.Errorf("Expected default max query length, got %d", cfg.Proxy.MaxQueryLength)
+		}
+	})
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("CALTRAIN_GATEWAY_CONFIG", configFile)
+		t.Setenv("PORT", "9100")
+		t.Setenv("CALTRAIN_GATEWAY_SECRET", "env-secret")
+		t.Setenv("FIVEONEONE_API_KEY_1", "env-key-1")
+		t.Setenv("FIVEONEONE_API_KEY_2", "env-key-2")
+		t.Setenv("CACHE_TTL", "30s")
+		dataDir := t.TempDir()
+		t.Setenv("DATA_DIR", dataDir)
+
+		cfg, err := LoadConfig(nil)
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if cfg.Port != 9100 {
+			t.Errorf("Expected port 9100, got %d", cfg.Port)
+		}
+		if cfg.Secret != "env-secret" {
+			t.Errorf("Expected secret from env, got %q", cfg.Secret)
+		}
+		if len(cfg.APIKeys) != 2 {
+			t.Errorf("Expected 2 API keys from env, got %v", cfg.APIKeys)
+		}
+		if cfg.CacheTTL != 30*time.Second {
+			t.Errorf("Expected cache TTL 30s, got %s", cfg.CacheTTL)
+		}
+		if cfg.KeyBurst != 10 {
+			t.Errorf("Expected key burst 10 from file, got %d", cfg.KeyBurst)
+		}
+		if cfg.DataDir != dataDir || !cfg.Offline() {
+			t.Errorf("Expected to serve offline from %s, got data dir %q", dataDir, cfg.DataDir)
+		}
+	})
+
+	t.Run("flags override env", func(t *testing.T) {
+		t.Setenv("PORT", "9100")
+		t.Setenv("OPERATORS", "SM")
+
+		cfg, err := LoadConfig([]string{"-config", configFile, "-port", "9200", "-operators", "CT,SC", "-cache-ttl", "1m"})
+		if err != nil {
+			t.Fatalf("LoadConfig() error: %v", err)
+		}
+		if cfg.Port != 9200 {
+			t.Errorf("Expected port 9200, got %d", cfg.Port)
+		}
+		if len(cfg.Operators) != 2 || cfg.Operators[1] != "SC" {
+			t.Errorf("Expected operators [CT SC], got %v", cfg.Operators)
+		}
+		if cfg.CacheTTL != time.Minute {
+			t.Errorf("Expected cache TTL 1m, got %s", cfg.CacheTTL)
+		}
+	})
+}
+
+func TestLoadConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		env      map[string]string
+		file     string
+		contains string
+	}{
+		{
+			name:     "unknown flag",
+			args:     []string{"-bogus"},
+			contains: "bogus",
+		},
+		{
+			name:     "missing config file",
+			args:     []string{"-config", "nonexistent.yaml"},
+			contains: "failed to read config file",
+		},
+		{
+			name:     "unknown field in config file",
+			file:     "prot: 8080\n",
+			contains: "field prot not found",
+		},
+		{
+			name:     "invalid env value",
+			env:      map[string]string{"KEY_BURST": "many"},
+			contains: "invalid KEY_BURST",
+		},
+		{
+			name:     "invalid port",
+			args:     []string{"-port", "70000"},
+			contains: "port must be between 1 and 65535",
+		},
+		{
+			name:     "invalid base URL",
+			args:     []string{"-api-base-url", "api.511.org"},
+			contains: "api_base_url must be an absolute http(s) URL",
+		},
+		{
+			name:     "non-positive rate limit",
+			env:      map[string]string{"KEY_RATE_LIMIT": "0"},
+			contains: "key_rate_limit must be positive",
+		},
+		{
+			name:     "zero shutdown timeout",
+			env:      map[string]string{"SHUTDOWN_TIMEOUT": "0s"},
+			contains: "shutdown_timeout must be positive",
+		},
+		{
+			name:     "negative loader delay",
+			args:     []string{"-loader-delay", "-1s"},
+			contains: "loader_delay must not be negative",
+		},
+		{
+			name:     "missing data directory",
+			args:     []string{"-data-dir", "nonexistent"},
+			contains: "data_dir: stat nonexistent",
+		},
+		{
+			name:     "invalid log format",
+			env:      map[string]string{"LOG_FORMAT": "xml"},
+			contains: "log_format must be text or json",
+		},
+		{
+			name:     "invalid log level",
+			args:     []string{"-log-level", "verbose"},
+			contains: "log_level must be debug, info, warn or error",
+		},
+		{
+			name:     "invalid tracing exporter",
+			env:      map[string]string{"TRACING_EXPORTER": "jaeger"},
+			contains: "tracing_exporter must be none, stdout or otlp",
+		},
+		{
+			name:     "JWKS without issuer",
+			args:     []string{"-jwt-jwks", "jwks.json"},
+			contains: "jwt.issuer is required when jwt.jwks is set",
+		},
+		{
+			name:     "JWT scope mapped to unknown scope",
+			file:     "jwt:\n  issuer: https://id.example.com\n  jwks: jwks.json\n  scopes:\n    caltrain.read: [everything]\n",
+			contains: `jwt.scopes maps "caltrain.read" to unknown scope "everything"`,
+		},
+		{
+			name:     "CORS origin with path",
+			env:      map[string]string{"CORS_ALLOWED_ORIGINS": "https://dashboard.example.com/app"},
+			contains: `cors.allowed_origins must contain origins like https://example.com or *, got "https://dashboard.example.com/app"`,
+		},
+		{
+			name:     "unknown compression encoding",
+			args:     []string{"-compression-encodings", "gzip,lzma"},
+			contains: `compression.encodings must only contain zstd, br, gzip, deflate, got "lzma"`,
+		},
+		{
+			name:     "invalid secret hash",
+			env:      map[string]string{"CALTRAIN_GATEWAY_SECRET": "sha256:abc"},
+			contains: "secret: invalid SHA-256 hash",
+		},
+		{
+			name:     "previous secret without secret",
+			file:     "previous_secret: old\n",
+			contains: "previous_secret requires secret to be set",
+		},
+		{
+			name:     "invalid previous secret expiry",
+			env:      map[string]string{"CALTRAIN_GATEWAY_PREVIOUS_SECRET_EXPIRES": "tomorrow"},
+			contains: "invalid CALTRAIN_GATEWAY_PREVIOUS_SECRET_EXPIRES",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append(args, "-config", writeConfigFile(t, tt.file))
+			}
+
+			_, err := LoadConfig(args)
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
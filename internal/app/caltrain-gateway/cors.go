@@ -0,0 +1,111 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsAllowedMethods are the methods browsers may use for cross-origin requests
+var corsAllowedMethods = []string{http.MethodGet, http.MethodHead}
+
+// corsExposedHeaders are the response headers scripts of other origins may read
+var corsExposedHeaders = []string{"ETag", "Last-Modified", "Retry-After", requestIDHeader, "X-Cache", "X-Collapsed", "Deprecation", "Link"}
+
+// CORSPolicy configures which browser origins may call the proxy and operator routes
+type CORSPolicy struct {
+	// AllowedOrigins are the origins allowed to make requests, e.g. "https://dashboard.example.com".
+	// "*" allows every origin. CORS is disabled if empty.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// AllowedHeaders are the request headers browsers may send
+	AllowedHeaders []string `yaml:"allowed_headers"`
+	// MaxAge is how long browsers may cache the result of a preflight request
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// DefaultCORSPolicy returns the policy used when nothing else is configured.
+// No origin is allowed, the headers cover authentication and conditional requests.
+func DefaultCORSPolicy() CORSPolicy {
+	return CORSPolicy{
+		AllowedHeaders: []string{"Authorization", "X-API-SECRET", "If-None-Match", "If-Modified-Since", requestIDHeader},
+		MaxAge:         10 * time.Minute,
+	}
+}
+
+// Enabled reports whether any origin is allowed
+func (p CORSPolicy) Enabled() bool {
+	return len(p.AllowedOrigins) > 0
+}
+
+// allowedOrigin returns the value of the Access-Control-Allow-Origin header for
+// the origin, or false if the origin is not allowed
+func (p CORSPolicy) allowedOrigin(origin string) (string, bool) {
+	if slices.Contains(p.AllowedOrigins, "*") {
+		return "*", true
+	}
+	if slices.ContainsFunc(p.AllowedOrigins, func(allowed string) bool {
+		return strings.EqualFold(allowed, origin)
+	}) {
+		return origin, true
+	}
+	return "", false
+}
+
+// isPreflight reports whether the request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// corsMiddleware sets the CORS headers for requests from allowed origins and
+// answers their preflight requests itself, so they never reach authentication.
+// Requests from other origins are passed on without CORS headers, which makes
+// browsers block the response.
+func corsMiddleware(policy CORSPolicy, next http.HandlerFunc) http.HandlerFunc {
+	if !policy.Enabled() {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		// The response depends on the origin, so caches must not share it between
+		// origins, nor between requests with and without one
+		w.Header().Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next(w, r)
+			return
+		}
+
+		allowOrigin, ok := policy.allowedOrigin(origin)
+		if !ok {
+			next(w, r)
+			return
+		}
+
+		if isPreflight(r) {
+			if !slices.Contains(corsAllowedMethods, r.Header.Get("Access-Control-Request-Method")) {
+				next(w, r)
+				return
+			}
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(corsAllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		w.Header().Set("Access-Control-Expose-Headers", strings.Join(corsExposedHeaders, ", "))
+		next(w, r)
+	}
+}
+
+// methodNotAllowedHandler rejects requests other than GET and HEAD, e.g. OPTIONS
+// requests to operator routes that are not CORS preflight requests
+func methodNotAllowedHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Allow", strings.Join(corsAllowedMethods, ", "))
+	writeError(w, r, newAPIError(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed"))
+}
@@ -0,0 +1,130 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	policy := DefaultCORSPolicy()
+	policy.AllowedOrigins = []string{"https://dashboard.example.com"}
+	handler := corsMiddleware(policy, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	tests := []struct {
+		name              string
+		method            string
+		origin            string
+		requestMethod     string
+		expectedStatus    int
+		expectedAllow     string
+		expectedMaxAge    string
+		expectedExposeSet bool
+	}{
+		{name: "same-origin request", method: "GET", expectedStatus: http.StatusOK},
+		{name: "allowed origin", method: "GET", origin: "https://dashboard.example.com", expectedStatus: http.StatusOK, expectedAllow: "https://dashboard.example.com", expectedExposeSet: true},
+		{name: "disallowed origin", method: "GET", origin: "https://evil.example.com", expectedStatus: http.StatusOK},
+		{name: "preflight", method: "OPTIONS", origin: "https://dashboard.example.com", requestMethod: "GET", expectedStatus: http.StatusNoContent, expectedAllow: "https://dashboard.example.com", expectedMaxAge: "600"},
+		{name: "preflight for disallowed method", method: "OPTIONS", origin: "https://dashboard.example.com", requestMethod: "DELETE", expectedStatus: http.StatusOK},
+		{name: "preflight from disallowed origin", method: "OPTIONS", origin: "https://evil.example.com", requestMethod: "GET", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/caltrain/timetable", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.expectedAllow {
+				t.Errorf("Expected Access-Control-Allow-Origin '%s', got '%s'", tt.expectedAllow, got)
+			}
+			if got := rec.Header().Get("Access-Control-Max-Age"); got != tt.expectedMaxAge {
+				t.Errorf("Expected Access-Control-Max-Age '%s', got '%s'", tt.expectedMaxAge, got)
+			}
+			if got := rec.Header().Get("Access-Control-Expose-Headers") != ""; got != tt.expectedExposeSet {
+				t.Errorf("Expected Access-Control-Expose-Headers set to be %v, got %v", tt.expectedExposeSet, got)
+			}
+			if rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("Expected Vary 'Origin', got '%s'", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
+
+func TestCORSMiddleware_AnyOrigin(t *testing.T) {
+	handler := corsMiddleware(CORSPolicy{AllowedOrigins: []string{"*"}}, func(w http.ResponseWriter, r *http.Request) {})
+
+	req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+	req.Header.Set("Origin", "https://anywhere.example.com")
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Expected Access-Control-Allow-Origin '*', got '%s'", got)
+	}
+}
+
+func TestNewHandler_CORS(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Secret = "secret"
+	cfg.CORS.AllowedOrigins = []string{"https://dashboard.example.com"}
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		preflight      bool
+		secret         string
+		expectedStatus int
+		expectCORS     bool
+	}{
+		{name: "timetable preflight without secret", method: "OPTIONS", url: "/caltrain/timetable", preflight: true, expectedStatus: http.StatusNoContent, expectCORS: true},
+		{name: "train preflight without secret", method: "OPTIONS", url: "/caltrain/trains/101", preflight: true, expectedStatus: http.StatusNoContent, expectCORS: true},
+		{name: "proxy preflight without secret", method: "OPTIONS", url: "/transit/stops?agency=CT", preflight: true, expectedStatus: http.StatusNoContent, expectCORS: true},
+		{name: "timetable request with secret", method: "GET", url: "/caltrain/timetable", secret: "secret", expectedStatus: http.StatusOK, expectCORS: true},
+		{name: "timetable request without secret", method: "GET", url: "/caltrain/timetable", expectedStatus: http.StatusUnauthorized, expectCORS: true},
+		{name: "OPTIONS without preflight", method: "OPTIONS", url: "/caltrain/timetable", expectedStatus: http.StatusMethodNotAllowed, expectCORS: true},
+		{name: "health check is not cross-origin", method: "GET", url: "/up", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			req.Header.Set("Origin", "https://dashboard.example.com")
+			if tt.preflight {
+				req.Header.Set("Access-Control-Request-Method", "GET")
+				req.Header.Set("Access-Control-Request-Headers", "x-api-secret")
+			}
+			if tt.secret != "" {
+				req.Header.Set("X-API-SECRET", tt.secret)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin") != ""; got != tt.expectCORS {
+				t.Errorf("Expected CORS headers to be %v, got %v", tt.expectCORS, got)
+			}
+		})
+	}
+}
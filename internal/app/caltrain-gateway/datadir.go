@@ -0,0 +1,159 @@
+package caltraingateway
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A data directory holds the 511 responses of each operator in a subdirectory
+// named after its ID, so the gateway can serve them without the 511 API:
+//
+//	CT/lines.json
+//	CT/stops.json              (optional)
+//	CT/timetables/Limited.json (one per line)
+const (
+	linesFileName     = "lines.json"
+	stopsFileName     = "stops.json"
+	timetablesDirName = "timetables"
+)
+
+// timetableFileName returns the name of the timetable file of a line,
+// with path separators in the line ID replaced
+func timetableFileName(lineID string) string {
+	return strings.NewReplacer("/", "_", `\`, "_").Replace(lineID) + ".json"
+}
+
+// OperatorDir returns the directory of an operator within a data directory
+func OperatorDir(dataDir string, operatorID string) string {
+	return filepath.Join(dataDir, operatorID)
+}
+
+// LoadDatasetDir loads the lines, stops and timetables of an operator directory.
+// Like loads from the API, missing stops and broken timetables are skipped with a warning.
+func LoadDatasetDir(dir string) (*Dataset, error) {
+	lines, err := LoadLinesFromFile(filepath.Join(dir, linesFileName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lines: %w", err)
+	}
+	log.Printf("Loaded %d lines from %s", len(lines), dir)
+
+	stops, err := LoadStopsFromFile(filepath.Join(dir, stopsFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Warning: Failed to load stops from %s: %v", dir, err)
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(dir, timetablesDirName, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list timetables: %w", err)
+	}
+	tc := NewTimetableCollection()
+	for _, filename := range filenames {
+		tt, err := LoadTimetable(filename)
+		if err != nil {
+			log.Printf("Warning: Failed to load timetable %s: %v", filename, err)
+			continue
+		}
+		tc.AddTimetable(tt)
+	}
+	log.Printf("Loaded %d timetables from %s", tc.Len(), dir)
+
+	return &Dataset{Lines: lines, Stops: stops, Timetables: tc}, nil
+}
+
+// checkDataDir returns an error if the data directory does not exist
+func checkDataDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+	return nil
+}
+
+// DatasetSummary describes the size and coverage of a dataset
+type DatasetSummary struct {
+	Lines              int             `json:"lines"`
+	LinesWithTimetable int             `json:"linesWithTimetable"`
+	Stops              int             `json:"stops"`
+	StopsServed        int             `json:"stopsServed"` // stops called at by any train
+	Timetables         int             `json:"timetables"`
+	Routes             int             `json:"routes"`
+	Trains             int             `json:"trains"`
+	TrainsByWeekday    map[Weekday]int `json:"trainsByWeekday"`
+	Calls              int             `json:"calls"`               // stops of all trains
+	ValidFrom          string          `json:"validFrom,omitempty"` // first date any timetable is valid on
+	ValidTo            string          `json:"validTo,omitempty"`   // last date any timetable is valid on
+	Version            string          `json:"version"`             // dataset version reported by /status
+}
+
+// SummarizeDataset counts the lines, stops, routes and trains of a dataset
+func SummarizeDataset(d *Dataset) (DatasetSummary, error) {
+	version, err := datasetVersion(d)
+	if err != nil {
+		return DatasetSummary{}, err
+	}
+	summary := DatasetSummary{
+		Lines:           len(d.Lines),
+		Stops:           len(d.Stops),
+		Timetables:      d.Timetables.Len(),
+		TrainsByWeekday: make(map[Weekday]int, len(Weekdays)),
+		Version:         version,
+	}
+	for _, line := range d.Lines {
+		if d.Timetables.HasLine(line.ID) {
+			summary.LinesWithTimetable++
+		}
+	}
+
+	routes := make(map[string]bool)
+	trains := make(map[string]bool)
+	trainDays := make(map[Weekday]map[string]bool)
+	stops := make(map[string]bool)
+	for _, tt := range d.Timetables.timetables {
+		for _, route := range tt.Content.ServiceFrame.Routes.Route {
+			routes[route.ID] = true
+		}
+		for _, frame := range tt.Content.TimetableFrame {
+			for _, journey := range frame.VehicleJourneys.ServiceJourney {
+				if !trains[journey.ID] {
+					trains[journey.ID] = true
+					summary.Calls += len(journey.Calls.Call)
+					for _, call := range journey.Calls.Call {
+						stops[call.ScheduledStopPointRef.Ref] = true
+					}
+				}
+				for _, weekday := range Weekdays {
+					if !tt.isValidForWeekday(frame, weekday) {
+						continue
+					}
+					if trainDays[weekday] == nil {
+						trainDays[weekday] = make(map[string]bool)
+					}
+					trainDays[weekday][journey.ID] = true
+				}
+			}
+		}
+
+		from, to := tt.validity()
+		if from != "" && (summary.ValidFrom == "" || from < summary.ValidFrom) {
+			summary.ValidFrom = from
+		}
+		if to > summary.ValidTo {
+			summary.ValidTo = to
+		}
+	}
+	summary.Routes = len(routes)
+	summary.Trains = len(trains)
+	summary.StopsServed = len(stops)
+	for _, weekday := range Weekdays {
+		summary.TrainsByWeekday[weekday] = len(trainDays[weekday])
+	}
+	return summary, nil
+}
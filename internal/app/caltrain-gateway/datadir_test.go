@@ -0,0 +1,131 @@
+package caltraingateway
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newExampleDataDir writes the example lines, stops and timetable to a data
+// directory for the CT operator and returns the data directory
+func newExampleDataDir(t *testing.T) string {
+	t.Helper()
+
+	dataDir := t.TempDir()
+	dir := OperatorDir(dataDir, "CT")
+	if err := os.MkdirAll(filepath.Join(dir, timetablesDirName), 0o755); err != nil {
+		t.Fatalf("failed to create data directory: %v", err)
+	}
+	for src, dst := range map[string]string{
+		"example_lines.json":     linesFileName,
+		"example_stops.json":     stopsFileName,
+		"example_timetable.json": filepath.Join(timetablesDirName, "Limited.json"),
+	} {
+		data, err := os.ReadFile(src)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", src, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, dst), data, 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", dst, err)
+		}
+	}
+	return dataDir
+}
+
+func TestLoadDatasetDir(t *testing.T) {
+	dataDir := newExampleDataDir(t)
+	dir := OperatorDir(dataDir, "CT")
+
+	t.Run("complete", func(t *testing.T) {
+		data, err := LoadDatasetDir(dir)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(data.Lines) != 5 {
+			t.Errorf("Expected 5 lines, got %d", len(data.Lines))
+		}
+		if len(data.Stops) != 32 {
+			t.Errorf("Expected 32 stops, got %d", len(data.Stops))
+		}
+		if data.Timetables.Len() != 1 {
+			t.Errorf("Expected 1 timetable, got %d", data.Timetables.Len())
+		}
+	})
+
+	t.Run("broken timetable and missing stops are skipped", func(t *testing.T) {
+		if err := os.WriteFile(filepath.Join(dir, timetablesDirName, "Local.json"), []byte("{"), 0o644); err != nil {
+			t.Fatalf("failed to write timetable: %v", err)
+		}
+		if err := os.Remove(filepath.Join(dir, stopsFileName)); err != nil {
+			t.Fatalf("failed to remove stops: %v", err)
+		}
+
+		data, err := LoadDatasetDir(dir)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if len(data.Stops) != 0 {
+			t.Errorf("Expected no stops, got %d", len(data.Stops))
+		}
+		if data.Timetables.Len() != 1 {
+			t.Errorf("Expected 1 timetable, got %d", data.Timetables.Len())
+		}
+	})
+
+	t.Run("missing lines", func(t *testing.T) {
+		if _, err := LoadDatasetDir(OperatorDir(dataDir, "BA")); err == nil {
+			t.Error("Expected error for an operator without lines")
+		}
+	})
+}
+
+func TestLoaderLoadAll_Dir(t *testing.T) {
+	loader := &Loader{Dir: newExampleDataDir(t)}
+	store := NewStore(NewOperators([]string{"CT", "BA"}))
+
+	loader.LoadAll(context.Background(), store)
+
+	snapshot := store.Snapshot("CT")
+	if snapshot == nil {
+		t.Fatal("Expected CT to be loaded")
+	}
+	if _, ok := snapshot.Timetables.GetTrain("401"); !ok {
+		t.Error("Expected train 401 to be loaded")
+	}
+	if store.LastFailure("BA") == nil {
+		t.Error("Expected the failed load of BA to be recorded")
+	}
+}
+
+func TestSummarizeDataset(t *testing.T) {
+	data, err := LoadDatasetDir(OperatorDir(newExampleDataDir(t), "CT"))
+	if err != nil {
+		t.Fatalf("failed to load dataset: %v", err)
+	}
+
+	summary, err := SummarizeDataset(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if summary.Lines != 5 || summary.LinesWithTimetable != 1 {
+		t.Errorf("Expected 5 lines with 1 timetable, got %d with %d", summary.Lines, summary.LinesWithTimetable)
+	}
+	if summary.Routes != 2 {
+		t.Errorf("Expected 2 routes, got %d", summary.Routes)
+	}
+	if summary.Trains == 0 || summary.TrainsByWeekday[Monday] != summary.Trains {
+		t.Errorf("Expected every train to run on Monday, got %d of %d", summary.TrainsByWeekday[Monday], summary.Trains)
+	}
+	if summary.TrainsByWeekday[Sunday] != 0 {
+		t.Errorf("Expected no trains on Sunday, got %d", summary.TrainsByWeekday[Sunday])
+	}
+	if summary.ValidFrom != "2026-01-31" || summary.ValidTo != "2026-08-31" {
+		t.Errorf("Expected validity 2026-01-31 to 2026-08-31, got %s to %s", summary.ValidFrom, summary.ValidTo)
+	}
+	store := NewStore([]Operator{NewOperator("CT")})
+	store.Set("CT", data)
+	if want := store.Snapshot("CT").Version; summary.Version != want {
+		t.Errorf("Expected the version of the served snapshot %s, got %s", want, summary.Version)
+	}
+}
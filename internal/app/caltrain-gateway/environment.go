@@ -4,6 +4,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // LoadAPIKeysFromEnv loads API keys from environment variables named FIVEONEONE_API_KEY_1, FIVEONEONE_API_KEY_2, etc.
@@ -22,9 +23,21 @@ func LoadAPIKeysFromEnv() []string {
 
 // LoadSecretFromEnv loads the Caltrain Gateway secret from the CALTRAIN_GATEWAY_SECRET environment variable.
 func LoadSecretFromEnv() string {
-	secret := os.Getenv("CALTRAIN_GATEWAY_SECRET")
-	if secret == "" {
-		log.Println("CALTRAIN_GATEWAY_SECRET environment variable is not set. This is not recommended for production environments.")
+	return os.Getenv("CALTRAIN_GATEWAY_SECRET")
+}
+
+// LoadAdminSecretFromEnv loads the admin API secret from the CALTRAIN_GATEWAY_ADMIN_SECRET environment variable.
+func LoadAdminSecretFromEnv() string {
+	return os.Getenv("CALTRAIN_GATEWAY_ADMIN_SECRET")
+}
+
+// splitList splits a comma-separated list, trimming whitespace and dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
-	return secret
+	return items
 }
@@ -1,13 +1,21 @@
 package caltraingateway
 
 import (
-	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"caltrain-gateway/pkg/api"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/singleflight"
 )
 
@@ -15,175 +23,261 @@ const (
 	defaultAPIBaseURL = "http://api.511.org/"
 )
 
-var (
-	// requestGroup manages the "inflight" requests
-	requestGroup singleflight.Group
-	// apiBaseURL can be overridden for testing
-	apiBaseURL = defaultAPIBaseURL
-)
-
-// gzipResponseWriter wraps http.ResponseWriter to provide gzip compression
-type gzipResponseWriter struct {
-	io.Writer
+// statusRecorder wraps http.ResponseWriter to record the status code and response size
+type statusRecorder struct {
 	http.ResponseWriter
+	status int
+	bytes  int
 }
 
-func (w gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
 }
 
-// gzipMiddleware wraps an http.Handler with gzip compression
-func gzipMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Check if client accepts gzip encoding
-		if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-			next(w, r)
-			return
-		}
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += n
+	return n, err
+}
 
-		// Set the content encoding header
-		w.Header().Set("Content-Encoding", "gzip")
+// Unwrap returns the underlying ResponseWriter for http.ResponseController
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
 
-		// Create gzip writer
-		gz := gzip.NewWriter(w)
-		defer gz.Close()
+// Status returns the status code written so far, defaulting to 200 OK
+func (w *statusRecorder) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// apiResponse holds the response from the upstream API
+type apiResponse struct {
+	statusCode  int
+	contentType string
+	// contentEncoding is set if 511 sent an encoding the HTTP client did not decode
+	contentEncoding string
+	body            []byte
+	etag            string
+	fetchedAt       time.Time
+
+	// variants holds the body compressed with each encoding requested so far
+	variantsMu sync.Mutex
+	variants   map[string][]byte
+}
 
-		// Wrap the response writer
-		gzipWriter := gzipResponseWriter{Writer: gz, ResponseWriter: w}
-		next(gzipWriter, r)
+// compressedBody returns the body compressed with the encoding. The result is
+// kept, so cached responses are compressed once per encoding.
+func (r *apiResponse) compressedBody(encoding string) ([]byte, error) {
+	r.variantsMu.Lock()
+	defer r.variantsMu.Unlock()
+
+	if body, ok := r.variants[encoding]; ok {
+		return body, nil
+	}
+	body, err := compressBytes(encoding, r.body)
+	if err != nil {
+		return nil, err
 	}
+	if r.variants == nil {
+		r.variants = make(map[string][]byte)
+	}
+	r.variants[encoding] = body
+	return body, nil
 }
 
-// authMiddleware checks for the correct secret in the request headers
-func authMiddleware(secret string, next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// If no secret is set, skip authentication
-		if secret == "" {
-			next(w, r)
-			return
-		}
+// writeUpstreamBody writes the body of a successful upstream response, using a
+// compressed variant if the client accepts one of the policy's encodings
+func writeUpstreamBody(w http.ResponseWriter, r *http.Request, response *apiResponse, compression CompressionPolicy) {
+	if response.contentType != "" {
+		w.Header().Set("Content-Type", response.contentType)
+	}
 
-		providedSecret := r.Header.Get("X-API-SECRET")
-		if providedSecret != secret {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
-			return
+	switch encoding := compression.negotiate(r.Header.Get("Accept-Encoding")); {
+	case response.contentEncoding != "":
+		// Pass an encoding the HTTP client did not decode on as it is
+		w.Header().Set("Content-Encoding", response.contentEncoding)
+	case encoding != "" && compression.compressible(response.contentType, len(response.body)):
+		body, err := response.compressedBody(encoding)
+		if err != nil {
+			loggerFrom(r.Context()).Warn("Failed to compress upstream response", "error", err)
+			break
 		}
-		next(w, r)
+		setContentEncoding(w.Header(), encoding)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write(body)
+		return
 	}
+	w.Write(response.body)
 }
 
-func logRequest(r *http.Request) {
-	fmt.Printf("Received request: %s %s from %s\n", r.Method, r.URL.String(), r.RemoteAddr)
-}
+// fetchUpstream requests the 511 API URL within a client span and records its latency
+func fetchUpstream(ctx context.Context, tracer trace.Tracer, metrics *Metrics, endpoint string, url string) (response *apiResponse, err error) {
+	ctx, span := tracer.Start(ctx, "511 GET "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", http.MethodGet), attribute.String("upstream.endpoint", endpoint)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, redactError(err)
+	}
 
-func logRequestMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		logRequest(r)
-		next(w, r)
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		metrics.observeUpstream(endpoint, 0, time.Since(start))
+		// The URL in the error carries the API key
+		return nil, redactError(err)
 	}
-}
+	metrics.observeUpstream(endpoint, resp.StatusCode, time.Since(start))
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	defer resp.Body.Close()
 
-// apiResponse holds the response from the upstream API
-type apiResponse struct {
-	statusCode  int
-	contentType string
-	body        []byte
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiResponse{
+		statusCode:      resp.StatusCode,
+		contentType:     resp.Header.Get("Content-Type"),
+		contentEncoding: resp.Header.Get("Content-Encoding"),
+		body:            body,
+		etag:            strongETag(body),
+		fetchedAt:       time.Now(),
+	}, nil
 }
 
-// proxyHandlerWithBaseURL handles proxying requests to the 511 API with a configurable base URL
-func proxyHandlerWithBaseURL(apiKeyPool *KeyPool, baseURL string) http.HandlerFunc {
+// proxyHandler handles proxying requests to the 511 API at the given base URL.
+// Successful responses are stored in the given cache together with their
+// compressed variants.
+func proxyHandler(apiKeyPool *KeyPool, baseURL string, responseCache *ResponseCache, compression CompressionPolicy, metrics *Metrics, tracer trace.Tracer) http.HandlerFunc {
+	// requestGroup manages the "inflight" requests
+	var requestGroup singleflight.Group
+
 	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
 		cacheKey := r.URL.String()
 
 		// 1. Check Cache
-		if cachedData, found := Cache.Get(cacheKey); found {
-			cached := cachedData.(*apiResponse)
-			if cached.contentType != "" {
-				w.Header().Set("Content-Type", cached.contentType)
-			}
+		_, lookupSpan := tracer.Start(ctx, "cache lookup")
+		cached, status := responseCache.Get(cacheKey)
+		lookupSpan.SetAttributes(attribute.String("cache.result", string(status)))
+		lookupSpan.End()
+		metrics.observeCacheLookup(status)
+		addLogAttrs(ctx, slog.String("cache", string(status)))
+		if status == cacheHit {
 			w.Header().Set("X-Cache", "HIT")
-			w.Write(cached.body)
+			if checkNotModified(w, r, cached.etag, cached.fetchedAt) {
+				return
+			}
+			writeUpstreamBody(w, r, cached, compression)
 			return
 		}
 
 		// 2. Request Collapsing
 		// Only one goroutine will execute this function for a given key.
 		// Others will block until the first one returns.
+		waitCtx, waitSpan := tracer.Start(ctx, "singleflight")
 		data, err, shared := requestGroup.Do(cacheKey, func() (any, error) {
 			// Retrieve API key from the pool
+			_, keySpan := tracer.Start(waitCtx, "acquire API key")
 			apiKey, ok := apiKeyPool.GetAvailableKey()
+			keySpan.SetAttributes(attribute.Bool("apikey.acquired", ok))
 			if !ok {
-				return nil, fmt.Errorf("no available API keys")
+				err := fmt.Errorf("no available API keys")
+				endSpan(keySpan, err)
+				return nil, err
 			}
+			keySpan.SetAttributes(attribute.Int("apikey.index", apiKey.Index()))
+			keySpan.End()
 
-			fmt.Println("Fetching from API for key:", cacheKey)
+			addLogAttrs(ctx, slog.Int("key_index", apiKey.Index()))
+			loggerFrom(ctx).Debug("Fetching from 511 API", "cache_key", redactURL(r.URL), "key_index", apiKey.Index())
 
-			// Add API key to the request
+			// Add API key to the upstream request, leaving the client's URL untouched
 			q := r.URL.Query()
 
 			// Remove existing api_key if present
 			q.Del("api_key")
 
 			q.Add("api_key", apiKey.Value)
-			r.URL.RawQuery = q.Encode()
 
-			realApiUrl := baseURL + r.URL.Path + "?" + r.URL.RawQuery
-			resp, err := http.Get(realApiUrl)
+			realApiUrl := baseURL + r.URL.Path + "?" + q.Encode()
+			endpoint := strings.TrimPrefix(r.URL.Path, "/")
+			// Collapsed requests share the result, so a client going away must not cancel it
+			response, err := fetchUpstream(context.WithoutCancel(waitCtx), tracer, metrics, endpoint, realApiUrl)
 			if err != nil {
 				return nil, err
 			}
-			defer resp.Body.Close()
-
-			body, err := io.ReadAll(resp.Body)
-			if err != nil {
-				return nil, err
-			}
-
-			response := &apiResponse{
-				statusCode:  resp.StatusCode,
-				contentType: resp.Header.Get("Content-Type"),
-				body:        body,
-			}
 
 			// 3. Store in cache only if status code is 200
-			if resp.StatusCode == http.StatusOK {
-				Cache.Set(cacheKey, response, DefaultExpiration)
+			if response.statusCode == http.StatusOK {
+				responseCache.Set(cacheKey, response)
 			}
 			return response, nil
 		})
+		waitSpan.SetAttributes(attribute.Bool("singleflight.shared", shared))
+		endSpan(waitSpan, err)
 
 		if err != nil {
+			addLogAttrs(r.Context(), slog.String("error", err.Error()))
 			switch err.Error() {
 			case "no available API keys":
-				http.Error(w, "Rate limit exceeded for all API keys", http.StatusTooManyRequests)
+				writeError(w, r, newAPIError(http.StatusTooManyRequests, ErrCodeKeysExhausted, "Rate limit exceeded for all API keys"))
 			default:
-				http.Error(w, "External API Error", http.StatusBadGateway)
+				writeError(w, r, newAPIError(http.StatusBadGateway, ErrCodeUpstreamUnavailable, "External API Error"))
 			}
 			return
 		}
 
 		// 4. Return result
 		response := data.(*apiResponse)
-		if response.contentType != "" {
-			w.Header().Set("Content-Type", response.contentType)
-		}
 		w.Header().Set("X-Cache", "MISS")
 		if shared {
 			w.Header().Set("X-Collapsed", "TRUE")
+			metrics.observeCollapsed()
+			addLogAttrs(r.Context(), slog.Bool("collapsed", true))
 		}
-		w.WriteHeader(response.statusCode)
-
 		if response.statusCode == http.StatusOK {
-			w.Write(response.body)
-		} else {
-			fmt.Fprintf(w, "Upstream API returned status code %d", response.statusCode)
+			if checkNotModified(w, r, response.etag, response.fetchedAt) {
+				return
+			}
+			writeUpstreamBody(w, r, response, compression)
+			return
+		}
+		message := fmt.Sprintf("Upstream API returned status code %d", response.statusCode)
+		if isV1(r) {
+			writeError(w, r, &APIError{
+				Status:         response.statusCode,
+				Code:           ErrCodeUpstreamError,
+				Message:        message,
+				UpstreamStatus: response.statusCode,
+				Retryable:      retryableStatus(response.statusCode),
+			})
+			return
 		}
+		if response.contentType != "" {
+			w.Header().Set("Content-Type", response.contentType)
+		}
+		w.WriteHeader(response.statusCode)
+		fmt.Fprint(w, message)
 	}
 }
 
-// proxyHandler handles proxying requests to the 511 API using the default base URL
-func proxyHandler(apiKeyPool *KeyPool) http.HandlerFunc {
-	return proxyHandlerWithBaseURL(apiKeyPool, apiBaseURL)
+// proxyDisabledHandler rejects proxy requests in offline mode, where there is no 511 API to forward to
+func proxyDisabledHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, newAPIError(http.StatusNotFound, ErrCodeProxyDisabled, "The 511 proxy is disabled in offline mode"))
 }
 
 // healthHandler returns a simple OK response for health checks
@@ -191,59 +285,320 @@ func healthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("OK"))
 }
 
-// timetableCollection holds the loaded timetable data for all lines
-var timetableCollection *TimetableCollection
+// lookupSnapshot resolves the {operator} path value and returns its loaded snapshot.
+// It writes an error response and returns nil if the operator is unknown or not loaded.
+func lookupSnapshot(store *Store, w http.ResponseWriter, r *http.Request) *Snapshot {
+	name := r.PathValue("operator")
+	operator, ok := store.Lookup(name)
+	if !ok {
+		writeError(w, r, newAPIError(http.StatusNotFound, ErrCodeUnknownOperator, fmt.Sprintf("Unknown operator: %s", name)))
+		return nil
+	}
 
-// SetTimetableCollection sets the timetable collection to be used by the timetable handler
-func SetTimetableCollection(tc *TimetableCollection) {
-	timetableCollection = tc
+	snapshot := store.Snapshot(operator.ID)
+	if snapshot == nil {
+		writeError(w, r, newAPIError(http.StatusServiceUnavailable, ErrCodeTimetableNotLoaded, "Timetable not loaded"))
+		return nil
+	}
+	return snapshot
 }
 
-// timetableHandler returns all departures by stop ID as JSON
+// timetableHandler returns all departures by stop ID as JSON for the operator in the path
 // Accepts optional query parameters:
 //   - weekday (Monday, Tuesday, etc.)
 //   - station (GTFS station ID to filter results)
-func timetableHandler(w http.ResponseWriter, r *http.Request) {
-	if timetableCollection == nil {
-		http.Error(w, "Timetable not loaded", http.StatusServiceUnavailable)
+func timetableHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := lookupSnapshot(store, w, r)
+		if snapshot == nil {
+			return
+		}
+
+		// Parse weekday from query parameter
+		weekdayParam := r.URL.Query().Get("weekday")
+		var weekday Weekday
+		if weekdayParam != "" {
+			weekday = ParseWeekday(weekdayParam)
+			if weekday == "" {
+				writeError(w, r, newAPIError(http.StatusBadRequest, ErrCodeInvalidWeekday, "Invalid weekday. Valid values: Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday"))
+				return
+			}
+		}
+
+		departures := snapshot.Timetables.GetDeparturesByStopAndWeekday(weekday)
+
+		// Filter by station ID if provided
+		stationID := r.URL.Query().Get("station")
+		if stationID != "" {
+			if stationDepartures, exists := departures[stationID]; exists {
+				departures = map[string][]TrainDeparture{stationID: stationDepartures}
+			} else {
+				departures = map[string][]TrainDeparture{}
+			}
+		}
+
+		writeSnapshotJSON(w, r, snapshot, departures)
+	}
+}
+
+// LineDetail is a line together with its routes and stop sequences
+type LineDetail = api.LineDetail
+
+// writeSnapshotJSON writes v as JSON with validators derived from the snapshot.
+// Responses only depend on the query and the loaded snapshot, so the snapshot
+// version identifies the representation for a given URL. Reloads of the same
+// version keep ModifiedAt, so the envelope does not change either.
+// For /v1 requests v is wrapped in a data envelope describing the snapshot.
+func writeSnapshotJSON(w http.ResponseWriter, r *http.Request, snapshot *Snapshot, v any) {
+	var etag string
+	if snapshot.Version != "" {
+		etag = `"` + snapshot.Version + `"`
+	}
+	if checkNotModified(w, r, etag, snapshot.ModifiedAt) {
 		return
 	}
 
-	// Parse weekday from query parameter
-	weekdayParam := r.URL.Query().Get("weekday")
-	var departures map[string][]TrainDeparture
+	if isV1(r) {
+		v = DataEnvelope[any]{Data: v, Meta: &Meta{Version: snapshot.Version, LoadedAt: snapshot.ModifiedAt}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		writeError(w, r, newAPIError(http.StatusInternalServerError, ErrCodeInternal, "Failed to encode response"))
+		return
+	}
+}
 
-	if weekdayParam != "" {
-		weekday := ParseWeekday(weekdayParam)
-		if weekday == "" {
-			http.Error(w, "Invalid weekday. Valid values: Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday", http.StatusBadRequest)
+// linesHandler returns the lines loaded for the operator in the path as JSON
+// Accepts optional query parameters:
+//   - monitored (true to only return monitored lines)
+//   - valid (true to only return lines valid right now)
+//   - date (YYYY-MM-DD to only return lines valid on that date)
+func linesHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := lookupSnapshot(store, w, r)
+		if snapshot == nil {
 			return
 		}
-		departures = timetableCollection.GetDeparturesByStopAndWeekday(weekday)
-	} else {
-		departures = timetableCollection.GetDeparturesByStop()
+
+		q := r.URL.Query()
+		date := q.Get("date")
+		if date != "" {
+			if _, err := time.Parse(time.DateOnly, date); err != nil {
+				writeError(w, r, newAPIError(http.StatusBadRequest, ErrCodeInvalidDate, "Invalid date. Expected format: YYYY-MM-DD"))
+				return
+			}
+		}
+
+		lines := snapshot.Lines
+		if q.Get("monitored") == "true" {
+			lines = GetMonitoredLines(lines)
+		}
+
+		now := time.Now()
+		result := make([]Line, 0, len(lines))
+		for _, line := range lines {
+			if q.Get("valid") == "true" && !line.IsValidAt(now) {
+				continue
+			}
+			if date != "" && !line.IsValidOn(date) {
+				continue
+			}
+			result = append(result, line)
+		}
+
+		writeSnapshotJSON(w, r, snapshot, result)
 	}
+}
 
-	// Filter by station ID if provided
-	stationID := r.URL.Query().Get("station")
-	if stationID != "" {
-		if stationDepartures, exists := departures[stationID]; exists {
-			departures = map[string][]TrainDeparture{stationID: stationDepartures}
-		} else {
-			departures = map[string][]TrainDeparture{}
+// lineHandler returns a single line with its routes and stop sequences as JSON
+func lineHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := lookupSnapshot(store, w, r)
+		if snapshot == nil {
+			return
 		}
+
+		id := r.PathValue("id")
+		line, ok := FindLine(snapshot.Lines, id)
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusNotFound, ErrCodeLineNotFound, fmt.Sprintf("Line not found: %s", id)))
+			return
+		}
+
+		writeSnapshotJSON(w, r, snapshot, LineDetail{
+			Line:   line,
+			Routes: snapshot.Timetables.GetRoutesByLine(line.ID),
+		})
 	}
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	if err := json.NewEncoder(w).Encode(departures); err != nil {
-		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
-		return
+// trainHandler returns a single train with its full stopping pattern as JSON
+func trainHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := lookupSnapshot(store, w, r)
+		if snapshot == nil {
+			return
+		}
+
+		id := r.PathValue("id")
+		train, ok := snapshot.Timetables.GetTrain(id)
+		if !ok {
+			writeError(w, r, newAPIError(http.StatusNotFound, ErrCodeTrainNotFound, fmt.Sprintf("Train not found: %s", id)))
+			return
+		}
+		for i := range train.Calls {
+			train.Calls[i].StationName = snapshot.StopName(train.Calls[i].StopID)
+		}
+
+		writeSnapshotJSON(w, r, snapshot, train)
 	}
 }
 
-// setupRoutes configures all HTTP routes
-func SetupRoutes(apiKeyPool *KeyPool, secret string) {
-	http.HandleFunc("/", logRequestMiddleware(authMiddleware(secret, gzipMiddleware(proxyHandler(apiKeyPool)))))
-	http.HandleFunc("/up", healthHandler)
-	http.HandleFunc("/caltrain/timetable", logRequestMiddleware(authMiddleware(secret, gzipMiddleware(timetableHandler))))
+// stopsHandler returns the stops loaded for the operator in the path as JSON
+func stopsHandler(store *Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		snapshot := lookupSnapshot(store, w, r)
+		if snapshot == nil {
+			return
+		}
+
+		stops := snapshot.Stops
+		if stops == nil {
+			stops = []Stop{}
+		}
+		writeSnapshotJSON(w, r, snapshot, stops)
+	}
+}
+
+// Deps holds the dependencies of the HTTP handlers
+type Deps struct {
+	Config  *Config
+	KeyPool *KeyPool
+	Store   *Store
+	// Clients are allowed to use the gateway. The shared secrets of the config are used if nil.
+	Clients *ClientRegistry
+	// Cache stores proxied responses. A new cache is created from the config if nil.
+	Cache *ResponseCache
+	// Metrics collects Prometheus metrics and enables /metrics if set
+	Metrics *Metrics
+	// Logger writes the access log. slog.Default() is used if nil.
+	Logger *slog.Logger
+	// Loader is asked to reload timetables through the admin API if set
+	Loader *Loader
+	// TracerProvider creates the spans of incoming and upstream requests.
+	// The global provider is used if nil.
+	TracerProvider trace.TracerProvider
+}
+
+// upstreamFallback routes requests for allowlisted 511 endpoints that share the
+// shape of an operator route (e.g. /transit/lines) to the proxy instead
+func upstreamFallback(policy ProxyPolicy, proxy http.HandlerFunc, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if policy.allowsPath(r.URL.Path) {
+			proxy(w, r)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// operatorRoutes returns the timetable handlers of each operator by path pattern.
+// They are served under /v1 and as deprecated unversioned aliases.
+func operatorRoutes(store *Store) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/{operator}/timetable":   timetableHandler(store),
+		"/{operator}/lines":       linesHandler(store),
+		"/{operator}/lines/{id}":  lineHandler(store),
+		"/{operator}/trains/{id}": trainHandler(store),
+	}
+}
+
+// v1OperatorRoutes returns the timetable handlers of each operator that are
+// only served under /v1, as they were added after the unversioned routes
+func v1OperatorRoutes(store *Store) map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/{operator}/stops": stopsHandler(store),
+	}
+}
+
+// NewHandler returns the gateway's HTTP handler with all routes registered on its own mux
+func NewHandler(deps Deps) (http.Handler, error) {
+	cfg := deps.Config
+	if deps.Cache == nil {
+		deps.Cache = NewResponseCache(cfg.CacheTTL, cfg.CacheCleanupInterval)
+	}
+
+	if deps.Logger == nil {
+		deps.Logger = slog.Default()
+	}
+	if deps.Clients == nil {
+		clients, err := NewClientRegistry(sharedSecretClients(cfg))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create clients of the shared secrets: %w", err)
+		}
+		deps.Clients = clients
+	}
+	tracer := newTracer(deps.TracerProvider)
+
+	// protect adds authentication and compression to a handler
+	protect := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware(deps.Clients, ScopeTimetable, compressMiddleware(cfg.Compression, next))
+	}
+	// cors runs before authentication so preflight requests without credentials succeed
+	cors := func(next http.HandlerFunc) http.HandlerFunc {
+		return corsMiddleware(cfg.CORS, next)
+	}
+	var proxy http.HandlerFunc = proxyDisabledHandler
+	if !cfg.Offline() {
+		proxy = authMiddleware(deps.Clients, ScopeProxy, proxyPolicyMiddleware(cfg.Proxy, compressMiddleware(cfg.Compression, proxyHandler(deps.KeyPool, cfg.APIBaseURL, deps.Cache, cfg.Compression, deps.Metrics, tracer))))
+	}
+	operatorRoute := func(next http.HandlerFunc) http.HandlerFunc {
+		return cors(upstreamFallback(cfg.Proxy, proxy, protect(next)))
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", deprecatedMiddleware(cors(proxy)))
+	mux.HandleFunc("GET /up", healthHandler)
+	mux.HandleFunc("GET /ready", readyHandler(deps.Store, deps.KeyPool, deps.Cache, cfg.Offline()))
+	mux.HandleFunc("GET /status", statusHandler(deps.Store, deps.KeyPool, deps.Cache, cfg.Offline()))
+	mux.HandleFunc("GET /openapi.json", compressMiddleware(cfg.Compression, openAPIHandler))
+
+	// The /v1 routes live on their own mux, as their patterns would conflict
+	// with the unversioned {operator} patterns
+	v1 := http.NewServeMux()
+	v1.HandleFunc(apiV1Prefix+"/", apiV1Middleware(cors(proxy)))
+
+	// The GET patterns do not match OPTIONS, so preflight requests need their own routes
+	handleV1 := func(pattern string, handler http.HandlerFunc) {
+		v1.HandleFunc("GET "+apiV1Prefix+pattern, apiV1Middleware(handler))
+		if cfg.CORS.Enabled() {
+			v1.HandleFunc("OPTIONS "+apiV1Prefix+pattern, apiV1Middleware(cors(methodNotAllowedHandler)))
+		}
+	}
+	for pattern, handler := range operatorRoutes(deps.Store) {
+		handler = operatorRoute(handler)
+		mux.HandleFunc("GET "+pattern, deprecatedMiddleware(handler))
+		if cfg.CORS.Enabled() {
+			mux.HandleFunc("OPTIONS "+pattern, cors(methodNotAllowedHandler))
+		}
+		handleV1(pattern, handler)
+	}
+	for pattern, handler := range v1OperatorRoutes(deps.Store) {
+		handleV1(pattern, operatorRoute(handler))
+	}
+	if deps.Metrics != nil {
+		mux.Handle("GET /metrics", deps.Metrics.Handler())
+	}
+	// The admin API is only available when a client is granted the admin scope
+	if deps.Clients.HasScope(ScopeAdmin) {
+		registerAdminRoutes(mux, deps)
+	}
+	routes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, apiV1Prefix+"/") {
+			v1.ServeHTTP(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+	return traceMiddleware(tracer, logRequestMiddleware(deps.Logger, metricsMiddleware(deps.Metrics, traceRouteMiddleware(routes)))), nil
 }
@@ -1,11 +1,15 @@
 package caltraingateway
 
 import (
+	"context"
+	"encoding/json"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestProxyHandler_ExistingAPIKey(t *testing.T) {
@@ -36,7 +40,7 @@ func TestProxyHandler_ExistingAPIKey(t *testing.T) {
 	rec := httptest.NewRecorder()
 
 	// Create the handler with mock base URL
-	handler := proxyHandlerWithBaseURL(keyPool, mockAPI.URL+"/")
+	handler := proxyHandler(keyPool, mockAPI.URL+"/", NewResponseCache(time.Minute, time.Minute), DefaultCompressionPolicy(), nil, newTracer(nil))
 
 	// Execute the handler
 	handler(rec, req)
@@ -87,9 +91,6 @@ func TestProxyHandler_NonOKStatusCode(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			// Clear cache before each test
-			Cache.Flush()
-
 			// Create a mock API server
 			mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				w.WriteHeader(tt.mockStatusCode)
@@ -103,7 +104,7 @@ func TestProxyHandler_NonOKStatusCode(t *testing.T) {
 			// First request
 			req1 := httptest.NewRequest("GET", "/transit/stops?format=json", nil)
 			rec1 := httptest.NewRecorder()
-			handler := proxyHandlerWithBaseURL(keyPool, mockAPI.URL+"/")
+			handler := proxyHandler(keyPool, mockAPI.URL+"/", NewResponseCache(time.Minute, time.Minute), DefaultCompressionPolicy(), nil, newTracer(nil))
 			handler(rec1, req1)
 
 			resp1 := rec1.Result()
@@ -154,6 +155,85 @@ func TestProxyHandler_NonOKStatusCode(t *testing.T) {
 	}
 }
 
+func TestProxyHandler_ConditionalRequests(t *testing.T) {
+	upstreamCalls := 0
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer mockAPI.Close()
+
+	keyPool := NewKeyPool([]string{"test-key"}, 10, 1)
+	handler := proxyHandler(keyPool, mockAPI.URL+"/", NewResponseCache(time.Minute, time.Minute), DefaultCompressionPolicy(), nil, newTracer(nil))
+
+	// First request populates the cache and returns validators
+	req1 := httptest.NewRequest("GET", "/transit/conditional?format=json", nil)
+	rec1 := httptest.NewRecorder()
+	handler(rec1, req1)
+
+	resp1 := rec1.Result()
+	etag := resp1.Header.Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected ETag header on proxied response")
+	}
+	lastModified := resp1.Header.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatal("Expected Last-Modified header on proxied response")
+	}
+
+	t.Run("If-None-Match returns 304 from cache", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/transit/conditional?format=json", nil)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusNotModified {
+			t.Errorf("Expected status %d, got %d", http.StatusNotModified, resp.StatusCode)
+		}
+		if resp.Header.Get("X-Cache") != "HIT" {
+			t.Errorf("Expected cache HIT, got '%s'", resp.Header.Get("X-Cache"))
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if len(body) != 0 {
+			t.Errorf("Expected empty body for 304, got '%s'", string(body))
+		}
+	})
+
+	t.Run("If-Modified-Since returns 304 from cache", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/transit/conditional?format=json", nil)
+		req.Header.Set("If-Modified-Since", lastModified)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Result().StatusCode != http.StatusNotModified {
+			t.Errorf("Expected status %d, got %d", http.StatusNotModified, rec.Result().StatusCode)
+		}
+	})
+
+	t.Run("stale ETag returns full body", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/transit/conditional?format=json", nil)
+		req.Header.Set("If-None-Match", `"stale"`)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if string(body) != `{"status": "ok"}` {
+			t.Errorf("Expected cached body, got '%s'", string(body))
+		}
+	})
+
+	if upstreamCalls != 1 {
+		t.Errorf("Expected 1 upstream call, got %d", upstreamCalls)
+	}
+}
+
 func TestAuthMiddleware(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -215,7 +295,11 @@ func TestAuthMiddleware(t *testing.T) {
 			})
 
 			// Create the middleware
-			handler := authMiddleware(tt.secret, nextHandler)
+			clients, err := NewClientRegistry(sharedSecretClients(&Config{Secret: tt.secret}))
+			if err != nil {
+				t.Fatalf("NewClientRegistry() error: %v", err)
+			}
+			handler := authMiddleware(clients, ScopeProxy, nextHandler)
 
 			// Create request
 			req := httptest.NewRequest("GET", "/test", nil)
@@ -291,7 +375,7 @@ func TestLogRequestMiddleware(t *testing.T) {
 			})
 
 			// Create the middleware
-			handler := logRequestMiddleware(nextHandler)
+			handler := logRequestMiddleware(slog.New(slog.NewTextHandler(io.Discard, nil)), nextHandler)
 
 			// Create request
 			req := httptest.NewRequest(tt.method, tt.url, nil)
@@ -301,7 +385,7 @@ func TestLogRequestMiddleware(t *testing.T) {
 			rec := httptest.NewRecorder()
 
 			// Execute the handler
-			handler(rec, req)
+			handler.ServeHTTP(rec, req)
 
 			// Verify next handler was called
 			if !nextCalled {
@@ -339,13 +423,14 @@ func TestLogRequestMiddleware(t *testing.T) {
 
 func TestTimetableHandler(t *testing.T) {
 	t.Run("timetable not loaded", func(t *testing.T) {
-		// Ensure timetable collection is nil
-		SetTimetableCollection(nil)
+		// Ensure no timetable is loaded
+		store := NewStore([]Operator{NewOperator("CT")})
 
 		req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+		req.SetPathValue("operator", "caltrain")
 		rec := httptest.NewRecorder()
 
-		timetableHandler(rec, req)
+		timetableHandler(store)(rec, req)
 
 		resp := rec.Result()
 		if resp.StatusCode != http.StatusServiceUnavailable {
@@ -361,12 +446,14 @@ func TestTimetableHandler(t *testing.T) {
 			t.Fatalf("failed to load timetable: %v", err)
 		}
 		tc.AddTimetable(tt)
-		SetTimetableCollection(tc)
+		store := NewStore([]Operator{NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: tc})
 
 		req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+		req.SetPathValue("operator", "caltrain")
 		rec := httptest.NewRecorder()
 
-		timetableHandler(rec, req)
+		timetableHandler(store)(rec, req)
 
 		resp := rec.Result()
 		if resp.StatusCode != http.StatusOK {
@@ -397,13 +484,15 @@ func TestTimetableHandler(t *testing.T) {
 			t.Fatalf("failed to load timetable: %v", err)
 		}
 		tc.AddTimetable(tt)
-		SetTimetableCollection(tc)
+		store := NewStore([]Operator{NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: tc})
 
 		// Test with Monday (should return results - weekday schedule)
 		req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=Monday", nil)
+		req.SetPathValue("operator", "caltrain")
 		rec := httptest.NewRecorder()
 
-		timetableHandler(rec, req)
+		timetableHandler(store)(rec, req)
 
 		resp := rec.Result()
 		if resp.StatusCode != http.StatusOK {
@@ -424,13 +513,15 @@ func TestTimetableHandler(t *testing.T) {
 			t.Fatalf("failed to load timetable: %v", err)
 		}
 		tc.AddTimetable(tt)
-		SetTimetableCollection(tc)
+		store := NewStore([]Operator{NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: tc})
 
 		// Test with Saturday (should return empty - example has weekday only)
 		req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=Saturday", nil)
+		req.SetPathValue("operator", "caltrain")
 		rec := httptest.NewRecorder()
 
-		timetableHandler(rec, req)
+		timetableHandler(store)(rec, req)
 
 		resp := rec.Result()
 		if resp.StatusCode != http.StatusOK {
@@ -444,14 +535,105 @@ func TestTimetableHandler(t *testing.T) {
 		}
 	})
 
-	t.Run("with invalid weekday", func(t *testing.T) {
+	t.Run("conditional request", func(t *testing.T) {
 		tc := NewTimetableCollection()
-		SetTimetableCollection(tc)
+		if err := tc.LoadTimetableFiles("example_timetable.json"); err != nil {
+			t.Fatalf("failed to load timetable: %v", err)
+		}
+		store := NewStore([]Operator{NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: tc})
+
+		req1 := httptest.NewRequest("GET", "/caltrain/timetable?weekday=Monday", nil)
+		req1.SetPathValue("operator", "caltrain")
+		rec1 := httptest.NewRecorder()
+		timetableHandler(store)(rec1, req1)
+
+		etag := rec1.Result().Header.Get("ETag")
+		if etag == "" {
+			t.Fatal("Expected ETag header on timetable response")
+		}
+		if rec1.Result().Header.Get("Last-Modified") == "" {
+			t.Error("Expected Last-Modified header on timetable response")
+		}
+
+		req2 := httptest.NewRequest("GET", "/caltrain/timetable?weekday=Monday", nil)
+		req2.SetPathValue("operator", "caltrain")
+		req2.Header.Set("If-None-Match", etag)
+		rec2 := httptest.NewRecorder()
+		timetableHandler(store)(rec2, req2)
+
+		if rec2.Result().StatusCode != http.StatusNotModified {
+			t.Errorf("Expected status %d, got %d", http.StatusNotModified, rec2.Result().StatusCode)
+		}
+
+		// Reloading identical data keeps the ETag stable
+		store.Set("CT", &Dataset{Timetables: tc})
+		rec3 := httptest.NewRecorder()
+		timetableHandler(store)(rec3, req2)
+		if rec3.Result().StatusCode != http.StatusNotModified {
+			t.Errorf("Expected status %d after reload, got %d", http.StatusNotModified, rec3.Result().StatusCode)
+		}
+	})
+
+	t.Run("unknown operator", func(t *testing.T) {
+		store := NewStore([]Operator{NewOperator("CT")})
+
+		req := httptest.NewRequest("GET", "/bart/timetable", nil)
+		req.SetPathValue("operator", "bart")
+		rec := httptest.NewRecorder()
+
+		timetableHandler(store)(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, resp.StatusCode)
+		}
+	})
+
+	t.Run("operator by ID", func(t *testing.T) {
+		tc := NewTimetableCollection()
+		if err := tc.LoadTimetableFiles("example_timetable.json"); err != nil {
+			t.Fatalf("failed to load timetable: %v", err)
+		}
+		store := NewStore([]Operator{NewOperator("BA"), NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: tc})
+
+		req := httptest.NewRequest("GET", "/CT/timetable?station=70261", nil)
+		req.SetPathValue("operator", "CT")
+		rec := httptest.NewRecorder()
+
+		timetableHandler(store)(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(body), "70261") {
+			t.Error("Expected response to contain stop ID '70261'")
+		}
+
+		// BART is configured but has no data loaded
+		req = httptest.NewRequest("GET", "/bart/timetable", nil)
+		req.SetPathValue("operator", "bart")
+		rec = httptest.NewRecorder()
+
+		timetableHandler(store)(rec, req)
+
+		if rec.Result().StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, rec.Result().StatusCode)
+		}
+	})
+
+	t.Run("with invalid weekday", func(t *testing.T) {
+		store := NewStore([]Operator{NewOperator("CT")})
+		store.Set("CT", &Dataset{Timetables: NewTimetableCollection()})
 
 		req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=InvalidDay", nil)
+		req.SetPathValue("operator", "caltrain")
 		rec := httptest.NewRecorder()
 
-		timetableHandler(rec, req)
+		timetableHandler(store)(rec, req)
 
 		resp := rec.Result()
 		if resp.StatusCode != http.StatusBadRequest {
@@ -459,3 +641,414 @@ func TestTimetableHandler(t *testing.T) {
 		}
 	})
 }
+
+// newExampleStore returns a store with the example lines, stops and timetable loaded for Caltrain
+func newExampleStore(t *testing.T) *Store {
+	t.Helper()
+
+	lines, err := LoadLinesFromFile("example_lines.json")
+	if err != nil {
+		t.Fatalf("failed to load lines: %v", err)
+	}
+	stops, err := LoadStopsFromFile("example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+	tc := NewTimetableCollection()
+	if err := tc.LoadTimetableFiles("example_timetable.json"); err != nil {
+		t.Fatalf("failed to load timetable: %v", err)
+	}
+
+	store := NewStore([]Operator{NewOperator("CT")})
+	store.Set("CT", &Dataset{Lines: lines, Stops: stops, Timetables: tc})
+	return store
+}
+
+func TestLinesHandler(t *testing.T) {
+	store := newExampleStore(t)
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedLines  int
+	}{
+		{
+			name:           "all lines",
+			url:            "/caltrain/lines",
+			expectedStatus: http.StatusOK,
+			expectedLines:  5,
+		},
+		{
+			name:           "monitored lines",
+			url:            "/caltrain/lines?monitored=true",
+			expectedStatus: http.StatusOK,
+			expectedLines:  5,
+		},
+		{
+			name:           "lines valid on date",
+			url:            "/caltrain/lines?date=2026-03-01",
+			expectedStatus: http.StatusOK,
+			expectedLines:  5,
+		},
+		{
+			name:           "no lines valid before the schedule starts",
+			url:            "/caltrain/lines?date=2025-12-24",
+			expectedStatus: http.StatusOK,
+			expectedLines:  0,
+		},
+		{
+			name:           "invalid date",
+			url:            "/caltrain/lines?date=March",
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.SetPathValue("operator", "caltrain")
+			rec := httptest.NewRecorder()
+
+			linesHandler(store)(rec, req)
+
+			resp := rec.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			var lines []Line
+			if err := json.NewDecoder(resp.Body).Decode(&lines); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(lines) != tt.expectedLines {
+				t.Errorf("Expected %d lines, got %d", tt.expectedLines, len(lines))
+			}
+		})
+	}
+}
+
+func TestLineHandler(t *testing.T) {
+	store := newExampleStore(t)
+
+	t.Run("line with routes", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/caltrain/lines/Limited", nil)
+		req.SetPathValue("operator", "caltrain")
+		req.SetPathValue("id", "Limited")
+		rec := httptest.NewRecorder()
+
+		lineHandler(store)(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+
+		var detail LineDetail
+		if err := json.NewDecoder(resp.Body).Decode(&detail); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if detail.ID != "Limited" || detail.SiriLineRef != "LIM" {
+			t.Errorf("Unexpected line metadata: %+v", detail.Line)
+		}
+		if len(detail.Routes) != 2 {
+			t.Fatalf("Expected 2 routes, got %d", len(detail.Routes))
+		}
+		if len(detail.Routes[0].Stops) == 0 {
+			t.Error("Expected route to have stops")
+		}
+	})
+
+	t.Run("line without timetable", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/caltrain/lines/Express", nil)
+		req.SetPathValue("operator", "caltrain")
+		req.SetPathValue("id", "Express")
+		rec := httptest.NewRecorder()
+
+		lineHandler(store)(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		if !strings.Contains(string(body), `"Routes":[]`) {
+			t.Errorf("Expected empty routes, got '%s'", string(body))
+		}
+	})
+
+	t.Run("unknown line", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/caltrain/lines/Bullet", nil)
+		req.SetPathValue("operator", "caltrain")
+		req.SetPathValue("id", "Bullet")
+		rec := httptest.NewRecorder()
+
+		lineHandler(store)(rec, req)
+
+		if rec.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Result().StatusCode)
+		}
+	})
+}
+
+func TestTrainHandler(t *testing.T) {
+	store := newExampleStore(t)
+
+	t.Run("train with stopping pattern", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/caltrain/trains/401", nil)
+		req.SetPathValue("operator", "caltrain")
+		req.SetPathValue("id", "401")
+		rec := httptest.NewRecorder()
+
+		trainHandler(store)(rec, req)
+
+		resp := rec.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status %d, got %d", http.StatusOK, resp.StatusCode)
+		}
+		if resp.Header.Get("ETag") == "" {
+			t.Error("Expected ETag header on train response")
+		}
+
+		var train TrainDetail
+		if err := json.NewDecoder(resp.Body).Decode(&train); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		if train.TrainID != "401" || train.Line != "Limited" {
+			t.Errorf("Unexpected train: %+v", train)
+		}
+		if len(train.Calls) == 0 {
+			t.Fatal("Expected calls in response")
+		}
+		if train.Calls[0].StationName != "San Jose Diridon Caltrain Station Northbound" {
+			t.Errorf("Expected first station 'San Jose Diridon Caltrain Station Northbound', got '%s'", train.Calls[0].StationName)
+		}
+	})
+
+	t.Run("unknown train", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/caltrain/trains/999", nil)
+		req.SetPathValue("operator", "caltrain")
+		req.SetPathValue("id", "999")
+		rec := httptest.NewRecorder()
+
+		trainHandler(store)(rec, req)
+
+		if rec.Result().StatusCode != http.StatusNotFound {
+			t.Errorf("Expected status %d, got %d", http.StatusNotFound, rec.Result().StatusCode)
+		}
+	})
+}
+
+func TestNewHandler_InvalidSharedSecrets(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Secret = "mysecret"
+	cfg.AdminSecret = "admin-secret"
+	cfg.PreviousSecret = "admin-secret"
+
+	// A handler without clients would not require authentication
+	if _, err := NewHandler(Deps{Config: cfg, KeyPool: NewKeyPool(nil, 1, 1), Store: newExampleStore(t)}); err == nil {
+		t.Error("Expected error for an admin secret that is also the previous secret")
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	upstreamCalls := 0
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upstreamCalls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"path": "` + r.URL.Path + `"}`))
+	}))
+	defer mockAPI.Close()
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	cfg.Secret = "mysecret"
+	cfg.Proxy.AllowedPaths = append(cfg.Proxy.AllowedPaths, "transit/lines")
+
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"test-key"}, 100, 10),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		secret         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{
+			name:           "health check without secret",
+			method:         "GET",
+			url:            "/up",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "OK",
+		},
+		{
+			name:           "timetable requires secret",
+			method:         "GET",
+			url:            "/caltrain/timetable",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name:           "timetable",
+			method:         "GET",
+			url:            "/caltrain/timetable?station=70261",
+			secret:         "mysecret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "70261",
+		},
+		{
+			name:           "line detail",
+			method:         "GET",
+			url:            "/CT/lines/Limited",
+			secret:         "mysecret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"Routes"`,
+		},
+		{
+			name:           "train detail",
+			method:         "GET",
+			url:            "/caltrain/trains/401",
+			secret:         "mysecret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"calls"`,
+		},
+		{
+			name:           "unknown operator",
+			method:         "GET",
+			url:            "/bart/timetable",
+			secret:         "mysecret",
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "non-GET timetable request",
+			method:         "POST",
+			url:            "/caltrain/timetable",
+			secret:         "mysecret",
+			expectedStatus: http.StatusMethodNotAllowed,
+		},
+		{
+			name:           "proxied request",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?agency=CT",
+			secret:         "mysecret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/transit/StopMonitoring",
+		},
+		{
+			name:           "allowlisted upstream path shaped like an operator route",
+			method:         "GET",
+			url:            "/transit/lines?operator_id=CT",
+			secret:         "mysecret",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/transit/lines",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.secret != "" {
+				req.Header.Set("X-API-SECRET", tt.secret)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			resp := rec.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(body), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got '%s'", tt.expectedBody, string(body))
+			}
+		})
+	}
+
+	if upstreamCalls != 2 {
+		t.Errorf("Expected 2 upstream calls, got %d", upstreamCalls)
+	}
+}
+
+func TestNewHandler_Independent(t *testing.T) {
+	// Two handlers with their own stores and caches can run side by side
+	cfgA := DefaultConfig()
+	cfgB := DefaultConfig()
+	cfgB.Operators = []string{"BA"}
+
+	handlerA, err := NewHandler(Deps{Config: cfgA, KeyPool: NewKeyPool(nil, 1, 1), Store: newExampleStore(t)})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	handlerB, err := NewHandler(Deps{Config: cfgB, KeyPool: NewKeyPool(nil, 1, 1), Store: NewStore(NewOperators(cfgB.Operators))})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	recA := httptest.NewRecorder()
+	handlerA.ServeHTTP(recA, httptest.NewRequest("GET", "/caltrain/timetable", nil))
+	if recA.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d from first handler, got %d", http.StatusOK, recA.Result().StatusCode)
+	}
+
+	recB := httptest.NewRecorder()
+	handlerB.ServeHTTP(recB, httptest.NewRequest("GET", "/caltrain/timetable", nil))
+	if recB.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d from second handler, got %d", http.StatusNotFound, recB.Result().StatusCode)
+	}
+}
+
+func TestNewHandler_Offline(t *testing.T) {
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Expected no upstream request offline, got %s", r.URL)
+	}))
+	defer mockAPI.Close()
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	cfg.DataDir = newExampleDataDir(t)
+	store := NewStore(NewOperators(cfg.Operators))
+	(&Loader{Dir: cfg.DataDir}).LoadAll(context.Background(), store)
+
+	handler, err := NewHandler(Deps{Config: cfg, KeyPool: NewKeyPool(nil, 1, 1), Store: store})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{name: "ready without API keys", url: "/ready", expectedStatus: http.StatusOK, expectedBody: "OK"},
+		{name: "timetable", url: "/v1/caltrain/timetable?station=70261", expectedStatus: http.StatusOK, expectedBody: "70261"},
+		{name: "train detail", url: "/v1/caltrain/trains/401", expectedStatus: http.StatusOK, expectedBody: `"calls"`},
+		{name: "proxy disabled", url: "/v1/transit/StopMonitoring?agency=CT", expectedStatus: http.StatusNotFound, expectedBody: ErrCodeProxyDisabled},
+		{name: "legacy proxy disabled", url: "/transit/StopMonitoring?agency=CT", expectedStatus: http.StatusNotFound, expectedBody: "disabled in offline mode"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest("GET", tt.url, nil))
+
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+			if !strings.Contains(rec.Body.String(), tt.expectedBody) {
+				t.Errorf("Expected body to contain %q, got '%s'", tt.expectedBody, rec.Body.String())
+			}
+		})
+	}
+}
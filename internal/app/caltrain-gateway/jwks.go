@@ -0,0 +1,210 @@
+package caltraingateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minJWKSRefreshInterval limits how often a JWKS URL is fetched again for unknown key IDs
+const minJWKSRefreshInterval = time.Minute
+
+// jsonWebKey is a public key of a JWK set, see RFC 7517 and RFC 7518
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA keys
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC keys
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the RSA or EC public key
+func (k *jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key parameters")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		// Encode the point uncompressed so the standard library checks it is on the curve
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("invalid EC key coordinates")
+		}
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// parseJWKS parses a JWK set, ignoring keys not meant for signatures
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key %d of JWKS: %w", i+1, err)
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS contains no signing keys")
+	}
+	return keys, nil
+}
+
+// JWKS holds the public keys of a token issuer, loaded from a file or URL.
+// Keys loaded from a URL are fetched again when a token names an unknown key,
+// so the issuer can rotate its keys without restarting the gateway.
+type JWKS struct {
+	source string
+
+	// refreshMu serializes refreshes, so concurrent requests with unknown key
+	// IDs fetch the keys once
+	refreshMu   sync.Mutex
+	attemptedAt time.Time // start of the last refresh, whether it succeeded or not
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey
+}
+
+// LoadJWKS loads the JWK set from a file or an http(s) URL
+func LoadJWKS(ctx context.Context, source string) (*JWKS, error) {
+	jwks := &JWKS{source: source}
+	if err := jwks.refresh(ctx); err != nil {
+		return nil, err
+	}
+	return jwks, nil
+}
+
+// isURL reports whether the keys are loaded from a URL rather than a file
+func (s *JWKS) isURL() bool {
+	return strings.HasPrefix(s.source, "http://") || strings.HasPrefix(s.source, "https://")
+}
+
+// refresh loads the keys from the source again.
+// The caller must hold refreshMu unless the JWKS is not shared yet.
+func (s *JWKS) refresh(ctx context.Context) error {
+	s.attemptedAt = time.Now()
+	var data []byte
+	var err error
+	if s.isURL() {
+		data, _, err = fetchURL(ctx, s.source)
+	} else {
+		data, err = os.ReadFile(s.source)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load JWKS from %s: %w", s.source, err)
+	}
+
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+	return nil
+}
+
+// lookup returns the key with the ID, or the only key if kid is empty
+func (s *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Key returns the public key with the given ID, fetching the keys again if the
+// ID is unknown and they were loaded from a URL. Failed fetches count too, so
+// the URL is fetched at most once a minute however many tokens name unknown keys.
+func (s *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	if !s.isURL() {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+
+	s.refreshMu.Lock()
+	defer s.refreshMu.Unlock()
+	// The keys may have been fetched while waiting for the lock
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	if time.Since(s.attemptedAt) < minJWKSRefreshInterval {
+		return nil, fmt.Errorf("unknown key ID %q", kid)
+	}
+	if err := s.refresh(ctx); err != nil {
+		return nil, err
+	}
+	if key, ok := s.lookup(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
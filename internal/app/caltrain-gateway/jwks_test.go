@@ -0,0 +1,135 @@
+package caltraingateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseJWKS_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		contains string
+	}{
+		{name: "invalid JSON", data: `{"keys":`, contains: "failed to parse JWKS"},
+		{name: "no keys", data: `{"keys":[]}`, contains: "JWKS contains no signing keys"},
+		{name: "only encryption keys", data: `{"keys":[{"kty":"RSA","use":"enc","n":"AQAB","e":"AQAB"}]}`, contains: "JWKS contains no signing keys"},
+		{name: "unsupported key type", data: `{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`, contains: `unsupported key type "oct"`},
+		{name: "unsupported curve", data: `{"keys":[{"kty":"EC","crv":"P-192","x":"AA","y":"AA"}]}`, contains: `unsupported curve "P-192"`},
+		{name: "point not on curve", data: `{"keys":[{"kty":"EC","crv":"P-256","x":"AQ","y":"AQ"}]}`, contains: "failed to parse key 1 of JWKS"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJWKS([]byte(tt.data))
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			if !strings.Contains(err.Error(), tt.contains) {
+				t.Errorf("Expected error containing %q, got %q", tt.contains, err.Error())
+			}
+		})
+	}
+}
+
+func TestLoadJWKS_File(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	filename := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(filename, encodeJWKS(t, map[string]crypto.PublicKey{"main": &key.PublicKey}), 0o600); err != nil {
+		t.Fatalf("failed to write JWKS file: %v", err)
+	}
+
+	jwks, err := LoadJWKS(context.Background(), filename)
+	if err != nil {
+		t.Fatalf("LoadJWKS() error: %v", err)
+	}
+
+	loaded, err := jwks.Key(context.Background(), "main")
+	if err != nil {
+		t.Fatalf("Key() error: %v", err)
+	}
+	if !key.PublicKey.Equal(loaded) {
+		t.Error("Expected the loaded key to equal the generated key")
+	}
+	// Tokens without a key ID use the only key of the set
+	if _, err := jwks.Key(context.Background(), ""); err != nil {
+		t.Errorf("Expected the only key for an empty key ID, got %v", err)
+	}
+	if _, err := jwks.Key(context.Background(), "other"); err == nil || !strings.Contains(err.Error(), `unknown key ID "other"`) {
+		t.Errorf("Expected unknown key ID error, got %v", err)
+	}
+
+	if _, err := LoadJWKS(context.Background(), filepath.Join(t.TempDir(), "missing.json")); err == nil || !strings.Contains(err.Error(), "failed to load JWKS") {
+		t.Errorf("Expected error for missing file, got %v", err)
+	}
+}
+
+func TestJWKS_Key_FailingURL(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	var hits atomic.Int32
+	var failing atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if failing.Load() {
+			// Slow enough for the concurrent lookups below to overlap
+			time.Sleep(50 * time.Millisecond)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(encodeJWKS(t, map[string]crypto.PublicKey{"main": &key.PublicKey}))
+	}))
+	defer server.Close()
+
+	jwks, err := LoadJWKS(context.Background(), server.URL)
+	if err != nil {
+		t.Fatalf("LoadJWKS() error: %v", err)
+	}
+	failing.Store(true)
+	// Pretend the keys were fetched long enough ago to be fetched again
+	jwks.refreshMu.Lock()
+	jwks.attemptedAt = time.Now().Add(-minJWKSRefreshInterval)
+	jwks.refreshMu.Unlock()
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := jwks.Key(context.Background(), fmt.Sprintf("unknown-%d", i)); err == nil {
+				t.Error("Expected error for unknown key ID")
+			}
+		}()
+	}
+	wg.Wait()
+	for i := range 10 {
+		if _, err := jwks.Key(context.Background(), fmt.Sprintf("later-%d", i)); err == nil {
+			t.Error("Expected error for unknown key ID")
+		}
+	}
+
+	// One load and one failed refresh
+	if got := hits.Load(); got != 2 {
+		t.Errorf("Expected 2 requests to the JWKS URL, got %d", got)
+	}
+	if _, err := jwks.Key(context.Background(), "main"); err != nil {
+		t.Errorf("Expected the known key to stay available, got %v", err)
+	}
+}
@@ -2,25 +2,16 @@ package caltraingateway
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+
+	"caltrain-gateway/pkg/api"
 )
 
 // Line represents a transit line from the 511 API
-type Line struct {
-	ID            string `json:"Id"`
-	Name          string `json:"Name"`
-	FromDate      string `json:"FromDate"`
-	ToDate        string `json:"ToDate"`
-	TransportMode string `json:"TransportMode"`
-	PublicCode    string `json:"PublicCode"`
-	SiriLineRef   string `json:"SiriLineRef"`
-	Monitored     bool   `json:"Monitored"`
-	OperatorRef   string `json:"OperatorRef"`
-}
+type Line = api.Line
 
 // LoadLinesFromFile reads and parses a lines JSON file from the given filename.
 func LoadLinesFromFile(filename string) ([]Line, error) {
@@ -34,20 +25,10 @@ func LoadLinesFromFile(filename string) ([]Line, error) {
 
 // LoadLinesFromURL fetches and parses lines JSON from the given URL.
 func LoadLinesFromURL(url string) ([]Line, error) {
-	resp, err := http.Get(url)
+	data, _, err := fetchURL(context.Background(), url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch lines from URL: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
 
 	return parseLinesJSON(data)
 }
@@ -83,3 +64,13 @@ func GetMonitoredLines(lines []Line) []Line {
 	}
 	return monitored
 }
+
+// FindLine returns the line with the given ID
+func FindLine(lines []Line, id string) (Line, bool) {
+	for _, line := range lines {
+		if line.ID == id {
+			return line, true
+		}
+	}
+	return Line{}, false
+}
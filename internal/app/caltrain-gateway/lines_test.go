@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
 )
@@ -132,3 +133,76 @@ func TestGetMonitoredLines(t *testing.T) {
 		t.Errorf("expected 5 monitored lines, got %d", len(monitored))
 	}
 }
+
+func TestLineValidity(t *testing.T) {
+	line := caltraingateway.Line{
+		ID:       "Limited",
+		FromDate: "2026-01-31T00:00:00-08:00",
+		ToDate:   "2026-08-31T23:59:00-08:00",
+	}
+
+	t.Run("IsValidAt", func(t *testing.T) {
+		tests := []struct {
+			at       string
+			expected bool
+		}{
+			{"2026-01-30T23:59:59-08:00", false},
+			{"2026-01-31T00:00:00-08:00", true},
+			{"2026-05-01T12:00:00Z", true},
+			{"2026-08-31T23:59:00-08:00", true},
+			{"2026-09-01T08:00:00Z", false},
+		}
+		for _, tt := range tests {
+			at, err := time.Parse(time.RFC3339, tt.at)
+			if err != nil {
+				t.Fatalf("invalid test time %s: %v", tt.at, err)
+			}
+			if got := line.IsValidAt(at); got != tt.expected {
+				t.Errorf("IsValidAt(%s) = %v, want %v", tt.at, got, tt.expected)
+			}
+		}
+	})
+
+	t.Run("IsValidOn", func(t *testing.T) {
+		tests := []struct {
+			date     string
+			expected bool
+		}{
+			{"2026-01-30", false},
+			{"2026-01-31", true},
+			{"2026-08-31", true},
+			{"2026-09-01", false},
+		}
+		for _, tt := range tests {
+			if got := line.IsValidOn(tt.date); got != tt.expected {
+				t.Errorf("IsValidOn(%s) = %v, want %v", tt.date, got, tt.expected)
+			}
+		}
+	})
+
+	t.Run("missing dates are unbounded", func(t *testing.T) {
+		open := caltraingateway.Line{ID: "Open"}
+		if !open.IsValidAt(time.Now()) || !open.IsValidOn("2030-01-01") {
+			t.Error("expected line without dates to always be valid")
+		}
+	})
+}
+
+func TestFindLine(t *testing.T) {
+	lines, err := caltraingateway.LoadLinesFromFile("example_lines.json")
+	if err != nil {
+		t.Fatalf("failed to load lines: %v", err)
+	}
+
+	line, ok := caltraingateway.FindLine(lines, "Local Weekday")
+	if !ok {
+		t.Fatal("expected to find line 'Local Weekday'")
+	}
+	if line.SiriLineRef != "LOC" {
+		t.Errorf("expected SiriLineRef 'LOC', got '%s'", line.SiriLineRef)
+	}
+
+	if _, ok := caltraingateway.FindLine(lines, "Bullet"); ok {
+		t.Error("expected line 'Bullet' not to be found")
+	}
+}
@@ -0,0 +1,425 @@
+package caltraingateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// fetchURL performs a GET request and returns the response body if the status is 200 OK.
+// The status code is 0 if no response was received.
+func fetchURL(ctx context.Context, url string) ([]byte, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, redactError(err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// The URL in the error carries the API key
+		return nil, 0, redactError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("failed to read response body: %w", err)
+	}
+	return data, resp.StatusCode, nil
+}
+
+// sleep pauses for d or until the context is cancelled
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Loader fetches lines and timetables for an operator from the 511 API,
+// or reads them from a data directory
+type Loader struct {
+	BaseURL string
+	APIKey  string
+	// Keys hands out an API key for each request instead of APIKey if set
+	Keys *KeyPool
+	// Dir is a data directory to load operators from instead of the 511 API
+	Dir string
+	// Delay is the pause before each timetable request to respect rate limiting
+	Delay time.Duration
+	// Metrics records the latency of 511 requests if set
+	Metrics *Metrics
+	// TracerProvider creates the spans of loads. The global provider is used if nil.
+	TracerProvider trace.TracerProvider
+
+	reloadOnce sync.Once
+	reload     chan struct{}
+}
+
+// reloads returns the channel that signals Run to reload immediately
+func (l *Loader) reloads() chan struct{} {
+	l.reloadOnce.Do(func() {
+		l.reload = make(chan struct{}, 1)
+	})
+	return l.reload
+}
+
+// Reload asks Run to reload every operator immediately.
+// It returns false if a reload is already pending.
+func (l *Loader) Reload() bool {
+	select {
+	case l.reloads() <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// fetch requests the given 511 endpoint within a client span and records its latency
+func (l *Loader) fetch(ctx context.Context, endpoint string, url string) (data []byte, err error) {
+	ctx, span := newTracer(l.TracerProvider).Start(ctx, "511 GET "+endpoint,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("http.request.method", http.MethodGet), attribute.String("upstream.endpoint", endpoint)),
+	)
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	data, status, err := fetchURL(ctx, url)
+	l.Metrics.observeUpstream(endpoint, status, time.Since(start))
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	return data, err
+}
+
+// apiKey returns the API key for the next request, waiting for a key of the pool to have a token
+func (l *Loader) apiKey(ctx context.Context) (string, error) {
+	if l.Keys == nil {
+		return l.APIKey, nil
+	}
+	key, err := l.Keys.WaitAvailableKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	return key.Value, nil
+}
+
+// get requests the given 511 endpoint for an operator with the next API key
+func (l *Loader) get(ctx context.Context, path string, operatorID string, params url.Values) ([]byte, error) {
+	apiKey, err := l.apiKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+	u, err := l.buildURL(path, operatorID, params, apiKey)
+	if err != nil {
+		return nil, err
+	}
+	return l.fetch(ctx, path, u)
+}
+
+// buildURL returns the URL of the given 511 endpoint with the operator, format and API key set
+func (l *Loader) buildURL(path string, operatorID string, params url.Values, apiKey string) (string, error) {
+	u, err := url.Parse(l.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse base API URL: %w", err)
+	}
+
+	u.Path = path
+	q := u.Query()
+	for k, vs := range params {
+		for _, v := range vs {
+			q.Add(k, v)
+		}
+	}
+	q.Set("operator_id", operatorID)
+	q.Set("format", "json")
+	q.Set("api_key", apiKey)
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// LoadLines loads all lines of an operator from the API
+func (l *Loader) LoadLines(ctx context.Context, operatorID string) ([]Line, error) {
+	log.Printf("Loading lines for operator %s from API ...", operatorID)
+	data, err := l.get(ctx, "transit/lines", operatorID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lines: %w", err)
+	}
+	lines, err := parseLinesJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lines: %w", err)
+	}
+	log.Printf("Loaded %d lines for operator %s", len(lines), operatorID)
+	return lines, nil
+}
+
+// LoadStops loads all stops of an operator from the API
+func (l *Loader) LoadStops(ctx context.Context, operatorID string) ([]Stop, error) {
+	log.Printf("Loading stops for operator %s from API ...", operatorID)
+	data, err := l.get(ctx, "transit/stops", operatorID, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stops: %w", err)
+	}
+	stops, err := ParseStops(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load stops: %w", err)
+	}
+	log.Printf("Loaded %d stops for operator %s", len(stops), operatorID)
+	return stops, nil
+}
+
+// LoadTimetables loads the timetable of each line into a new collection.
+// Lines whose timetable fails to load are skipped with a warning.
+func (l *Loader) LoadTimetables(ctx context.Context, operatorID string, lines []Line) (*TimetableCollection, error) {
+	tc := NewTimetableCollection()
+
+	for _, line := range lines {
+		if err := sleep(ctx, l.Delay); err != nil {
+			return nil, err
+		}
+
+		log.Printf("Loading timetable for operator %s line: %s", operatorID, line.ID)
+		data, err := l.get(ctx, "transit/timetable", operatorID, url.Values{"line_id": {line.ID}})
+		if err == nil {
+			var tt *Timetable
+			if tt, err = parseTimetableJSON(data); err == nil {
+				tc.AddTimetable(tt)
+				continue
+			}
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Warning: Failed to load timetable for operator %s line %s: %v", operatorID, line.ID, err)
+	}
+
+	return tc, nil
+}
+
+// LoadOperator loads all lines and stops of an operator and then the timetable for each line.
+// Stops are optional: if they fail to load, the dataset is returned without stop names.
+func (l *Loader) LoadOperator(ctx context.Context, operatorID string) (dataset *Dataset, err error) {
+	ctx, span := newTracer(l.TracerProvider).Start(ctx, "load operator", trace.WithAttributes(attribute.String("operator.id", operatorID)))
+	defer func() { endSpan(span, err) }()
+
+	if l.Dir != "" {
+		return LoadDatasetDir(OperatorDir(l.Dir, operatorID))
+	}
+
+	lines, err := l.LoadLines(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sleep(ctx, l.Delay); err != nil {
+		return nil, err
+	}
+	stops, err := l.LoadStops(ctx, operatorID)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		log.Printf("Warning: Failed to load stops for operator %s: %v", operatorID, err)
+	}
+
+	tc, err := l.LoadTimetables(ctx, operatorID, lines)
+	if err != nil {
+		return nil, err
+	}
+	return &Dataset{Lines: lines, Stops: stops, Timetables: tc}, nil
+}
+
+// ErrPartialFetch is returned by FetchOperator when the stops or some timetables
+// of an operator failed to download
+var ErrPartialFetch = errors.New("partial fetch")
+
+// FetchOperator downloads the lines, stops and timetables of an operator into
+// dir in the data directory layout read by LoadDatasetDir. The files are written
+// to a temporary directory first, which then replaces dir.
+// Stops and timetables that fail to load keep their previous file in dir, and
+// the fetch then returns an error wrapping ErrPartialFetch. If no timetable
+// loads at all, dir is left untouched.
+func (l *Loader) FetchOperator(ctx context.Context, operatorID string, dir string) (err error) {
+	ctx, span := newTracer(l.TracerProvider).Start(ctx, "fetch operator", trace.WithAttributes(attribute.String("operator.id", operatorID)))
+	defer func() { endSpan(span, err) }()
+
+	log.Printf("Fetching lines for operator %s from API ...", operatorID)
+	linesData, err := l.get(ctx, "transit/lines", operatorID, nil)
+	if err != nil {
+		return fmt.Errorf("failed to fetch lines: %w", err)
+	}
+	lines, err := parseLinesJSON(linesData)
+	if err != nil {
+		return fmt.Errorf("failed to fetch lines: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0o755); err != nil {
+		return fmt.Errorf("failed to create data directory: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), "."+filepath.Base(dir)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := os.Mkdir(filepath.Join(tmp, timetablesDirName), 0o755); err != nil {
+		return fmt.Errorf("failed to create timetables directory: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tmp, linesFileName), linesData, 0o644); err != nil {
+		return fmt.Errorf("failed to write lines: %w", err)
+	}
+
+	if err := sleep(ctx, l.Delay); err != nil {
+		return err
+	}
+	log.Printf("Fetching stops for operator %s from API ...", operatorID)
+	stopsData, err := l.get(ctx, "transit/stops", operatorID, nil)
+	if err == nil {
+		_, err = ParseStops(stopsData)
+	}
+	stopsFailed := err != nil
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case stopsFailed:
+		log.Printf("Warning: Failed to fetch stops for operator %s: %v", operatorID, err)
+		if err := keepPreviousFile(dir, tmp, stopsFileName); err != nil {
+			return fmt.Errorf("failed to keep previous stops: %w", err)
+		}
+	default:
+		if err := os.WriteFile(filepath.Join(tmp, stopsFileName), stopsData, 0o644); err != nil {
+			return fmt.Errorf("failed to write stops: %w", err)
+		}
+	}
+
+	fetched := 0
+	for _, line := range lines {
+		if err := sleep(ctx, l.Delay); err != nil {
+			return err
+		}
+
+		log.Printf("Fetching timetable for operator %s line: %s", operatorID, line.ID)
+		data, err := l.get(ctx, "transit/timetable", operatorID, url.Values{"line_id": {line.ID}})
+		if err == nil {
+			_, err = parseTimetableJSON(data)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		name := filepath.Join(timetablesDirName, timetableFileName(line.ID))
+		if err != nil {
+			log.Printf("Warning: Failed to fetch timetable for operator %s line %s: %v", operatorID, line.ID, err)
+			if err := keepPreviousFile(dir, tmp, name); err != nil {
+				return fmt.Errorf("failed to keep previous timetable of line %s: %w", line.ID, err)
+			}
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(tmp, name), data, 0o644); err != nil {
+			return fmt.Errorf("failed to write timetable of line %s: %w", line.ID, err)
+		}
+		fetched++
+	}
+	if fetched == 0 {
+		return fmt.Errorf("failed to fetch timetables of all %d lines", len(lines))
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", dir, err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", dir, err)
+	}
+	log.Printf("Fetched %d lines and %d timetables for operator %s into %s", len(lines), fetched, operatorID, dir)
+
+	switch {
+	case stopsFailed && fetched < len(lines):
+		return fmt.Errorf("%w: failed to fetch stops and timetables of %d of %d lines", ErrPartialFetch, len(lines)-fetched, len(lines))
+	case stopsFailed:
+		return fmt.Errorf("%w: failed to fetch stops", ErrPartialFetch)
+	case fetched < len(lines):
+		return fmt.Errorf("%w: failed to fetch timetables of %d of %d lines", ErrPartialFetch, len(lines)-fetched, len(lines))
+	}
+	return nil
+}
+
+// keepPreviousFile copies the file name from the previous fetch in dir to tmp,
+// if there is one
+func keepPreviousFile(dir, tmp, name string) error {
+	data, err := os.ReadFile(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(tmp, name), data, 0o644)
+}
+
+// LoadAll loads every operator of the store and replaces its snapshot.
+// Operators that fail to load keep their previous snapshot.
+func (l *Loader) LoadAll(ctx context.Context, store *Store) {
+	for i, operator := range store.Operators() {
+		if i > 0 {
+			if err := sleep(ctx, l.Delay); err != nil {
+				return
+			}
+		}
+
+		data, err := l.LoadOperator(ctx, operator.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Warning: Failed to load timetables for operator %s: %v", operator.ID, err)
+			store.RecordFailure(operator.ID, err)
+			continue
+		}
+		store.Set(operator.ID, data)
+		log.Printf("Timetables for operator %s loaded successfully", operator.ID)
+	}
+}
+
+// Run loads every operator of the store and then reloads them every interval
+// and whenever Reload is called, until the context is cancelled.
+// An interval of zero disables the periodic reloads.
+func (l *Loader) Run(ctx context.Context, store *Store, interval time.Duration) {
+	l.LoadAll(ctx, store)
+
+	var tick <-chan time.Time
+	if interval > 0 {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			l.LoadAll(ctx, store)
+		case <-l.reloads():
+			log.Println("Reloading timetables on request")
+			l.LoadAll(ctx, store)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package caltraingateway_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+// newMock511Server serves the example lines and timetable for the given operator
+func newMock511Server(t *testing.T, operatorID string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(newMock511Handler(t, operatorID))
+}
+
+// newMock511Handler serves the example lines and timetable for the given operator
+func newMock511Handler(t *testing.T, operatorID string) http.Handler {
+	t.Helper()
+
+	lines, err := os.ReadFile("example_lines.json")
+	if err != nil {
+		t.Fatalf("failed to read example lines: %v", err)
+	}
+	stops, err := os.ReadFile("example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to read example stops: %v", err)
+	}
+	timetable, err := os.ReadFile("example_timetable.json")
+	if err != nil {
+		t.Fatalf("failed to read example timetable: %v", err)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("api_key") != "loader-key" || q.Get("operator_id") != operatorID || q.Get("format") != "json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/transit/lines":
+			w.Write(lines)
+		case "/transit/stops":
+			w.Write(stops)
+		case "/transit/timetable":
+			// Only the Limited line has a timetable
+			if q.Get("line_id") != "Limited" {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(timetable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+}
+
+func TestLoaderLoadOperator(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+	}
+
+	data, err := loader.LoadOperator(context.Background(), "CT")
+	if err != nil {
+		t.Fatalf("failed to load operator: %v", err)
+	}
+
+	if len(data.Lines) != 5 {
+		t.Errorf("expected 5 lines, got %d", len(data.Lines))
+	}
+	if len(data.Stops) != 32 {
+		t.Errorf("expected 32 stops, got %d", len(data.Stops))
+	}
+
+	departures := data.Timetables.GetDeparturesByStop()
+	if len(departures["70261"]) == 0 {
+		t.Error("expected departures for stop 70261")
+	}
+}
+
+func TestLoaderLoadOperator_LinesError(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+	}
+
+	// The mock server rejects requests for other operators
+	if _, err := loader.LoadOperator(context.Background(), "BA"); err == nil {
+		t.Error("expected error when lines cannot be loaded")
+	}
+}
+
+func TestLoaderLoadOperator_RedactsAPIKey(t *testing.T) {
+	// A closed server makes the request fail with the URL in the error
+	mockAPI := httptest.NewServer(http.NotFoundHandler())
+	mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+	}
+
+	_, err := loader.LoadOperator(context.Background(), "CT")
+	if err == nil {
+		t.Fatal("expected error when the API is unreachable")
+	}
+	if strings.Contains(err.Error(), "loader-key") {
+		t.Errorf("expected the API key to be redacted, got %q", err)
+	}
+}
+
+func TestLoaderLoadOperator_SkipsDisabledKeys(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	// The mock server rejects the first key, as 511 would after revoking it
+	keys := caltraingateway.NewKeyPool([]string{"revoked-key", "loader-key"}, 100, 10)
+	revoked, _ := keys.Key(1)
+	revoked.SetEnabled(false)
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		Keys:    keys,
+	}
+
+	if _, err := loader.LoadOperator(context.Background(), "CT"); err != nil {
+		t.Fatalf("expected the load to use the enabled key only, got %v", err)
+	}
+	if revoked.Used() != 0 {
+		t.Errorf("expected the disabled key not to be used, got %d requests", revoked.Used())
+	}
+}
+
+func TestLoaderLoadAll(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+	}
+	store := caltraingateway.NewStore(caltraingateway.NewOperators([]string{"CT", "BA"}))
+
+	loader.LoadAll(context.Background(), store)
+
+	snapshot := store.Snapshot("CT")
+	if snapshot == nil {
+		t.Fatal("expected CT to be loaded")
+	}
+	if snapshot.StopName("70011") != "San Francisco Caltrain Station Northbound" {
+		t.Errorf("expected stop name for 70011, got '%s'", snapshot.StopName("70011"))
+	}
+	// The mock server rejects requests for BA, so it stays unloaded
+	if store.Snapshot("BA") != nil {
+		t.Error("expected BA not to be loaded")
+	}
+	if store.LastFailure("BA") == nil {
+		t.Error("expected the failed load of BA to be recorded")
+	}
+}
+
+func TestLoaderRun_StopsOnCancel(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+		Delay:   time.Hour,
+	}
+	store := caltraingateway.NewStore(caltraingateway.NewOperators([]string{"CT"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		loader.Run(ctx, store, time.Hour)
+		close(done)
+	}()
+
+	// The loader is now waiting for the delay between requests
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected loader to stop after the context was cancelled")
+	}
+	if store.Snapshot("CT") != nil {
+		t.Error("expected no snapshot after cancelling the load")
+	}
+}
+
+func TestLoaderRun_Reload(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		APIKey:  "loader-key",
+	}
+	store := caltraingateway.NewStore(caltraingateway.NewOperators([]string{"CT"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go loader.Run(ctx, store, 0)
+
+	// waitForLoad waits until a snapshot newer than the given time is loaded
+	waitForLoad := func(after time.Time) time.Time {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if snapshot := store.Snapshot("CT"); snapshot != nil && snapshot.LoadedAt.After(after) {
+				return snapshot.LoadedAt
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatal("expected CT to be loaded")
+		return time.Time{}
+	}
+
+	loadedAt := waitForLoad(time.Time{})
+	if !loader.Reload() {
+		t.Fatal("expected the reload to be queued")
+	}
+	waitForLoad(loadedAt)
+}
+
+func TestLoaderFetchOperator(t *testing.T) {
+	mockAPI := newMock511Server(t, "CT")
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		Keys:    caltraingateway.NewKeyPool([]string{"loader-key"}, 100, 1),
+	}
+	dataDir := t.TempDir()
+	dir := caltraingateway.OperatorDir(dataDir, "CT")
+	if err := os.MkdirAll(filepath.Join(dir, "timetables"), 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	stale := filepath.Join(dir, "timetables", "Removed.json")
+	if err := os.WriteFile(stale, []byte("{}"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	// Not a valid timetable, so the dataset below only loads the fetched one
+	previous := filepath.Join(dir, "timetables", "Express.json")
+	if err := os.WriteFile(previous, []byte("previous"), 0o644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// Only the Limited line has a timetable, so the other four fail
+	err := loader.FetchOperator(context.Background(), "CT", dir)
+	if !errors.Is(err, caltraingateway.ErrPartialFetch) {
+		t.Fatalf("Expected partial fetch error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "4 of 5 lines") {
+		t.Errorf("Expected error to count the failed lines, got %v", err)
+	}
+
+	data, err := caltraingateway.LoadDatasetDir(dir)
+	if err != nil {
+		t.Fatalf("failed to load fetched operator: %v", err)
+	}
+	if len(data.Lines) != 5 || len(data.Stops) != 32 {
+		t.Errorf("expected 5 lines and 32 stops, got %d and %d", len(data.Lines), len(data.Stops))
+	}
+	if data.Timetables.Len() != 1 {
+		t.Errorf("expected 1 timetable, got %d", data.Timetables.Len())
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("expected files of the previous fetch to be removed")
+	}
+	if data, err := os.ReadFile(previous); err != nil || string(data) != "previous" {
+		t.Errorf("expected the previous timetable of a failed line to be kept, got %q, %v", data, err)
+	}
+	entries, _ := os.ReadDir(dataDir)
+	if len(entries) != 1 {
+		t.Errorf("expected only the operator directory to be left, got %d entries", len(entries))
+	}
+
+	// A failed fetch leaves the previous files in place
+	if err := loader.FetchOperator(context.Background(), "BA", dir); err == nil {
+		t.Error("expected error when lines cannot be fetched")
+	}
+	if _, err := caltraingateway.LoadDatasetDir(dir); err != nil {
+		t.Errorf("expected the previous fetch to be kept, got %v", err)
+	}
+}
+
+func TestLoaderFetchOperator_NoTimetables(t *testing.T) {
+	mock := newMock511Handler(t, "CT")
+	var failTimetables atomic.Bool
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failTimetables.Load() && r.URL.Path == "/transit/timetable" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mock.ServeHTTP(w, r)
+	}))
+	defer mockAPI.Close()
+
+	loader := &caltraingateway.Loader{
+		BaseURL: mockAPI.URL + "/",
+		Keys:    caltraingateway.NewKeyPool([]string{"loader-key"}, 100, 1),
+	}
+	dir := caltraingateway.OperatorDir(t.TempDir(), "CT")
+	if err := loader.FetchOperator(context.Background(), "CT", dir); !errors.Is(err, caltraingateway.ErrPartialFetch) {
+		t.Fatalf("Expected partial fetch error, got %v", err)
+	}
+	limited := filepath.Join(dir, "timetables", "Limited.json")
+	before, err := os.ReadFile(limited)
+	if err != nil {
+		t.Fatalf("failed to read timetable: %v", err)
+	}
+
+	// Every timetable fails once the API stops serving them
+	failTimetables.Store(true)
+	err = loader.FetchOperator(context.Background(), "CT", dir)
+	if err == nil || errors.Is(err, caltraingateway.ErrPartialFetch) {
+		t.Fatalf("Expected error when no timetable can be fetched, got %v", err)
+	}
+	after, err := os.ReadFile(limited)
+	if err != nil {
+		t.Fatalf("Expected the previous fetch to be kept, got %v", err)
+	}
+	if string(after) != string(before) {
+		t.Error("Expected the previous timetable to be unchanged")
+	}
+}
@@ -0,0 +1,217 @@
+package caltraingateway
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// requestIDHeader carries the request ID between clients, the gateway and its logs
+	requestIDHeader = "X-Request-ID"
+	// maxRequestIDLength bounds propagated request IDs so clients cannot flood the logs
+	maxRequestIDLength = 128
+	// redacted replaces secret values in logs
+	redacted = "REDACTED"
+)
+
+// redactedParams are query parameters whose values never appear in logs
+var redactedParams = []string{"api_key"}
+
+// redactedParamPattern matches the values of redacted parameters in URLs within
+// free text such as error messages
+var redactedParamPattern = regexp.MustCompile(`\b(` + strings.Join(redactedParams, "|") + `)=[^&#\s"]*`)
+
+// NewLogger creates a logger writing to w in the given format ("text" or "json")
+// for records at or above the given level ("debug", "info", "warn" or "error")
+func NewLogger(w io.Writer, format string, level string) (*slog.Logger, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+}
+
+// redactQuery returns the encoded query with the values of secret parameters replaced
+func redactQuery(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	q, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		// Do not risk logging a secret that could not be parsed out
+		return redacted
+	}
+	for _, param := range redactedParams {
+		if _, ok := q[param]; ok {
+			q.Set(param, redacted)
+		}
+	}
+	return q.Encode()
+}
+
+// redactURL returns the path and query of the URL with secret parameters redacted
+func redactURL(u *url.URL) string {
+	if query := redactQuery(u.RawQuery); query != "" {
+		return u.Path + "?" + query
+	}
+	return u.Path
+}
+
+// redactedError is an error whose message has secret values redacted
+type redactedError struct {
+	msg string
+	err error
+}
+
+func (e *redactedError) Error() string { return e.msg }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+// redactError returns the error with the values of secret parameters in its
+// message redacted, like the 511 URL of a failed *url.Error.
+// The result still unwraps to err, so errors.Is keeps working.
+func redactError(err error) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	if redactedMsg := redactedParamPattern.ReplaceAllString(msg, "${1}="+redacted); redactedMsg != msg {
+		return &redactedError{msg: redactedMsg, err: err}
+	}
+	return err
+}
+
+// newRequestID returns a random 128-bit request ID in hex
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether a client-supplied request ID is safe to propagate
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestLogKey is the context key of a request's log state
+type requestLogKey struct{}
+
+// requestLog collects the request ID and the attributes handlers add while serving a request
+type requestLog struct {
+	id     string
+	logger *slog.Logger
+
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// requestLogFrom returns the log state of the request's context, or nil if it is not logged
+func requestLogFrom(ctx context.Context) *requestLog {
+	rl, _ := ctx.Value(requestLogKey{}).(*requestLog)
+	return rl
+}
+
+// RequestID returns the ID of the request the context belongs to, or an empty string
+func RequestID(ctx context.Context) string {
+	if rl := requestLogFrom(ctx); rl != nil {
+		return rl.id
+	}
+	return ""
+}
+
+// loggerFrom returns a logger tagged with the request ID of the context
+func loggerFrom(ctx context.Context) *slog.Logger {
+	if rl := requestLogFrom(ctx); rl != nil {
+		return rl.logger
+	}
+	return slog.Default()
+}
+
+// addLogAttrs adds attributes to the access log entry of the request the context belongs to
+func addLogAttrs(ctx context.Context, attrs ...slog.Attr) {
+	rl := requestLogFrom(ctx)
+	if rl == nil {
+		return
+	}
+	rl.mu.Lock()
+	rl.attrs = append(rl.attrs, attrs...)
+	rl.mu.Unlock()
+}
+
+// logRequestMiddleware assigns each request an ID, taken from the X-Request-ID
+// header if the client sent a valid one, echoes it in the response and writes
+// one access log entry per request once it has been served
+func logRequestMiddleware(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		// Capture the request line before handlers get a chance to modify it
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("query", redactQuery(r.URL.RawQuery)),
+			slog.String("remote_addr", r.RemoteAddr),
+		}
+
+		rl := &requestLog{id: id, logger: logger.With("request_id", id)}
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl))
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		attrs = append(attrs,
+			slog.Int("status", rec.Status()),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+		)
+		if route := r.Pattern; route != "" {
+			attrs = append(attrs, slog.String("route", route))
+		}
+		if sc := trace.SpanContextFromContext(r.Context()); sc.IsValid() {
+			attrs = append(attrs, slog.String("trace_id", sc.TraceID().String()))
+		}
+		rl.mu.Lock()
+		attrs = append(attrs, rl.attrs...)
+		rl.mu.Unlock()
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		rl.logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
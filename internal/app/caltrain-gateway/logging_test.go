@@ -0,0 +1,205 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRedactQuery(t *testing.T) {
+	tests := []struct {
+		name     string
+		rawQuery string
+		expected string
+	}{
+		{name: "empty", rawQuery: "", expected: ""},
+		{name: "no secret", rawQuery: "agency=CT&format=json", expected: "agency=CT&format=json"},
+		{name: "api key", rawQuery: "agency=CT&api_key=secret123", expected: "agency=CT&api_key=REDACTED"},
+		{name: "repeated api key", rawQuery: "api_key=a&api_key=b", expected: "api_key=REDACTED"},
+		{name: "unparsable", rawQuery: "api_key=%zz", expected: "REDACTED"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactQuery(tt.rawQuery); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRedactError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{name: "no secret", err: errors.New("unexpected status code: 500"), expected: "unexpected status code: 500"},
+		{name: "request error", err: &url.Error{Op: "Get", URL: "http://511.example/transit/lines?api_key=secret123&format=json", Err: errors.New("connection refused")}, expected: `Get "http://511.example/transit/lines?api_key=REDACTED&format=json": connection refused`},
+		{name: "wrapped", err: fmt.Errorf("failed to load lines: %w", errors.New(`Get "/lines?format=json&api_key=secret123": EOF`)), expected: `failed to load lines: Get "/lines?format=json&api_key=REDACTED": EOF`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactError(tt.err)
+			if got.Error() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got.Error())
+			}
+			if !errors.Is(got, tt.err) {
+				t.Error("Expected the redacted error to wrap the original error")
+			}
+		})
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	if _, err := NewLogger(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("Expected error for invalid format, got nil")
+	}
+	if _, err := NewLogger(&bytes.Buffer{}, "json", "verbose"); err == nil {
+		t.Error("Expected error for invalid level, got nil")
+	}
+
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("NewLogger() error: %v", err)
+	}
+	logger.Info("dropped")
+	logger.Warn("kept")
+	if strings.Contains(buf.String(), "dropped") || !strings.Contains(buf.String(), `"msg":"kept"`) {
+		t.Errorf("Expected only the warning in JSON, got %q", buf.String())
+	}
+}
+
+// decodeLogLine parses a single JSON log record
+func decodeLogLine(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("failed to decode log record %q: %v", buf.String(), err)
+	}
+	return record
+}
+
+func TestLogRequestMiddleware_RequestID(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		propagate bool
+	}{
+		{name: "generated", requestID: "", propagate: false},
+		{name: "propagated", requestID: "abc-123", propagate: true},
+		{name: "invalid replaced", requestID: "bad id\n", propagate: false},
+		{name: "too long replaced", requestID: strings.Repeat("a", maxRequestIDLength+1), propagate: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			var seen string
+			handler := logRequestMiddleware(slog.New(slog.NewJSONHandler(&buf, nil)), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = RequestID(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/up", nil)
+			if tt.requestID != "" {
+				req.Header.Set(requestIDHeader, tt.requestID)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			id := rec.Header().Get(requestIDHeader)
+			if id == "" {
+				t.Fatal("Expected X-Request-ID response header")
+			}
+			if tt.propagate && id != tt.requestID {
+				t.Errorf("Expected request ID %q, got %q", tt.requestID, id)
+			}
+			if !tt.propagate && id == tt.requestID {
+				t.Errorf("Expected a generated request ID, got %q", id)
+			}
+			if seen != id {
+				t.Errorf("Expected handler to see request ID %q, got %q", id, seen)
+			}
+			if record := decodeLogLine(t, &buf); record["request_id"] != id {
+				t.Errorf("Expected logged request_id %q, got %v", id, record["request_id"])
+			}
+		})
+	}
+}
+
+func TestLogRequestMiddleware_Proxy(t *testing.T) {
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer mockAPI.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	keyPool := NewKeyPool([]string{"first-key", "second-key"}, 100, 10)
+	handler := logRequestMiddleware(logger, proxyHandler(keyPool, mockAPI.URL+"/", NewResponseCache(time.Minute, time.Minute), DefaultCompressionPolicy(), nil, newTracer(nil)))
+
+	req := httptest.NewRequest("GET", "/transit/stops?agency=CT&api_key=client-secret", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	output := buf.String()
+	for _, secret := range []string{"client-secret", "first-key", "second-key"} {
+		if strings.Contains(output, secret) {
+			t.Errorf("Expected logs not to contain %q, got %q", secret, output)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	last := bytes.NewBufferString(lines[len(lines)-1])
+	record := decodeLogLine(t, last)
+	expected := map[string]any{
+		"msg":       "request",
+		"method":    "GET",
+		"path":      "/transit/stops",
+		"query":     "agency=CT&api_key=REDACTED",
+		"status":    float64(http.StatusOK),
+		"bytes":     float64(len(`{"status": "ok"}`)),
+		"cache":     "miss",
+		"key_index": float64(1),
+	}
+	for k, v := range expected {
+		if record[k] != v {
+			t.Errorf("Expected %s=%v, got %v", k, v, record[k])
+		}
+	}
+	if _, ok := record["duration"]; !ok {
+		t.Error("Expected duration to be logged")
+	}
+}
+
+func TestLogRequestMiddleware_UpstreamError(t *testing.T) {
+	// A closed server makes the upstream request fail with the URL in the error
+	mockAPI := httptest.NewServer(http.NotFoundHandler())
+	mockAPI.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	keyPool := NewKeyPool([]string{"upstream-key"}, 100, 10)
+	handler := logRequestMiddleware(logger, proxyHandler(keyPool, mockAPI.URL+"/", NewResponseCache(time.Minute, time.Minute), DefaultCompressionPolicy(), nil, newTracer(nil)))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/transit/stops?agency=CT", nil))
+
+	if rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected status %d, got %d", http.StatusBadGateway, rec.Code)
+	}
+	record := decodeLogLine(t, &buf)
+	logged, _ := record["error"].(string)
+	if strings.Contains(logged, "upstream-key") || !strings.Contains(logged, "api_key=REDACTED") {
+		t.Errorf("Expected the logged error to have the API key redacted, got %q", logged)
+	}
+}
@@ -0,0 +1,211 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const metricsNamespace = "caltrain_gateway"
+
+// Metrics collects Prometheus metrics for the gateway.
+// All methods are safe to call on a nil *Metrics, which disables collection.
+type Metrics struct {
+	registry         *prometheus.Registry
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	cacheLookups     *prometheus.CounterVec
+	collapsed        prometheus.Counter
+	upstreamRequests *prometheus.HistogramVec
+}
+
+// NewMetrics creates the gateway metrics and registers collectors for the key pool and the store
+func NewMetrics(pool *KeyPool, store *Store) *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Latency of HTTP requests by route, method and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method", "status"}),
+		cacheLookups: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "proxy_cache_lookups_total",
+			Help:      "Proxy cache lookups by result (hit, miss or stale).",
+		}, []string{"result"}),
+		collapsed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Name:      "proxy_collapsed_requests_total",
+			Help:      "Proxy requests that shared an in-flight upstream request.",
+		}),
+		upstreamRequests: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Name:      "upstream_request_duration_seconds",
+			Help:      "Latency of 511 API requests by endpoint and status code. Status is \"error\" if no response was received.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"endpoint", "status"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.cacheLookups,
+		m.collapsed,
+		m.upstreamRequests,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if pool != nil {
+		m.registry.MustRegister(&keyPoolCollector{pool: pool})
+	}
+	if store != nil {
+		m.registry.MustRegister(&storeCollector{store: store})
+	}
+	return m
+}
+
+// Handler returns the HTTP handler serving the metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// observeRequest records a served HTTP request
+func (m *Metrics) observeRequest(route, method string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	labels := prometheus.Labels{"route": route, "method": method, "status": strconv.Itoa(status)}
+	m.requests.With(labels).Inc()
+	m.requestDuration.With(labels).Observe(duration.Seconds())
+}
+
+// observeCacheLookup records the result of a proxy cache lookup
+func (m *Metrics) observeCacheLookup(status cacheStatus) {
+	if m == nil {
+		return
+	}
+	m.cacheLookups.WithLabelValues(string(status)).Inc()
+}
+
+// observeCollapsed records a proxy request that shared an in-flight upstream request
+func (m *Metrics) observeCollapsed() {
+	if m == nil {
+		return
+	}
+	m.collapsed.Inc()
+}
+
+// observeUpstream records a request to the 511 API. A status of 0 means no response was received.
+func (m *Metrics) observeUpstream(endpoint string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	statusLabel := "error"
+	if status != 0 {
+		statusLabel = strconv.Itoa(status)
+	}
+	m.upstreamRequests.WithLabelValues(endpoint, statusLabel).Observe(duration.Seconds())
+}
+
+// metricsMiddleware records the count and latency of requests by matched route
+func metricsMiddleware(m *Metrics, next http.Handler) http.Handler {
+	if m == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		// The mux sets the matched pattern on the request
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+		m.observeRequest(route, r.Method, rec.Status(), time.Since(start))
+	})
+}
+
+var (
+	keyRequestsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "api_key", "requests_total"),
+		"Requests made with each 511 API key.",
+		[]string{"key"}, nil,
+	)
+	keyThrottledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "api_key", "throttled_total"),
+		"How often each 511 API key was skipped because its rate limiter had no tokens.",
+		[]string{"key"}, nil,
+	)
+	keyTokensDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "api_key", "tokens"),
+		"Tokens currently available in each 511 API key's rate limiter.",
+		[]string{"key"}, nil,
+	)
+	keyEnabledDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "api_key", "enabled"),
+		"Whether each 511 API key is enabled (1) or disabled through the admin API (0).",
+		[]string{"key"}, nil,
+	)
+	snapshotAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metricsNamespace, "timetable", "snapshot_age_seconds"),
+		"Seconds since the timetable snapshot of each operator was loaded.",
+		[]string{"operator"}, nil,
+	)
+)
+
+// keyPoolCollector exports usage of the API keys, labeled by their 1-based
+// position so the key values never appear in metrics
+type keyPoolCollector struct {
+	pool *KeyPool
+}
+
+func (c *keyPoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- keyRequestsDesc
+	ch <- keyThrottledDesc
+	ch <- keyTokensDesc
+	ch <- keyEnabledDesc
+}
+
+func (c *keyPoolCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, key := range c.pool.Keys {
+		label := strconv.Itoa(key.Index())
+		ch <- prometheus.MustNewConstMetric(keyRequestsDesc, prometheus.CounterValue, float64(key.Used()), label)
+		ch <- prometheus.MustNewConstMetric(keyThrottledDesc, prometheus.CounterValue, float64(key.Throttled()), label)
+		ch <- prometheus.MustNewConstMetric(keyTokensDesc, prometheus.GaugeValue, key.Limiter.Tokens(), label)
+		enabled := 0.0
+		if key.Enabled() {
+			enabled = 1
+		}
+		ch <- prometheus.MustNewConstMetric(keyEnabledDesc, prometheus.GaugeValue, enabled, label)
+	}
+}
+
+// storeCollector exports the age of each loaded timetable snapshot
+type storeCollector struct {
+	store *Store
+}
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- snapshotAgeDesc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, operator := range c.store.Operators() {
+		snapshot := c.store.Snapshot(operator.ID)
+		if snapshot == nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(snapshotAgeDesc, prometheus.GaugeValue, time.Since(snapshot.LoadedAt).Seconds(), operator.ID)
+	}
+}
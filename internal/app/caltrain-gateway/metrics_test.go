@@ -0,0 +1,100 @@
+package caltraingateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer mockAPI.Close()
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	keyPool := NewKeyPool([]string{"metrics-key"}, 100, 10)
+	store := newExampleStore(t)
+	metrics := NewMetrics(keyPool, store)
+
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: keyPool,
+		Store:   store,
+		Metrics: metrics,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	// One cache miss followed by a hit, plus a snapshot request
+	for _, url := range []string{
+		"/transit/StopMonitoring?agency=CT",
+		"/transit/StopMonitoring?agency=CT",
+		"/caltrain/timetable",
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected status %d for %s, got %d", http.StatusOK, url, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Result().Body)
+
+	expected := []string{
+		`caltrain_gateway_http_requests_total{method="GET",route="/",status="200"} 2`,
+		`caltrain_gateway_http_requests_total{method="GET",route="GET /{operator}/timetable",status="200"} 1`,
+		`caltrain_gateway_proxy_cache_lookups_total{result="hit"} 1`,
+		`caltrain_gateway_proxy_cache_lookups_total{result="miss"} 1`,
+		`caltrain_gateway_upstream_request_duration_seconds_count{endpoint="transit/StopMonitoring",status="200"} 1`,
+		`caltrain_gateway_api_key_requests_total{key="1"} 1`,
+		`caltrain_gateway_timetable_snapshot_age_seconds{operator="CT"}`,
+	}
+	for _, want := range expected {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected metrics to contain %q", want)
+		}
+	}
+	if strings.Contains(string(body), "metrics-key") {
+		t.Errorf("Expected metrics not to contain the API key")
+	}
+}
+
+func TestResponseCache_Expiry(t *testing.T) {
+	c := NewResponseCache(10*time.Millisecond, 100*time.Millisecond)
+
+	if _, status := c.Get("key"); status != cacheMiss {
+		t.Errorf("Expected %s, got %s", cacheMiss, status)
+	}
+
+	c.Set("key", &apiResponse{fetchedAt: time.Now()})
+	if _, status := c.Get("key"); status != cacheHit {
+		t.Errorf("Expected %s, got %s", cacheHit, status)
+	}
+
+	// Expired, but not purged before the cleanup after 100ms
+	time.Sleep(30 * time.Millisecond)
+	if resp, status := c.Get("key"); status != cacheStale || resp != nil {
+		t.Errorf("Expected %s without response, got %s", cacheStale, status)
+	}
+
+	// Purged by the cleanup after 200ms
+	time.Sleep(220 * time.Millisecond)
+	if resp, status := c.Get("key"); status != cacheMiss || resp != nil {
+		t.Errorf("Expected %s without response, got %s", cacheMiss, status)
+	}
+	if c.Len() != 0 {
+		t.Errorf("Expected the expired entry to be purged, got %d entries", c.Len())
+	}
+}
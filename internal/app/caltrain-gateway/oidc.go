@@ -0,0 +1,162 @@
+package caltraingateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+// jwtLeeway is the clock skew tolerated when checking the expiry and not-before time of a token
+const jwtLeeway = 30 * time.Second
+
+// jwtSigningMethods are the asymmetric algorithms accepted for tokens
+var jwtSigningMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// JWTConfig configures authentication with JWTs issued by an identity provider
+type JWTConfig struct {
+	// Issuer is the required iss claim
+	Issuer string `yaml:"issuer"`
+	// Audience is the required aud claim, not checked if empty
+	Audience string `yaml:"audience"`
+	// JWKS is the file or http(s) URL of the issuer's public keys. JWT authentication is disabled if empty.
+	JWKS string `yaml:"jwks"`
+	// ScopesClaim is the claim holding the token's scopes, as a space-separated string or a list
+	ScopesClaim string `yaml:"scopes_claim"`
+	// Scopes maps the values of the scopes claim to gateway scopes.
+	// If empty, values named like a gateway scope grant that scope.
+	Scopes map[string][]Scope `yaml:"scopes"`
+}
+
+// Enabled reports whether JWT authentication is configured
+func (c *JWTConfig) Enabled() bool {
+	return c.JWKS != ""
+}
+
+// validate checks the JWT configuration for missing and unknown values
+func (c *JWTConfig) validate() []error {
+	if !c.Enabled() {
+		return nil
+	}
+	var errs []error
+	if c.Issuer == "" {
+		errs = append(errs, errors.New("jwt.issuer is required when jwt.jwks is set"))
+	}
+	if c.ScopesClaim == "" {
+		errs = append(errs, errors.New("jwt.scopes_claim must not be empty"))
+	}
+	for value, scopes := range c.Scopes {
+		for _, scope := range scopes {
+			if !slices.Contains(validScopes, scope) {
+				errs = append(errs, fmt.Errorf("jwt.scopes maps %q to unknown scope %q", value, scope))
+			}
+		}
+	}
+	return errs
+}
+
+// jwtVerifier validates JWTs and maps their claims to a client
+type jwtVerifier struct {
+	cfg    JWTConfig
+	keys   *JWKS
+	parser *jwt.Parser
+	// limiter is shared by all token clients, which are not rate limited
+	limiter *rate.Limiter
+}
+
+// newJWTVerifier loads the issuer's keys and creates a verifier for its tokens
+func newJWTVerifier(ctx context.Context, cfg JWTConfig) (*jwtVerifier, error) {
+	keys, err := LoadJWKS(ctx, cfg.JWKS)
+	if err != nil {
+		return nil, err
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(jwtSigningMethods),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(jwtLeeway),
+	}
+	if cfg.Audience != "" {
+		options = append(options, jwt.WithAudience(cfg.Audience))
+	}
+	return &jwtVerifier{
+		cfg:     cfg,
+		keys:    keys,
+		parser:  jwt.NewParser(options...),
+		limiter: rate.NewLimiter(rate.Inf, 1),
+	}, nil
+}
+
+// grants reports whether tokens can be granted the scope
+func (v *jwtVerifier) grants(scope Scope) bool {
+	if len(v.cfg.Scopes) == 0 {
+		return true
+	}
+	for _, scopes := range v.cfg.Scopes {
+		if slices.Contains(scopes, scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopes maps the values of the token's scopes claim to gateway scopes
+func (v *jwtVerifier) scopes(claims jwt.MapClaims) []Scope {
+	var values []string
+	switch claim := claims[v.cfg.ScopesClaim].(type) {
+	case string:
+		values = strings.Fields(claim)
+	case []any:
+		for _, value := range claim {
+			if s, ok := value.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	var scopes []Scope
+	for _, value := range values {
+		granted := v.cfg.Scopes[value]
+		if len(v.cfg.Scopes) == 0 && slices.Contains(validScopes, Scope(value)) {
+			granted = []Scope{Scope(value)}
+		}
+		for _, scope := range granted {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	return scopes
+}
+
+// verify validates the token and returns a client named after its subject
+func (v *jwtVerifier) verify(ctx context.Context, token string) (*registeredClient, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid token: %w", err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, errors.New("invalid token: missing sub claim")
+	}
+	return &registeredClient{
+		Client:  Client{Name: "jwt:" + subject, Scopes: v.scopes(claims)},
+		limiter: v.limiter,
+	}, nil
+}
+
+// isJWT reports whether a bearer token has the three dot-separated parts of a JWT
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,209 @@
+package caltraingateway
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testIssuer = "https://id.example.com"
+
+// testJWKSServer serves a JWK set whose keys can be replaced during a test
+type testJWKSServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+}
+
+// newTestJWKSServer starts a JWKS server with the given keys
+func newTestJWKSServer(t *testing.T, keys map[string]crypto.PublicKey) *testJWKSServer {
+	t.Helper()
+	s := &testJWKSServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Write(encodeJWKS(t, s.keys))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// setKeys replaces the keys served
+func (s *testJWKSServer) setKeys(keys map[string]crypto.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+// encodeJWKS encodes RSA and EC public keys as a JWK set
+func encodeJWKS(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	t.Helper()
+	encode := base64.RawURLEncoding.EncodeToString
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "RSA", Kid: kid, Use: "sig", N: encode(key.N.Bytes()), E: encode(big.NewInt(int64(key.E)).Bytes())})
+		case *ecdsa.PublicKey:
+			point, err := key.Bytes()
+			if err != nil {
+				t.Fatalf("failed to encode EC key: %v", err)
+			}
+			size := (len(point) - 1) / 2
+			set.Keys = append(set.Keys, jsonWebKey{Kty: "EC", Kid: kid, Crv: key.Curve.Params().Name, X: encode(point[1 : 1+size]), Y: encode(point[1+size:])})
+		default:
+			t.Fatalf("unsupported key type %T", key)
+		}
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to encode JWKS: %v", err)
+	}
+	return data
+}
+
+// signToken signs the claims with the key, naming the key ID in the header
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key crypto.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+// testClaims returns valid claims for the subject with the given scope claim
+func testClaims(subject, scope string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   "caltrain-gateway",
+		"sub":   subject,
+		"scope": scope,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestAuthMiddleware_JWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	jwks := newTestJWKSServer(t, map[string]crypto.PublicKey{"rsa": &rsaKey.PublicKey, "ec": &ecKey.PublicKey})
+
+	cfg := DefaultConfig()
+	cfg.Secret = "shared"
+	cfg.JWT = JWTConfig{
+		Issuer:      testIssuer,
+		Audience:    "caltrain-gateway",
+		JWKS:        jwks.URL,
+		ScopesClaim: "scope",
+		Scopes: map[string][]Scope{
+			"caltrain.read":  {ScopeTimetable},
+			"caltrain.admin": {ScopeAdmin},
+		},
+	}
+	clients, err := LoadClients(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("LoadClients() error: %v", err)
+	}
+	if !clients.HasScope(ScopeAdmin) {
+		t.Error("Expected tokens to be able to grant the admin scope")
+	}
+	handler := authMiddleware(clients, ScopeTimetable, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	expired := testClaims("display", "caltrain.read")
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	wrongIssuer := testClaims("display", "caltrain.read")
+	wrongIssuer["iss"] = "https://evil.example.com"
+	wrongAudience := testClaims("display", "caltrain.read")
+	wrongAudience["aud"] = "other-app"
+	noExpiry := testClaims("display", "caltrain.read")
+	delete(noExpiry, "exp")
+	listClaim := testClaims("display", "")
+	listClaim["scope"] = []string{"caltrain.admin", "caltrain.read"}
+
+	tests := []struct {
+		name           string
+		token          string
+		expectedStatus int
+	}{
+		{name: "RSA token with timetable scope", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims("display", "openid caltrain.read")), expectedStatus: http.StatusOK},
+		{name: "EC token with timetable scope", token: signToken(t, jwt.SigningMethodES256, "ec", ecKey, testClaims("display", "caltrain.read")), expectedStatus: http.StatusOK},
+		{name: "scopes as a list", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, listClaim), expectedStatus: http.StatusOK},
+		{name: "token without timetable scope", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims("ops", "caltrain.admin")), expectedStatus: http.StatusForbidden},
+		{name: "unmapped scope value", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, testClaims("display", "timetable")), expectedStatus: http.StatusForbidden},
+		{name: "expired token", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, expired), expectedStatus: http.StatusUnauthorized},
+		{name: "token without expiry", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, noExpiry), expectedStatus: http.StatusUnauthorized},
+		{name: "wrong issuer", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, wrongIssuer), expectedStatus: http.StatusUnauthorized},
+		{name: "wrong audience", token: signToken(t, jwt.SigningMethodRS256, "rsa", rsaKey, wrongAudience), expectedStatus: http.StatusUnauthorized},
+		{name: "signed with unknown key", token: signToken(t, jwt.SigningMethodRS256, "rsa", otherKey, testClaims("display", "caltrain.read")), expectedStatus: http.StatusUnauthorized},
+		{name: "symmetric algorithm", token: signToken(t, jwt.SigningMethodHS256, "rsa", []byte("shared"), testClaims("display", "caltrain.read")), expectedStatus: http.StatusUnauthorized},
+		{name: "shared secret as bearer token", token: "shared", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+
+	t.Run("rotated issuer key", func(t *testing.T) {
+		jwks.setKeys(map[string]crypto.PublicKey{"rotated": &otherKey.PublicKey})
+		// Pretend the keys were fetched long enough ago to be fetched again
+		clients.jwt.keys.refreshMu.Lock()
+		clients.jwt.keys.attemptedAt = time.Now().Add(-minJWKSRefreshInterval)
+		clients.jwt.keys.refreshMu.Unlock()
+
+		req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+		req.Header.Set("Authorization", "Bearer "+signToken(t, jwt.SigningMethodRS256, "rotated", otherKey, testClaims("display", "caltrain.read")))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("Expected status %d, got %d", http.StatusOK, rec.Code)
+		}
+	})
+}
+
+func TestJWTVerifier_Scopes(t *testing.T) {
+	verifier := &jwtVerifier{cfg: JWTConfig{ScopesClaim: "roles"}}
+	scopes := verifier.scopes(jwt.MapClaims{"roles": []any{"proxy", "timetable", "unknown"}})
+	if len(scopes) != 2 || scopes[0] != ScopeProxy || scopes[1] != ScopeTimetable {
+		t.Errorf("Expected scope names to map to themselves without a mapping, got %v", scopes)
+	}
+	if !verifier.grants(ScopeAdmin) {
+		t.Error("Expected tokens to be able to grant any scope without a mapping")
+	}
+}
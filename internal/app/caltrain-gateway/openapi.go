@@ -0,0 +1,25 @@
+package caltraingateway
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+)
+
+// openAPISpec is the OpenAPI 3 document describing the gateway's routes.
+// The contract test in openapi_test.go keeps it in line with the handlers.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIETag identifies the embedded document, which only changes with a new build
+var openAPIETag = strongETag(openAPISpec)
+
+// openAPIHandler serves the OpenAPI document
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	if checkNotModified(w, r, openAPIETag, time.Time{}) {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
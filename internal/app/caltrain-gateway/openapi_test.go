@@ -0,0 +1,411 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// openAPIDoc is the part of an OpenAPI document the contract test checks
+type openAPIDoc struct {
+	OpenAPI    string                                 `json:"openapi"`
+	Paths      map[string]map[string]openAPIOperation `json:"paths"`
+	Components struct {
+		Schemas    map[string]*jsonSchema      `json:"schemas"`
+		Parameters map[string]openAPIParameter `json:"parameters"`
+		Responses  map[string]openAPIResponse  `json:"responses"`
+	} `json:"components"`
+}
+
+type openAPIOperation struct {
+	Deprecated bool                       `json:"deprecated"`
+	Security   []map[string][]string      `json:"security"`
+	Parameters []openAPIParameter         `json:"parameters"`
+	Responses  map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref      string      `json:"$ref"`
+	Name     string      `json:"name"`
+	In       string      `json:"in"`
+	Required bool        `json:"required"`
+	Schema   *jsonSchema `json:"schema"`
+	Example  any         `json:"example"`
+}
+
+type openAPIResponse struct {
+	Ref     string `json:"$ref"`
+	Content map[string]struct {
+		Schema *jsonSchema `json:"schema"`
+	} `json:"content"`
+}
+
+// jsonSchema is the subset of JSON Schema used by the document
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 string                 `json:"type"`
+	Enum                 []any                  `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+}
+
+func loadOpenAPIDoc(t *testing.T) *openAPIDoc {
+	t.Helper()
+	var doc openAPIDoc
+	if err := json.Unmarshal(openAPISpec, &doc); err != nil {
+		t.Fatalf("Failed to parse openapi.json: %v", err)
+	}
+	return &doc
+}
+
+// lastRefPart returns the name a local $ref points to
+func lastRefPart(ref string) string {
+	return ref[strings.LastIndex(ref, "/")+1:]
+}
+
+func (d *openAPIDoc) parameter(p openAPIParameter) openAPIParameter {
+	if p.Ref != "" {
+		return d.Components.Parameters[lastRefPart(p.Ref)]
+	}
+	return p
+}
+
+func (d *openAPIDoc) response(r openAPIResponse) openAPIResponse {
+	if r.Ref != "" {
+		return d.Components.Responses[lastRefPart(r.Ref)]
+	}
+	return r
+}
+
+// validate checks the decoded JSON value against the schema. Objects with
+// declared properties must not have others, so fields added to a response
+// without documenting them fail the contract.
+func (d *openAPIDoc) validate(s *jsonSchema, v any, path string) error {
+	if s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		return d.validate(d.Components.Schemas[lastRefPart(s.Ref)], v, path)
+	}
+	if len(s.Enum) > 0 && !slices.Contains(s.Enum, v) {
+		return fmt.Errorf("%s: %v is not one of %v", path, v, s.Enum)
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		if _, ok := v.(string); !ok {
+			return fmt.Errorf("%s: expected string, got %T", path, v)
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean, got %T", path, v)
+		}
+	case "number":
+		if _, ok := v.(float64); !ok {
+			return fmt.Errorf("%s: expected number, got %T", path, v)
+		}
+	case "integer":
+		if n, ok := v.(float64); !ok || n != float64(int64(n)) {
+			return fmt.Errorf("%s: expected integer, got %v", path, v)
+		}
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array, got %T", path, v)
+		}
+		for i, item := range items {
+			if err := d.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object, got %T", path, v)
+		}
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				return fmt.Errorf("%s: missing required property %s", path, name)
+			}
+		}
+		for name, value := range obj {
+			prop, declared := s.Properties[name]
+			switch {
+			case declared:
+				if err := d.validate(prop, value, path+"."+name); err != nil {
+					return err
+				}
+			case s.AdditionalProperties != nil:
+				if err := d.validate(s.AdditionalProperties, value, path+"."+name); err != nil {
+					return err
+				}
+			case s.Properties != nil:
+				return fmt.Errorf("%s: undocumented property %s", path, name)
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema type %s", path, s.Type)
+	}
+	return nil
+}
+
+// checkResponse verifies that the status code is documented for the operation
+// and that the body matches the documented schema of its content type
+func (d *openAPIDoc) checkResponse(op openAPIOperation, rec *httptest.ResponseRecorder) error {
+	documented, ok := op.Responses[strconv.Itoa(rec.Code)]
+	if !ok {
+		if documented, ok = op.Responses["default"]; !ok || rec.Code < 400 {
+			return fmt.Errorf("status %d is not documented: %s", rec.Code, rec.Body.String())
+		}
+	}
+	documented = d.response(documented)
+
+	if len(documented.Content) == 0 {
+		if rec.Body.Len() > 0 {
+			return fmt.Errorf("status %d is documented without a body, got %q", rec.Code, rec.Body.String())
+		}
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+	content, ok := documented.Content[mediaType]
+	if !ok {
+		return fmt.Errorf("content type %q of status %d is not documented", mediaType, rec.Code)
+	}
+	if mediaType != "application/json" {
+		return nil
+	}
+
+	var body any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		return fmt.Errorf("failed to decode body of status %d: %w", rec.Code, err)
+	}
+	return d.validate(content.Schema, body, "body")
+}
+
+// expectedPaths returns the paths the gateway serves, derived from its routes
+func expectedPaths() []string {
+	paths := []string{"/up", "/ready", "/status", "/openapi.json"}
+	for pattern := range operatorRoutes(nil) {
+		paths = append(paths, pattern, apiV1Prefix+pattern)
+	}
+	for pattern := range v1OperatorRoutes(nil) {
+		paths = append(paths, apiV1Prefix+pattern)
+	}
+	for _, path := range DefaultProxyPolicy().AllowedPaths {
+		paths = append(paths, "/"+path, apiV1Prefix+"/"+path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func TestOpenAPI_Paths(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("Expected OpenAPI 3 document, got version '%s'", doc.OpenAPI)
+	}
+
+	var documented []string
+	for path, ops := range doc.Paths {
+		documented = append(documented, path)
+		for method, op := range ops {
+			if method != "get" {
+				t.Errorf("%s: unexpected method %s, the gateway only serves GET", path, method)
+			}
+			legacy := !strings.HasPrefix(path, apiV1Prefix+"/") && strings.Count(path, "/") > 1
+			if op.Deprecated != legacy {
+				t.Errorf("%s: expected deprecated to be %v, got %v", path, legacy, op.Deprecated)
+			}
+		}
+	}
+	sort.Strings(documented)
+
+	if expected := expectedPaths(); !slices.Equal(documented, expected) {
+		t.Errorf("Documented paths differ from the routes.\nExpected: %v\nGot:      %v", expected, documented)
+	}
+}
+
+func TestOpenAPI_Schemas(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+
+	types := map[string]reflect.Type{
+		"TrainDeparture": reflect.TypeFor[TrainDeparture](),
+		"Line":           reflect.TypeFor[Line](),
+		"LineRoute":      reflect.TypeFor[LineRoute](),
+		"LineDetail":     reflect.TypeFor[LineDetail](),
+		"Stop":           reflect.TypeFor[Stop](),
+		"StopLocation":   reflect.TypeFor[StopLocation](),
+		"TrainCall":      reflect.TypeFor[TrainCall](),
+		"TrainDetail":    reflect.TypeFor[TrainDetail](),
+		"Meta":           reflect.TypeFor[Meta](),
+		"APIError":       reflect.TypeFor[APIError](),
+		"ErrorEnvelope":  reflect.TypeFor[ErrorEnvelope](),
+		"GatewayStatus":  reflect.TypeFor[GatewayStatus](),
+		"OperatorStatus": reflect.TypeFor[OperatorStatus](),
+		"KeyPoolStatus":  reflect.TypeFor[KeyPoolStatus](),
+		"CacheHealth":    reflect.TypeFor[CacheHealth](),
+	}
+
+	for name, typ := range types {
+		t.Run(name, func(t *testing.T) {
+			schema, ok := doc.Components.Schemas[name]
+			if !ok {
+				t.Fatalf("Schema %s is not documented", name)
+			}
+
+			var fields []string
+			for _, field := range reflect.VisibleFields(typ) {
+				tag := strings.Split(field.Tag.Get("json"), ",")[0]
+				if field.Anonymous || !field.IsExported() || tag == "-" {
+					continue
+				}
+				if tag == "" {
+					tag = field.Name
+				}
+				fields = append(fields, tag)
+			}
+			var properties []string
+			for property := range schema.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(fields)
+			sort.Strings(properties)
+
+			if !slices.Equal(fields, properties) {
+				t.Errorf("Expected properties %v, got %v", fields, properties)
+			}
+		})
+	}
+}
+
+func TestOpenAPI_Contract(t *testing.T) {
+	doc := loadOpenAPIDoc(t)
+
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"Siri": {}}`))
+	}))
+	defer mockAPI.Close()
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	cfg.Secret = "mysecret"
+	handler, err := NewHandler(Deps{
+		Config:  cfg,
+		KeyPool: NewKeyPool([]string{"test-key"}, 100, 100),
+		Store:   newExampleStore(t),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	// request builds a URL from the parameter examples, with override replacing one of them
+	request := func(path string, params []openAPIParameter, override *openAPIParameter, value string) string {
+		q := url.Values{}
+		for _, p := range params {
+			if p.Example == nil {
+				continue
+			}
+			example := fmt.Sprint(p.Example)
+			if override != nil && p.Name == override.Name && p.In == override.In {
+				example = value
+			}
+			switch p.In {
+			case "path":
+				path = strings.ReplaceAll(path, "{"+p.Name+"}", url.PathEscape(example))
+			case "query":
+				q.Set(p.Name, example)
+			}
+		}
+		if len(q) == 0 {
+			return path
+		}
+		return path + "?" + q.Encode()
+	}
+
+	for path, ops := range doc.Paths {
+		op := ops["get"]
+		params := make([]openAPIParameter, 0, len(op.Parameters))
+		for _, p := range op.Parameters {
+			params = append(params, doc.parameter(p))
+		}
+
+		t.Run(path, func(t *testing.T) {
+			serve := func(target string, secret string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest("GET", target, nil)
+				if secret != "" {
+					req.Header.Set("X-API-SECRET", secret)
+				}
+				rec := httptest.NewRecorder()
+				handler.ServeHTTP(rec, req)
+				return rec
+			}
+
+			// The examples form a successful request
+			target := request(path, params, nil, "")
+			rec := serve(target, "mysecret")
+			if rec.Code != http.StatusOK {
+				t.Errorf("%s: expected status %d, got %d: %s", target, http.StatusOK, rec.Code, rec.Body.String())
+			}
+			if err := doc.checkResponse(op, rec); err != nil {
+				t.Errorf("%s: %v", target, err)
+			}
+			if op.Deprecated && rec.Header().Get("Deprecation") == "" {
+				t.Errorf("%s: expected Deprecation header on deprecated route", target)
+			}
+
+			// Errors are documented too
+			if len(op.Security) > 0 {
+				if err := doc.checkResponse(op, serve(target, "")); err != nil {
+					t.Errorf("%s without credentials: %v", target, err)
+				}
+			}
+			for _, p := range params {
+				target := request(path, params, &p, "invalid")
+				if err := doc.checkResponse(op, serve(target, "mysecret")); err != nil {
+					t.Errorf("%s: %v", target, err)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAPIHandler(t *testing.T) {
+	handler, err := NewHandler(Deps{
+		Config:  DefaultConfig(),
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   NewStore(nil),
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+	if rec.Body.String() != string(openAPISpec) {
+		t.Error("Expected the embedded OpenAPI document")
+	}
+
+	req := httptest.NewRequest("GET", "/openapi.json", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Expected status %d, got %d", http.StatusNotModified, rec.Code)
+	}
+}
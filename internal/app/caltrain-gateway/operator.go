@@ -0,0 +1,47 @@
+package caltraingateway
+
+import (
+	"strings"
+)
+
+// DefaultOperatorID is the 511 operator ID for Caltrain
+const DefaultOperatorID = "CT"
+
+// operatorSlugs maps well-known 511 operator IDs to their URL path segment
+var operatorSlugs = map[string]string{
+	"CT": "caltrain",
+	"BA": "bart",
+	"SM": "samtrans",
+	"SC": "vta",
+}
+
+// Operator identifies a 511 transit operator served by the gateway
+type Operator struct {
+	ID   string `json:"id"`   // e.g., "CT"
+	Slug string `json:"slug"` // e.g., "caltrain"
+}
+
+// NewOperator creates an Operator for the given 511 operator ID.
+// Well-known operators get a readable slug, others use the lowercase ID.
+func NewOperator(id string) Operator {
+	id = strings.ToUpper(strings.TrimSpace(id))
+	slug, ok := operatorSlugs[id]
+	if !ok {
+		slug = strings.ToLower(id)
+	}
+	return Operator{ID: id, Slug: slug}
+}
+
+// NewOperators creates an Operator for each of the given 511 operator IDs
+func NewOperators(ids []string) []Operator {
+	operators := make([]Operator, 0, len(ids))
+	for _, id := range ids {
+		operators = append(operators, NewOperator(id))
+	}
+	return operators
+}
+
+// matches reports whether the given path segment refers to this operator, by slug or ID
+func (o Operator) matches(name string) bool {
+	return strings.EqualFold(name, o.Slug) || strings.EqualFold(name, o.ID)
+}
@@ -0,0 +1,92 @@
+package caltraingateway
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	// defaultMaxQueryLength caps the raw query string forwarded to the 511 API
+	defaultMaxQueryLength = 512
+)
+
+// operatorParams lists the query parameters the 511 API uses to select an operator
+var operatorParams = []string{"agency", "operator_id"}
+
+// ProxyPolicy restricts which requests the proxy forwards to the 511 API
+type ProxyPolicy struct {
+	// AllowedPaths are the upstream endpoints that may be proxied, e.g. "transit/StopMonitoring"
+	AllowedPaths []string `yaml:"allowed_paths"`
+	// AllowedOperators are the operator IDs that may be requested, e.g. "CT"
+	AllowedOperators []string `yaml:"allowed_operators"`
+	// MaxQueryLength is the maximum length of the raw query string, 0 disables the check
+	MaxQueryLength int `yaml:"max_query_length"`
+}
+
+// DefaultProxyPolicy returns the policy used when nothing else is configured.
+// It allows the real-time Caltrain endpoints only.
+func DefaultProxyPolicy() ProxyPolicy {
+	return ProxyPolicy{
+		AllowedPaths: []string{
+			"transit/StopMonitoring",
+			"transit/VehicleMonitoring",
+			"transit/stops",
+			"transit/servicealerts",
+		},
+		AllowedOperators: []string{"CT"},
+		MaxQueryLength:   defaultMaxQueryLength,
+	}
+}
+
+// allowsPath reports whether the given request path is an allowed upstream endpoint
+func (p ProxyPolicy) allowsPath(path string) bool {
+	return slices.Contains(p.AllowedPaths, strings.TrimPrefix(path, "/"))
+}
+
+// allowsOperator reports whether the given operator ID may be requested
+func (p ProxyPolicy) allowsOperator(operator string) bool {
+	return slices.ContainsFunc(p.AllowedOperators, func(allowed string) bool {
+		return strings.EqualFold(allowed, operator)
+	})
+}
+
+// proxyPolicyMiddleware rejects requests that are not allowed by the proxy policy
+func proxyPolicyMiddleware(policy ProxyPolicy, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeError(w, r, newAPIError(http.StatusMethodNotAllowed, ErrCodeMethodNotAllowed, "Method not allowed. Only GET requests are proxied"))
+			return
+		}
+
+		if policy.MaxQueryLength > 0 && len(r.URL.RawQuery) > policy.MaxQueryLength {
+			writeError(w, r, newAPIError(http.StatusRequestURITooLong, ErrCodeQueryTooLong, fmt.Sprintf("Query string too long. Maximum length is %d", policy.MaxQueryLength)))
+			return
+		}
+
+		if !policy.allowsPath(r.URL.Path) {
+			writeError(w, r, newAPIError(http.StatusForbidden, ErrCodeEndpointNotAllowed, fmt.Sprintf("Upstream endpoint not allowed: %s", r.URL.Path)))
+			return
+		}
+
+		q := r.URL.Query()
+		found := false
+		for _, param := range operatorParams {
+			for _, operator := range q[param] {
+				found = true
+				if !policy.allowsOperator(operator) {
+					writeError(w, r, newAPIError(http.StatusForbidden, ErrCodeOperatorNotAllowed, fmt.Sprintf("Operator not allowed: %s", operator)))
+					return
+				}
+			}
+		}
+		if !found {
+			writeError(w, r, newAPIError(http.StatusBadRequest, ErrCodeMissingOperator, fmt.Sprintf("Missing operator. Set one of the query parameters: %s", strings.Join(operatorParams, ", "))))
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,135 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyPolicyMiddleware(t *testing.T) {
+	policy := ProxyPolicy{
+		AllowedPaths:     []string{"transit/StopMonitoring", "transit/stops"},
+		AllowedOperators: []string{"CT"},
+		MaxQueryLength:   64,
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		url            string
+		expectedStatus int
+		expectNext     bool
+	}{
+		{
+			name:           "allowed path with agency",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?agency=CT&format=json",
+			expectedStatus: http.StatusOK,
+			expectNext:     true,
+		},
+		{
+			name:           "allowed path with operator_id",
+			method:         "GET",
+			url:            "/transit/stops?operator_id=ct",
+			expectedStatus: http.StatusOK,
+			expectNext:     true,
+		},
+		{
+			name:           "non-GET method",
+			method:         "POST",
+			url:            "/transit/StopMonitoring?agency=CT",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectNext:     false,
+		},
+		{
+			name:           "path not in allowlist",
+			method:         "GET",
+			url:            "/transit/timetable?operator_id=CT",
+			expectedStatus: http.StatusForbidden,
+			expectNext:     false,
+		},
+		{
+			name:           "root path",
+			method:         "GET",
+			url:            "/",
+			expectedStatus: http.StatusForbidden,
+			expectNext:     false,
+		},
+		{
+			name:           "operator not allowed",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?agency=BA",
+			expectedStatus: http.StatusForbidden,
+			expectNext:     false,
+		},
+		{
+			name:           "one of several operators not allowed",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?agency=CT&operator_id=SF",
+			expectedStatus: http.StatusForbidden,
+			expectNext:     false,
+		},
+		{
+			name:           "missing operator",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?format=json",
+			expectedStatus: http.StatusBadRequest,
+			expectNext:     false,
+		},
+		{
+			name:           "query too long",
+			method:         "GET",
+			url:            "/transit/StopMonitoring?agency=CT&stopcode=" + strings.Repeat("7", 64),
+			expectedStatus: http.StatusRequestURITooLong,
+			expectNext:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			nextCalled := false
+			nextHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				nextCalled = true
+				w.WriteHeader(http.StatusOK)
+			})
+
+			handler := proxyPolicyMiddleware(policy, nextHandler)
+
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+
+			resp := rec.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if nextCalled != tt.expectNext {
+				t.Errorf("Expected next handler called: %v, got: %v", tt.expectNext, nextCalled)
+			}
+			if tt.expectedStatus == http.StatusMethodNotAllowed && resp.Header.Get("Allow") != "GET" {
+				t.Errorf("Expected Allow header 'GET', got '%s'", resp.Header.Get("Allow"))
+			}
+		})
+	}
+}
+
+func TestDefaultProxyPolicy(t *testing.T) {
+	policy := DefaultProxyPolicy()
+
+	if !policy.allowsPath("/transit/StopMonitoring") {
+		t.Error("Expected StopMonitoring to be allowed by default")
+	}
+	if !policy.allowsPath("/transit/VehicleMonitoring") {
+		t.Error("Expected VehicleMonitoring to be allowed by default")
+	}
+	if !policy.allowsOperator("CT") {
+		t.Error("Expected CT to be allowed by default")
+	}
+	if policy.allowsOperator("BA") {
+		t.Error("Expected BA not to be allowed by default")
+	}
+	if policy.MaxQueryLength != defaultMaxQueryLength {
+		t.Errorf("Expected MaxQueryLength %d, got %d", defaultMaxQueryLength, policy.MaxQueryLength)
+	}
+}
@@ -1,7 +1,11 @@
 package caltraingateway
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"golang.org/x/time/rate"
 )
@@ -10,6 +14,49 @@ import (
 type APIKey struct {
 	Value   string
 	Limiter *rate.Limiter
+
+	// index is the 1-based position of the key in its pool
+	index int
+	// used counts the tokens taken from the limiter
+	used atomic.Int64
+	// throttled counts how often the key was skipped for lack of tokens
+	throttled atomic.Int64
+	// disabled keys are skipped by the pool
+	disabled atomic.Bool
+}
+
+// Index returns the 1-based position of the key in its pool.
+// It identifies the key in logs and metrics without revealing its value.
+func (k *APIKey) Index() int {
+	return k.index
+}
+
+// Used returns the number of requests made with this key
+func (k *APIKey) Used() int64 {
+	return k.used.Load()
+}
+
+// Throttled returns how often this key was skipped because its limiter had no tokens
+func (k *APIKey) Throttled() int64 {
+	return k.throttled.Load()
+}
+
+// Enabled reports whether the pool hands out this key
+func (k *APIKey) Enabled() bool {
+	return !k.disabled.Load()
+}
+
+// SetEnabled enables or disables the key at runtime
+func (k *APIKey) SetEnabled(enabled bool) {
+	k.disabled.Store(!enabled)
+}
+
+// Masked returns the key with all but its last four characters hidden
+func (k *APIKey) Masked() string {
+	if len(k.Value) <= 4 {
+		return "****"
+	}
+	return "****" + k.Value[len(k.Value)-4:]
 }
 
 // KeyPool manages our set of keys
@@ -21,10 +68,11 @@ type KeyPool struct {
 
 func NewKeyPool(strings []string, r rate.Limit, b int) *KeyPool {
 	pool := &KeyPool{}
-	for _, s := range strings {
+	for i, s := range strings {
 		pool.Keys = append(pool.Keys, &APIKey{
 			Value:   s,
 			Limiter: rate.NewLimiter(r, b),
+			index:   i + 1,
 		})
 	}
 	return pool
@@ -39,11 +87,53 @@ func (p *KeyPool) GetAvailableKey() (*APIKey, bool) {
 	n := len(p.Keys)
 	for i := range n {
 		idx := (p.last + i) % n
+		if !p.Keys[idx].Enabled() {
+			continue
+		}
 		if p.Keys[idx].Limiter.Allow() {
+			p.Keys[idx].used.Add(1)
 			p.last = idx
 			return p.Keys[idx], true
 		}
+		p.Keys[idx].throttled.Add(1)
 	}
 
 	return nil, false
 }
+
+// keyWaitInterval is how often WaitAvailableKey checks the pool again
+const keyWaitInterval = 100 * time.Millisecond
+
+// WaitAvailableKey waits until a key has a token available.
+// It fails if the context is cancelled or every key is disabled.
+func (p *KeyPool) WaitAvailableKey(ctx context.Context) (*APIKey, error) {
+	for {
+		if key, ok := p.GetAvailableKey(); ok {
+			return key, nil
+		}
+		if !p.anyEnabled() {
+			return nil, errors.New("no enabled API keys")
+		}
+		if err := sleep(ctx, keyWaitInterval); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// anyEnabled reports whether the pool has an enabled key
+func (p *KeyPool) anyEnabled() bool {
+	for _, key := range p.Keys {
+		if key.Enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// Key returns the key at the given 1-based index
+func (p *KeyPool) Key(index int) (*APIKey, bool) {
+	if index < 1 || index > len(p.Keys) {
+		return nil, false
+	}
+	return p.Keys[index-1], true
+}
@@ -0,0 +1,97 @@
+package caltraingateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Server runs the HTTP server together with its background tasks
+type Server struct {
+	addr            string
+	httpServer      *http.Server
+	shutdownTimeout time.Duration
+	tasks           []func(ctx context.Context)
+}
+
+// NewServer creates a Server for the given handler using the configured address and timeouts
+func NewServer(cfg *Config, handler http.Handler) *Server {
+	return &Server{
+		addr: cfg.Addr(),
+		httpServer: &http.Server{
+			Handler:           handler,
+			ReadTimeout:       cfg.ReadTimeout,
+			ReadHeaderTimeout: cfg.ReadTimeout,
+			WriteTimeout:      cfg.WriteTimeout,
+			IdleTimeout:       cfg.IdleTimeout,
+		},
+		shutdownTimeout: cfg.ShutdownTimeout,
+	}
+}
+
+// Go registers a background task that runs while the server is running.
+// The task's context is cancelled once the server has shut down.
+func (s *Server) Go(task func(ctx context.Context)) {
+	s.tasks = append(s.tasks, task)
+}
+
+// Run listens on the configured address and serves until the context is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.addr, err)
+	}
+	return s.Serve(ctx, ln)
+}
+
+// Serve accepts connections on the listener until the context is cancelled.
+// It then stops accepting new connections, waits up to the shutdown timeout for
+// in-flight requests to finish and stops the background tasks before returning.
+func (s *Server) Serve(ctx context.Context, ln net.Listener) error {
+	taskCtx, stopTasks := context.WithCancel(context.Background())
+	defer stopTasks()
+
+	var wg sync.WaitGroup
+	for _, task := range s.tasks {
+		wg.Go(func() {
+			task(taskCtx)
+		})
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.httpServer.Serve(ln)
+	}()
+	log.Printf("Caltrain Proxy running on %s...", ln.Addr())
+
+	var err error
+	select {
+	case err = <-serveErr:
+		// The server failed before shutdown was requested
+	case <-ctx.Done():
+		log.Printf("Shutting down, draining in-flight requests for up to %s ...", s.shutdownTimeout)
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+		defer cancel()
+		if shutdownErr := s.httpServer.Shutdown(shutdownCtx); shutdownErr != nil {
+			err = fmt.Errorf("failed to shut down gracefully: %w", shutdownErr)
+			s.httpServer.Close()
+		}
+		<-serveErr
+	}
+
+	stopTasks()
+	wg.Wait()
+
+	if errors.Is(err, http.ErrServerClosed) {
+		err = nil
+	}
+	if err == nil {
+		log.Println("Server stopped")
+	}
+	return err
+}
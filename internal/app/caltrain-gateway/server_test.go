@@ -0,0 +1,113 @@
+package caltraingateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServer_RunAndShutdown(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.ShutdownTimeout = 5 * time.Second
+
+	requestStarted := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	server := NewServer(cfg, mux)
+
+	taskStarted := make(chan struct{})
+	taskStopped := make(chan struct{})
+	server.Go(func(ctx context.Context) {
+		close(taskStarted)
+		<-ctx.Done()
+		close(taskStopped)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(ctx, ln)
+	}()
+
+	<-taskStarted
+
+	// Start a slow request and shut down while it is in flight
+	type result struct {
+		body string
+		err  error
+	}
+	responses := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/slow")
+		if err != nil {
+			responses <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		responses <- result{body: string(body), err: err}
+	}()
+
+	<-requestStarted
+	cancel()
+
+	res := <-responses
+	if res.err != nil {
+		t.Fatalf("in-flight request failed during shutdown: %v", res.err)
+	}
+	if res.body != "done" {
+		t.Errorf("Expected body 'done', got '%s'", res.body)
+	}
+
+	select {
+	case err := <-serveErr:
+		if err != nil {
+			t.Errorf("Expected Serve to return nil, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after shutdown")
+	}
+
+	select {
+	case <-taskStopped:
+	default:
+		t.Error("Expected background task to be stopped when Serve returns")
+	}
+
+	// New connections are refused after shutdown
+	if _, err := http.Get("http://" + ln.Addr().String() + "/slow"); err == nil {
+		t.Error("Expected request after shutdown to fail")
+	}
+}
+
+func TestNewServer_Timeouts(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Port = 9090
+	server := NewServer(cfg, http.NewServeMux())
+
+	if server.addr != ":9090" {
+		t.Errorf("Expected address ':9090', got '%s'", server.addr)
+	}
+	if server.httpServer.ReadTimeout != cfg.ReadTimeout || server.httpServer.ReadHeaderTimeout != cfg.ReadTimeout {
+		t.Errorf("Expected read timeouts %s, got %s/%s", cfg.ReadTimeout, server.httpServer.ReadTimeout, server.httpServer.ReadHeaderTimeout)
+	}
+	if server.httpServer.WriteTimeout != cfg.WriteTimeout {
+		t.Errorf("Expected write timeout %s, got %s", cfg.WriteTimeout, server.httpServer.WriteTimeout)
+	}
+	if server.httpServer.IdleTimeout != cfg.IdleTimeout {
+		t.Errorf("Expected idle timeout %s, got %s", cfg.IdleTimeout, server.httpServer.IdleTimeout)
+	}
+}
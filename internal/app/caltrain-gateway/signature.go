@@ -0,0 +1,72 @@
+package caltraingateway
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"caltrain-gateway/pkg/api"
+)
+
+const (
+	// defaultSignatureMaxSkew is how far the timestamp of a signed request may be off by default
+	defaultSignatureMaxSkew = 5 * time.Minute
+	// minSigningKeyLength is the minimum length of a signing key
+	minSigningKeyLength = 16
+	// maxNonceLength is the maximum length of the nonce of a signed request
+	maxNonceLength = 128
+)
+
+// signaturePayload returns the string the client signed for a request, with
+// the path it requested, e.g. with the /v1 prefix
+func signaturePayload(r *http.Request, timestamp, nonce string) string {
+	return api.SignaturePayload(r.Method, requestPath(r), r.URL.Query(), timestamp, nonce)
+}
+
+// isSigned reports whether the request carries a signature
+func isSigned(r *http.Request) bool {
+	return r.Header.Get(api.SignatureHeader) != ""
+}
+
+// verifySignature returns the client that signed the request.
+// The timestamp must be within the registry's clock skew window and each nonce
+// is accepted only once, so captured requests cannot be replayed.
+func (reg *ClientRegistry) verifySignature(r *http.Request, now time.Time) (*registeredClient, error) {
+	name := r.Header.Get(api.SignatureClientHeader)
+	timestamp := r.Header.Get(api.SignatureTimestampHeader)
+	nonce := r.Header.Get(api.SignatureNonceHeader)
+	signature := r.Header.Get(api.SignatureHeader)
+	if name == "" || timestamp == "" || nonce == "" {
+		return nil, errors.New("incomplete signature headers")
+	}
+	if len(nonce) > maxNonceLength {
+		return nil, errors.New("nonce is too long")
+	}
+
+	client := reg.byName[name]
+	if client == nil || client.SigningKey == "" {
+		return nil, fmt.Errorf("no signing key for client %q", name)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)).Abs(); skew > reg.maxSkew {
+		return nil, fmt.Errorf("timestamp is off by %s", skew.Round(time.Second))
+	}
+
+	expected := api.Sign(client.SigningKey, signaturePayload(r, timestamp, nonce))
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return nil, errors.New("signature mismatch")
+	}
+
+	// A nonce must be remembered as long as its timestamp is accepted
+	if err := reg.nonces.Add(name+"\n"+nonce, nil, 2*reg.maxSkew); err != nil {
+		return nil, errors.New("nonce was already used")
+	}
+	return client, nil
+}
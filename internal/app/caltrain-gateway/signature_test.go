@@ -0,0 +1,202 @@
+package caltraingateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"caltrain-gateway/pkg/api"
+)
+
+const testSigningKey = "display-signing-key"
+
+func TestAuthMiddleware_SignedRequests(t *testing.T) {
+	clients, err := NewClientRegistry([]Client{
+		{Name: "display", SigningKey: testSigningKey, Scopes: []Scope{ScopeTimetable}},
+		{Name: "dashboard", Key: "dashboard-key", Scopes: []Scope{ScopeTimetable}},
+	})
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler := authMiddleware(clients, ScopeTimetable, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	})
+
+	// replayed is signed once and sent twice
+	replayed := httptest.NewRequest("GET", "/caltrain/timetable?weekday=monday", nil)
+	api.SignRequest(replayed, "display", testSigningKey, time.Now())
+
+	tests := []struct {
+		name           string
+		request        func() *http.Request
+		expectedStatus int
+	}{
+		{
+			name: "valid signature",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=monday&station=Palo+Alto", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+				return req
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "query parameters in a different order",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=monday&station=Palo+Alto", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+				req.URL.RawQuery = "station=Palo+Alto&weekday=monday"
+				return req
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "first use of a nonce",
+			request: func() *http.Request {
+				return replayed
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "replayed nonce",
+			request: func() *http.Request {
+				return replayed
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered query",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable?weekday=monday", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+				req.URL.RawQuery = "weekday=sunday"
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "tampered method",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+				req.Method = "POST"
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "timestamp outside the skew window",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now().Add(-10*time.Minute))
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong signing key",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				api.SignRequest(req, "display", "some-other-signing-key", time.Now())
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "client without signing key",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				api.SignRequest(req, "dashboard", "dashboard-key", time.Now())
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "missing nonce",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+				req.Header.Del(api.SignatureNonceHeader)
+				return req
+			},
+			expectedStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "secret still accepted",
+			request: func() *http.Request {
+				req := httptest.NewRequest("GET", "/caltrain/timetable", nil)
+				req.Header.Set("X-API-SECRET", "dashboard-key")
+				return req
+			},
+			expectedStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, tt.request())
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestNewHandler_SignedRequests(t *testing.T) {
+	clients, err := NewClientRegistry([]Client{
+		{Name: "display", SigningKey: testSigningKey, Scopes: []Scope{ScopeTimetable}},
+	})
+	if err != nil {
+		t.Fatalf("NewClientRegistry() error: %v", err)
+	}
+	handler, err := NewHandler(Deps{
+		Config:  DefaultConfig(),
+		KeyPool: NewKeyPool([]string{"key"}, 1, 1),
+		Store:   newExampleStore(t),
+		Clients: clients,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		url            string
+		signedPath     string // path the signature is computed for, the URL's path if empty
+		expectedStatus int
+	}{
+		{name: "legacy route", url: "/caltrain/lines", expectedStatus: http.StatusOK},
+		{name: "v1 route", url: "/v1/caltrain/lines?monitored=true", expectedStatus: http.StatusOK},
+		// The signature covers the /v1 prefix, so it cannot be moved to another route
+		{name: "v1 route signed without prefix", url: "/v1/caltrain/lines", signedPath: "/caltrain/lines", expectedStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.signedPath != "" {
+				signed := httptest.NewRequest("GET", tt.signedPath, nil)
+				api.SignRequest(signed, "display", testSigningKey, time.Now())
+				req.Header = signed.Header
+			} else {
+				api.SignRequest(req, "display", testSigningKey, time.Now())
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.expectedStatus, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestNewClientRegistry_ShortSigningKey(t *testing.T) {
+	_, err := NewClientRegistry([]Client{{Name: "display", SigningKey: "short", Scopes: []Scope{ScopeTimetable}}})
+	if err == nil || !strings.Contains(err.Error(), "signing key of client display must be at least 16 characters") {
+		t.Errorf("Expected signing key length error, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Operator load states reported by /status
+const (
+	loadStatePending = "pending" // no load has finished yet
+	loadStateLoaded  = "loaded"  // a snapshot is being served
+	loadStateFailed  = "failed"  // every load so far has failed
+)
+
+// OperatorStatus describes the timetable data loaded for an operator
+type OperatorStatus struct {
+	ID            string     `json:"id"`
+	Slug          string     `json:"slug"`
+	State         string     `json:"state"`                 // pending, loaded or failed
+	Version       string     `json:"version,omitempty"`     // content hash of the snapshot
+	LoadedAt      *time.Time `json:"loadedAt,omitempty"`    // when the snapshot was loaded
+	AgeSeconds    float64    `json:"ageSeconds,omitempty"`  // seconds since the snapshot was loaded
+	LinesExpected int        `json:"linesExpected"`         // lines returned by the 511 API
+	LinesLoaded   int        `json:"linesLoaded"`           // lines with a loaded timetable
+	LastError     string     `json:"lastError,omitempty"`   // error of the last load if it failed
+	LastErrorAt   *time.Time `json:"lastErrorAt,omitempty"` // when the last load failed
+}
+
+// KeyPoolStatus describes the availability of the 511 API keys
+type KeyPoolStatus struct {
+	Total     int `json:"total"`     // number of configured keys
+	Enabled   int `json:"enabled"`   // keys not disabled through the admin API
+	Available int `json:"available"` // enabled keys with a token available right now
+}
+
+// CacheHealth describes the proxy response cache
+type CacheHealth struct {
+	Entries int `json:"entries"` // stored entries, including expired ones
+}
+
+// GatewayStatus is the readiness report served by /status
+type GatewayStatus struct {
+	Ready     bool             `json:"ready"`
+	Problems  []string         `json:"problems,omitempty"` // reasons the gateway is not ready
+	Offline   bool             `json:"offline,omitempty"`  // serving from a data directory without the 511 API
+	Operators []OperatorStatus `json:"operators"`
+	Keys      KeyPoolStatus    `json:"keys"`
+	Cache     CacheHealth      `json:"cache"`
+}
+
+// operatorStatus reports the load state of a single operator
+func operatorStatus(store *Store, operator Operator, now time.Time) OperatorStatus {
+	status := OperatorStatus{
+		ID:    operator.ID,
+		Slug:  operator.Slug,
+		State: loadStatePending,
+	}
+
+	if failure := store.LastFailure(operator.ID); failure != nil {
+		status.State = loadStateFailed
+		status.LastError = failure.Err.Error()
+		status.LastErrorAt = &failure.At
+	}
+
+	snapshot := store.Snapshot(operator.ID)
+	if snapshot == nil {
+		return status
+	}
+	status.State = loadStateLoaded
+	status.Version = snapshot.Version
+	status.LoadedAt = &snapshot.LoadedAt
+	status.AgeSeconds = now.Sub(snapshot.LoadedAt).Seconds()
+	status.LinesExpected = len(snapshot.Lines)
+	for _, line := range snapshot.Lines {
+		if snapshot.Timetables.HasLine(line.ID) {
+			status.LinesLoaded++
+		}
+	}
+	return status
+}
+
+// keyPoolStatus reports how many keys could serve a request right now
+func keyPoolStatus(pool *KeyPool) KeyPoolStatus {
+	var status KeyPoolStatus
+	if pool == nil {
+		return status
+	}
+	for _, key := range pool.Keys {
+		status.Total++
+		if !key.Enabled() {
+			continue
+		}
+		status.Enabled++
+		if key.Limiter.Tokens() >= 1 {
+			status.Available++
+		}
+	}
+	return status
+}
+
+// gatewayStatus checks whether the gateway can serve its core endpoints:
+// every operator has timetables loaded and there is an API key for the proxy.
+// Keys that are only rate limited at the moment do not make the gateway unready.
+// Offline there is no proxy, so the keys are not checked.
+func gatewayStatus(store *Store, pool *KeyPool, responseCache *ResponseCache, offline bool) GatewayStatus {
+	now := time.Now()
+	status := GatewayStatus{
+		Ready:     true,
+		Offline:   offline,
+		Operators: make([]OperatorStatus, 0, len(store.Operators())),
+		Keys:      keyPoolStatus(pool),
+		Cache:     CacheHealth{Entries: responseCache.Len()},
+	}
+
+	for _, operator := range store.Operators() {
+		op := operatorStatus(store, operator, now)
+		status.Operators = append(status.Operators, op)
+
+		switch {
+		case op.State != loadStateLoaded:
+			status.Problems = append(status.Problems, fmt.Sprintf("timetables for operator %s are %s", op.ID, op.State))
+		case op.LinesExpected > 0 && op.LinesLoaded == 0:
+			status.Problems = append(status.Problems, fmt.Sprintf("no line timetables loaded for operator %s", op.ID))
+		}
+	}
+
+	switch {
+	case offline:
+		// There is no proxy to use the keys
+	case status.Keys.Total == 0:
+		status.Problems = append(status.Problems, "no API keys configured")
+	case status.Keys.Enabled == 0:
+		status.Problems = append(status.Problems, "all API keys are disabled")
+	}
+
+	status.Ready = len(status.Problems) == 0
+	return status
+}
+
+// readyHandler returns OK if the gateway can serve requests, or 503 with the reasons it cannot
+func readyHandler(store *Store, pool *KeyPool, responseCache *ResponseCache, offline bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := gatewayStatus(store, pool, responseCache, offline)
+		if !status.Ready {
+			http.Error(w, "Not ready: "+strings.Join(status.Problems, "; "), http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("OK"))
+	}
+}
+
+// statusHandler returns the readiness report as JSON, with status 503 if the gateway is not ready
+func statusHandler(store *Store, pool *KeyPool, responseCache *ResponseCache, offline bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := gatewayStatus(store, pool, responseCache, offline)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !status.Ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		store         func(t *testing.T) *Store
+		keys          []string
+		offline       bool
+		expectedReady bool
+		expectedState string
+		problem       string
+	}{
+		{
+			name:          "loaded with keys",
+			store:         newExampleStore,
+			keys:          []string{"key-1"},
+			expectedReady: true,
+			expectedState: loadStateLoaded,
+		},
+		{
+			name: "not loaded yet",
+			store: func(t *testing.T) *Store {
+				return NewStore([]Operator{NewOperator("CT")})
+			},
+			keys:          []string{"key-1"},
+			expectedState: loadStatePending,
+			problem:       "timetables for operator CT are pending",
+		},
+		{
+			name: "load failed",
+			store: func(t *testing.T) *Store {
+				store := NewStore([]Operator{NewOperator("CT")})
+				store.RecordFailure("CT", errors.New("unexpected status code: 401"))
+				return store
+			},
+			keys:          []string{"key-1"},
+			expectedState: loadStateFailed,
+			problem:       "timetables for operator CT are failed",
+		},
+		{
+			name:          "no API keys",
+			store:         newExampleStore,
+			expectedState: loadStateLoaded,
+			problem:       "no API keys configured",
+		},
+		{
+			name:          "offline without API keys",
+			store:         newExampleStore,
+			offline:       true,
+			expectedReady: true,
+			expectedState: loadStateLoaded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := tt.store(t)
+			pool := NewKeyPool(tt.keys, 1, 1)
+			responseCache := NewResponseCache(time.Minute, time.Minute)
+			expectedStatus := http.StatusOK
+			if !tt.expectedReady {
+				expectedStatus = http.StatusServiceUnavailable
+			}
+
+			rec := httptest.NewRecorder()
+			readyHandler(store, pool, responseCache, tt.offline)(rec, httptest.NewRequest("GET", "/ready", nil))
+			if rec.Code != expectedStatus {
+				t.Errorf("Expected /ready status %d, got %d", expectedStatus, rec.Code)
+			}
+			body, _ := io.ReadAll(rec.Body)
+			if !strings.Contains(string(body), tt.problem) {
+				t.Errorf("Expected /ready body to contain %q, got '%s'", tt.problem, string(body))
+			}
+
+			rec = httptest.NewRecorder()
+			statusHandler(store, pool, responseCache, tt.offline)(rec, httptest.NewRequest("GET", "/status", nil))
+			if rec.Code != expectedStatus {
+				t.Errorf("Expected /status status %d, got %d", expectedStatus, rec.Code)
+			}
+			var status GatewayStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatalf("failed to decode status: %v", err)
+			}
+			if status.Ready != tt.expectedReady {
+				t.Errorf("Expected ready %v, got %v", tt.expectedReady, status.Ready)
+			}
+			if status.Offline != tt.offline {
+				t.Errorf("Expected offline %v, got %v", tt.offline, status.Offline)
+			}
+			if len(status.Operators) != 1 || status.Operators[0].State != tt.expectedState {
+				t.Fatalf("Expected one operator in state %q, got %+v", tt.expectedState, status.Operators)
+			}
+			if status.Keys.Total != len(tt.keys) {
+				t.Errorf("Expected %d keys, got %d", len(tt.keys), status.Keys.Total)
+			}
+			if status.Cache.Entries != 0 {
+				t.Errorf("Expected no cache entries, got %d", status.Cache.Entries)
+			}
+		})
+	}
+}
+
+func TestOperatorStatus(t *testing.T) {
+	store := newExampleStore(t)
+	store.RecordFailure("CT", errors.New("refresh failed"))
+
+	status := operatorStatus(store, NewOperator("CT"), time.Now())
+	if status.State != loadStateLoaded {
+		t.Errorf("Expected state %q while the previous snapshot is served, got %q", loadStateLoaded, status.State)
+	}
+	if status.LastError != "refresh failed" {
+		t.Errorf("Expected last error 'refresh failed', got '%s'", status.LastError)
+	}
+	if status.LinesExpected == 0 || status.LinesLoaded == 0 || status.LinesLoaded > status.LinesExpected {
+		t.Errorf("Expected some of %d lines loaded, got %d", status.LinesExpected, status.LinesLoaded)
+	}
+	if status.Version == "" || status.LoadedAt == nil {
+		t.Error("Expected snapshot version and load time")
+	}
+
+	// Secrets of the failed request are not reported
+	store.RecordFailure("CT", errors.New(`failed to load lines: Get "http://511.example/transit/lines?api_key=status-key": EOF`))
+	status = operatorStatus(store, NewOperator("CT"), time.Now())
+	if strings.Contains(status.LastError, "status-key") || !strings.Contains(status.LastError, "api_key=REDACTED") {
+		t.Errorf("Expected the last error to have the API key redacted, got '%s'", status.LastError)
+	}
+
+	// A successful load clears the failure
+	snapshot := store.Snapshot("CT")
+	store.Set("CT", snapshot.Dataset)
+	if store.LastFailure("CT") != nil {
+		t.Error("Expected Set to clear the last failure")
+	}
+}
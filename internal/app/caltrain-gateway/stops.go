@@ -0,0 +1,67 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"caltrain-gateway/pkg/api"
+)
+
+// stopsResponse represents the root structure of the stops JSON
+type stopsResponse struct {
+	Contents struct {
+		DataObjects struct {
+			ScheduledStopPoint []Stop `json:"ScheduledStopPoint"`
+		} `json:"dataObjects"`
+	} `json:"Contents"`
+}
+
+// Stop represents a scheduled stop point from the 511 API
+type Stop = api.Stop
+
+// StopLocation holds the coordinates of a stop
+type StopLocation = api.StopLocation
+
+// LoadStopsFromFile reads and parses a stops JSON file from the given filename.
+func LoadStopsFromFile(filename string) ([]Stop, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stops file: %w", err)
+	}
+
+	return ParseStops(data)
+}
+
+// LoadStopsFromURL fetches and parses stops JSON from the given URL.
+func LoadStopsFromURL(url string) ([]Stop, error) {
+	data, _, err := fetchURL(context.Background(), url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stops from URL: %w", err)
+	}
+
+	return ParseStops(data)
+}
+
+// ParseStops parses a 511 stops response into a slice of Stop
+func ParseStops(data []byte) ([]Stop, error) {
+	// Strip UTF-8 BOM if present
+	data = bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})
+
+	var response stopsResponse
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse stops JSON: %w", err)
+	}
+	return response.Contents.DataObjects.ScheduledStopPoint, nil
+}
+
+// GetStopNames returns a map of stop IDs to stop names
+func GetStopNames(stops []Stop) map[string]string {
+	names := make(map[string]string, len(stops))
+	for _, stop := range stops {
+		names[stop.ID] = stop.Name
+	}
+	return names
+}
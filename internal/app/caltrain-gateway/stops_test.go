@@ -0,0 +1,90 @@
+package caltraingateway_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+func TestLoadStopsFromFile(t *testing.T) {
+	stops, err := caltraingateway.LoadStopsFromFile("example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+
+	if len(stops) != 32 {
+		t.Errorf("expected 32 stops, got %d", len(stops))
+	}
+
+	// Verify first stop
+	if stops[0].ID != "70011" {
+		t.Errorf("expected first stop ID '70011', got '%s'", stops[0].ID)
+	}
+	if stops[0].Name != "San Francisco Caltrain Station Northbound" {
+		t.Errorf("expected Name 'San Francisco Caltrain Station Northbound', got '%s'", stops[0].Name)
+	}
+	if stops[0].Location.Latitude == "" || stops[0].Location.Longitude == "" {
+		t.Error("expected stop location to be set")
+	}
+}
+
+func TestLoadStopsFromFile_FileNotFound(t *testing.T) {
+	_, err := caltraingateway.LoadStopsFromFile("nonexistent.json")
+	if err == nil {
+		t.Error("expected error for nonexistent file")
+	}
+}
+
+func TestLoadStopsFromURL(t *testing.T) {
+	data, err := os.ReadFile("example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to read example stops: %v", err)
+	}
+
+	// Create a mock server that prefixes the response with a UTF-8 BOM like the 511 API
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte{0xEF, 0xBB, 0xBF})
+		w.Write(data)
+	}))
+	defer mockServer.Close()
+
+	stops, err := caltraingateway.LoadStopsFromURL(mockServer.URL)
+	if err != nil {
+		t.Fatalf("failed to load stops from URL: %v", err)
+	}
+	if len(stops) != 32 {
+		t.Errorf("expected 32 stops, got %d", len(stops))
+	}
+}
+
+func TestLoadStopsFromURL_Error(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer mockServer.Close()
+
+	_, err := caltraingateway.LoadStopsFromURL(mockServer.URL)
+	if err == nil {
+		t.Error("expected error for server error response")
+	}
+}
+
+func TestGetStopNames(t *testing.T) {
+	stops, err := caltraingateway.LoadStopsFromFile("example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+
+	names := caltraingateway.GetStopNames(stops)
+	if names["70172"] != "Palo Alto Caltrain Station Southbound" {
+		t.Errorf("expected name for 70172, got '%s'", names["70172"])
+	}
+	if _, ok := names["99999"]; ok {
+		t.Error("expected no name for unknown stop")
+	}
+}
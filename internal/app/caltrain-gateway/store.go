@@ -0,0 +1,155 @@
+package caltraingateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Dataset is the static schedule data of a single operator
+type Dataset struct {
+	Lines      []Line
+	Stops      []Stop
+	Timetables *TimetableCollection
+}
+
+// Snapshot holds the dataset loaded for a single operator
+type Snapshot struct {
+	*Dataset
+	Operator   Operator
+	Version    string    // content hash of the dataset
+	LoadedAt   time.Time // when the data was loaded
+	ModifiedAt time.Time // when the data was first loaded with this version
+
+	stopNames map[string]string
+}
+
+// StopName returns the name of the given stop, or an empty string if it is unknown
+func (s *Snapshot) StopName(stopID string) string {
+	return s.stopNames[stopID]
+}
+
+// LoadFailure describes the most recent failed load of an operator
+type LoadFailure struct {
+	Err error
+	At  time.Time
+}
+
+// Store holds the current snapshot for each configured operator
+type Store struct {
+	operators []Operator
+	mu        sync.RWMutex
+	snapshots map[string]*Snapshot    // keyed by operator ID
+	failures  map[string]*LoadFailure // keyed by operator ID
+}
+
+// NewStore creates an empty Store serving the given operators
+func NewStore(operators []Operator) *Store {
+	return &Store{
+		operators: operators,
+		snapshots: make(map[string]*Snapshot),
+		failures:  make(map[string]*LoadFailure),
+	}
+}
+
+// Operators returns the configured operators
+func (s *Store) Operators() []Operator {
+	return s.operators
+}
+
+// Lookup finds a configured operator by slug or ID
+func (s *Store) Lookup(name string) (Operator, bool) {
+	for _, op := range s.operators {
+		if op.matches(name) {
+			return op, true
+		}
+	}
+	return Operator{}, false
+}
+
+// Set replaces the dataset for an operator.
+// Passing a nil dataset removes the operator's snapshot.
+func (s *Store) Set(operatorID string, data *Dataset) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data == nil {
+		delete(s.snapshots, operatorID)
+		return
+	}
+	if data.Timetables == nil {
+		data.Timetables = NewTimetableCollection()
+	}
+
+	version, err := datasetVersion(data)
+	if err != nil {
+		log.Printf("Warning: Failed to compute snapshot version for operator %s: %v", operatorID, err)
+	}
+	operator, ok := s.Lookup(operatorID)
+	if !ok {
+		operator = NewOperator(operatorID)
+	}
+	now := time.Now()
+	modifiedAt := now
+	// Reloads of unchanged data keep the responses and their validators unchanged
+	if previous := s.snapshots[operatorID]; previous != nil && version != "" && previous.Version == version {
+		modifiedAt = previous.ModifiedAt
+	}
+	delete(s.failures, operatorID)
+	s.snapshots[operatorID] = &Snapshot{
+		Dataset:    data,
+		Operator:   operator,
+		Version:    version,
+		LoadedAt:   now,
+		ModifiedAt: modifiedAt,
+		stopNames:  GetStopNames(data.Stops),
+	}
+}
+
+// Snapshot returns the current snapshot for an operator, or nil if nothing is loaded
+func (s *Store) Snapshot(operatorID string) *Snapshot {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.snapshots[operatorID]
+}
+
+// RecordFailure records that loading an operator failed.
+// The previous snapshot, if any, is kept. The failure is cleared by the next Set.
+// Secrets in the error are redacted, since failures are served by /status.
+func (s *Store) RecordFailure(operatorID string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[operatorID] = &LoadFailure{Err: redactError(err), At: time.Now()}
+}
+
+// LastFailure returns the failure of the operator's last load, or nil if it succeeded
+func (s *Store) LastFailure(operatorID string) *LoadFailure {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.failures[operatorID]
+}
+
+// datasetVersion returns a content hash over the lines, stops and timetables
+func datasetVersion(data *Dataset) (string, error) {
+	linesJSON, err := json.Marshal(data.Lines)
+	if err != nil {
+		return "", err
+	}
+	stopsJSON, err := json.Marshal(data.Stops)
+	if err != nil {
+		return "", err
+	}
+	timetablesVersion, err := data.Timetables.Version()
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write(linesJSON)
+	h.Write(stopsJSON)
+	h.Write([]byte(timetablesVersion))
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
@@ -0,0 +1,96 @@
+package caltraingateway_test
+
+import (
+	"testing"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+func TestNewOperator(t *testing.T) {
+	tests := []struct {
+		id           string
+		expectedID   string
+		expectedSlug string
+	}{
+		{"CT", "CT", "caltrain"},
+		{"ba", "BA", "bart"},
+		{" SM ", "SM", "samtrans"},
+		{"SC", "SC", "vta"},
+		{"AC", "AC", "ac"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			op := caltraingateway.NewOperator(tt.id)
+			if op.ID != tt.expectedID {
+				t.Errorf("expected ID '%s', got '%s'", tt.expectedID, op.ID)
+			}
+			if op.Slug != tt.expectedSlug {
+				t.Errorf("expected slug '%s', got '%s'", tt.expectedSlug, op.Slug)
+			}
+		})
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := caltraingateway.NewStore([]caltraingateway.Operator{
+		caltraingateway.NewOperator("CT"),
+		caltraingateway.NewOperator("BA"),
+	})
+
+	t.Run("lookup by slug and ID", func(t *testing.T) {
+		for _, name := range []string{"caltrain", "CT", "ct", "Caltrain"} {
+			op, ok := store.Lookup(name)
+			if !ok || op.ID != "CT" {
+				t.Errorf("expected %q to resolve to CT, got %+v (found=%v)", name, op, ok)
+			}
+		}
+		if _, ok := store.Lookup("vta"); ok {
+			t.Error("expected unconfigured operator not to be found")
+		}
+	})
+
+	t.Run("snapshots per operator", func(t *testing.T) {
+		if store.Snapshot("CT") != nil {
+			t.Fatal("expected no snapshot before loading")
+		}
+
+		tc := caltraingateway.NewTimetableCollection()
+		if err := tc.LoadTimetableFiles("example_timetable.json"); err != nil {
+			t.Fatalf("failed to load timetable: %v", err)
+		}
+		store.Set("CT", &caltraingateway.Dataset{Timetables: tc})
+
+		snapshot := store.Snapshot("CT")
+		if snapshot == nil {
+			t.Fatal("expected snapshot for CT")
+		}
+		if snapshot.Operator.Slug != "caltrain" {
+			t.Errorf("expected operator slug 'caltrain', got '%s'", snapshot.Operator.Slug)
+		}
+		if snapshot.Version == "" {
+			t.Error("expected snapshot version to be set")
+		}
+		if snapshot.LoadedAt.IsZero() || !snapshot.ModifiedAt.Equal(snapshot.LoadedAt) {
+			t.Error("expected snapshot load and modification time to be set")
+		}
+
+		store.Set("CT", snapshot.Dataset)
+		reloaded := store.Snapshot("CT")
+		if !reloaded.ModifiedAt.Equal(snapshot.ModifiedAt) {
+			t.Errorf("expected reload of unchanged data to keep modification time %v, got %v", snapshot.ModifiedAt, reloaded.ModifiedAt)
+		}
+		store.Set("CT", &caltraingateway.Dataset{Timetables: tc, Lines: []caltraingateway.Line{{ID: "Limited"}}})
+		if changed := store.Snapshot("CT"); !changed.ModifiedAt.After(snapshot.ModifiedAt) {
+			t.Errorf("expected changed data to update modification time, got %v", changed.ModifiedAt)
+		}
+		if store.Snapshot("BA") != nil {
+			t.Error("expected BA snapshot to be independent of CT")
+		}
+
+		store.Set("CT", nil)
+		if store.Snapshot("CT") != nil {
+			t.Error("expected snapshot to be removed")
+		}
+	})
+}
@@ -2,12 +2,17 @@ package caltraingateway
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
+
+	"caltrain-gateway/pkg/api"
 )
 
 // LoadTimetable reads and parses a timetable JSON file from the given filename.
@@ -22,20 +27,10 @@ func LoadTimetable(filename string) (*Timetable, error) {
 
 // LoadTimetableFromURL fetches and parses a timetable JSON from the given URL.
 func LoadTimetableFromURL(url string) (*Timetable, error) {
-	resp, err := http.Get(url)
+	data, _, err := fetchURL(context.Background(), url)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch timetable from URL: %w", err)
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
-
-	data, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read response body: %w", err)
-	}
 
 	return parseTimetableJSON(data)
 }
@@ -211,17 +206,7 @@ type DestinationDisplayView struct {
 }
 
 // TrainDeparture represents a train departure at a specific stop
-type TrainDeparture struct {
-	TrainID       string `json:"trainId"`       // e.g., "401"
-	Line          string `json:"line"`          // e.g., "Limited"
-	Direction     string `json:"direction"`     // e.g., "N" or "S"
-	ArrivalTime   string `json:"arrivalTime"`   // e.g., "05:43:00"
-	DepartureTime string `json:"departureTime"` // e.g., "05:43:00"
-	Destination   string `json:"destination"`   // e.g., "San Francisco"
-	DaysOffset    string `json:"daysOffset"`    // e.g., "0"
-	OnWeekdays    bool   `json:"onWeekdays"`    // true if this departure runs on weekdays
-	OnWeekends    bool   `json:"onWeekends"`    // true if this departure runs on weekends
-}
+type TrainDeparture = api.TrainDeparture
 
 // TimetableCollection holds multiple timetables (one per line)
 type TimetableCollection struct {
@@ -252,41 +237,43 @@ func (tc *TimetableCollection) AddTimetable(tt *Timetable) {
 	tc.timetables = append(tc.timetables, tt)
 }
 
+// Len returns the number of timetables in the collection
+func (tc *TimetableCollection) Len() int {
+	return len(tc.timetables)
+}
+
+// Version returns a content hash identifying the loaded timetable data.
+// Two collections holding the same timetables have the same version.
+func (tc *TimetableCollection) Version() (string, error) {
+	data, err := json.Marshal(tc.timetables)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode timetables: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
 // Weekday represents a day of the week
-type Weekday string
+type Weekday = api.Weekday
 
 const (
-	Monday    Weekday = "Monday"
-	Tuesday   Weekday = "Tuesday"
-	Wednesday Weekday = "Wednesday"
-	Thursday  Weekday = "Thursday"
-	Friday    Weekday = "Friday"
-	Saturday  Weekday = "Saturday"
-	Sunday    Weekday = "Sunday"
+	Monday    = api.Monday
+	Tuesday   = api.Tuesday
+	Wednesday = api.Wednesday
+	Thursday  = api.Thursday
+	Friday    = api.Friday
+	Saturday  = api.Saturday
+	Sunday    = api.Sunday
 )
 
 // ParseWeekday converts a string to a Weekday, returns empty string if invalid
 func ParseWeekday(s string) Weekday {
-	switch s {
-	case "Monday", "monday":
-		return Monday
-	case "Tuesday", "tuesday":
-		return Tuesday
-	case "Wednesday", "wednesday":
-		return Wednesday
-	case "Thursday", "thursday":
-		return Thursday
-	case "Friday", "friday":
-		return Friday
-	case "Saturday", "saturday":
-		return Saturday
-	case "Sunday", "sunday":
-		return Sunday
-	default:
-		return ""
-	}
+	return api.ParseWeekday(s)
 }
 
+// Weekdays lists all days of the week starting with Monday
+var Weekdays = api.Weekdays
+
 // isValidForWeekday checks if a timetable frame is valid for the given weekday
 func (t *Timetable) isValidForWeekday(frame TimetableFrame, weekday Weekday) bool {
 	dayTypeRef := frame.FrameValidityConditions.AvailabilityCondition.DayTypes.DayTypeRef.Ref
@@ -302,6 +289,16 @@ func (t *Timetable) isValidForWeekday(frame TimetableFrame, weekday Weekday) boo
 	return false
 }
 
+// lineForRoute looks up the line name of a route, falling back to the route ID
+func (t *Timetable) lineForRoute(routeID string) string {
+	for _, route := range t.Content.ServiceFrame.Routes.Route {
+		if route.ID == routeID {
+			return route.LineRef.Ref
+		}
+	}
+	return routeID
+}
+
 // GetDeparturesByStop returns a map of stop IDs to their train departures.
 // Each stop ID maps to a slice of TrainDeparture containing all trains
 // that stop at that location.
@@ -321,17 +318,9 @@ func (t *Timetable) GetDeparturesByStopAndWeekday(weekday Weekday) map[string][]
 		}
 
 		for _, journey := range frame.VehicleJourneys.ServiceJourney {
-			line := journey.JourneyPatternView.RouteRef.Ref
+			line := t.lineForRoute(journey.JourneyPatternView.RouteRef.Ref)
 			direction := journey.JourneyPatternView.DirectionRef.Ref
 
-			// Look up the line name from the route
-			for _, route := range t.Content.ServiceFrame.Routes.Route {
-				if route.ID == line {
-					line = route.LineRef.Ref
-					break
-				}
-			}
-
 			for _, call := range journey.Calls.Call {
 				stopID := call.ScheduledStopPointRef.Ref
 				departure := TrainDeparture{
@@ -371,3 +360,115 @@ func (tc *TimetableCollection) GetDeparturesByStopAndWeekday(weekday Weekday) ma
 
 	return result
 }
+
+// LineRoute describes one route of a line with its ordered stops
+type LineRoute = api.LineRoute
+
+// HasLine reports whether any timetable contains a route of the given line
+func (tc *TimetableCollection) HasLine(lineID string) bool {
+	for _, tt := range tc.timetables {
+		for _, route := range tt.Content.ServiceFrame.Routes.Route {
+			if route.LineRef.Ref == lineID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetRoutesByLine returns the routes of the given line from all timetables.
+// Routes that appear in several timetables are only returned once.
+func (tc *TimetableCollection) GetRoutesByLine(lineID string) []LineRoute {
+	routes := make([]LineRoute, 0)
+	seen := make(map[string]bool)
+
+	for _, tt := range tc.timetables {
+		for _, route := range tt.Content.ServiceFrame.Routes.Route {
+			if route.LineRef.Ref != lineID || seen[route.ID] {
+				continue
+			}
+			seen[route.ID] = true
+
+			stops := make([]string, 0, len(route.PointsInSequence.PointOnRoute))
+			for _, point := range route.PointsInSequence.PointOnRoute {
+				stops = append(stops, point.PointRef.Ref)
+			}
+			routes = append(routes, LineRoute{
+				ID:        route.ID,
+				Name:      route.Name,
+				Direction: strings.TrimSpace(route.DirectionRef.Ref),
+				Stops:     stops,
+			})
+		}
+	}
+
+	return routes
+}
+
+// TrainCall represents a single stop of a train in its stopping pattern
+type TrainCall = api.TrainCall
+
+// TrainDetail represents a single train with its full stopping pattern
+type TrainDetail = api.TrainDetail
+
+// GetTrain returns the train with the given ID and its calls ordered by stop sequence.
+// If the train appears in several timetable frames, the days of operation are combined.
+func (tc *TimetableCollection) GetTrain(trainID string) (*TrainDetail, bool) {
+	var train *TrainDetail
+	days := make(map[Weekday]bool)
+
+	for _, tt := range tc.timetables {
+		for _, frame := range tt.Content.TimetableFrame {
+			for _, journey := range frame.VehicleJourneys.ServiceJourney {
+				if journey.ID != trainID {
+					continue
+				}
+
+				for _, weekday := range Weekdays {
+					if tt.isValidForWeekday(frame, weekday) {
+						days[weekday] = true
+					}
+				}
+				if train != nil {
+					continue
+				}
+
+				train = &TrainDetail{
+					TrainID:   journey.ID,
+					Line:      tt.lineForRoute(journey.JourneyPatternView.RouteRef.Ref),
+					Direction: strings.TrimSpace(journey.JourneyPatternView.DirectionRef.Ref),
+					Calls:     make([]TrainCall, 0, len(journey.Calls.Call)),
+				}
+				for _, call := range journey.Calls.Call {
+					order, _ := strconv.Atoi(call.Order)
+					train.Calls = append(train.Calls, TrainCall{
+						Order:               order,
+						StopID:              call.ScheduledStopPointRef.Ref,
+						ArrivalTime:         call.Arrival.Time,
+						ArrivalDaysOffset:   call.Arrival.DaysOffset,
+						DepartureTime:       call.Departure.Time,
+						DepartureDaysOffset: call.Departure.DaysOffset,
+						Destination:         call.DestinationDisplayView.Name,
+					})
+				}
+				slices.SortStableFunc(train.Calls, func(a, b TrainCall) int {
+					return a.Order - b.Order
+				})
+			}
+		}
+	}
+
+	if train == nil {
+		return nil, false
+	}
+
+	train.Days = make([]Weekday, 0, len(days))
+	for _, weekday := range Weekdays {
+		if days[weekday] {
+			train.Days = append(train.Days, weekday)
+		}
+	}
+	train.OnWeekdays = slices.ContainsFunc(train.Days, func(d Weekday) bool { return d != Saturday && d != Sunday })
+	train.OnWeekends = days[Saturday] || days[Sunday]
+	return train, true
+}
@@ -270,3 +270,76 @@ func TestParseWeekday(t *testing.T) {
 		})
 	}
 }
+
+func TestGetRoutesByLine(t *testing.T) {
+	tc := caltraingateway.NewTimetableCollection()
+	// Loading the same file twice must not duplicate routes
+	if err := tc.LoadTimetableFiles("example_timetable.json", "example_timetable.json"); err != nil {
+		t.Fatalf("failed to load timetable files: %v", err)
+	}
+
+	routes := tc.GetRoutesByLine("Limited")
+	if len(routes) != 2 {
+		t.Fatalf("expected 2 routes, got %d", len(routes))
+	}
+
+	northbound := routes[0]
+	if northbound.ID != "3206643" {
+		t.Errorf("expected route ID '3206643', got '%s'", northbound.ID)
+	}
+	if northbound.Direction != "N" {
+		t.Errorf("expected direction 'N', got '%s'", northbound.Direction)
+	}
+	if len(northbound.Stops) == 0 || northbound.Stops[0] != "70261" {
+		t.Errorf("expected first stop '70261', got %v", northbound.Stops)
+	}
+
+	if routes := tc.GetRoutesByLine("Express"); len(routes) != 0 {
+		t.Errorf("expected no routes for Express, got %d", len(routes))
+	}
+}
+
+func TestGetTrain(t *testing.T) {
+	tc := caltraingateway.NewTimetableCollection()
+	if err := tc.LoadTimetableFiles("example_timetable.json"); err != nil {
+		t.Fatalf("failed to load timetable files: %v", err)
+	}
+
+	train, ok := tc.GetTrain("401")
+	if !ok {
+		t.Fatal("expected to find train 401")
+	}
+
+	if train.Line != "Limited" {
+		t.Errorf("expected line 'Limited', got '%s'", train.Line)
+	}
+	if train.Direction != "N" {
+		t.Errorf("expected direction 'N', got '%s'", train.Direction)
+	}
+	if len(train.Days) != 5 || train.Days[0] != caltraingateway.Monday || train.Days[4] != caltraingateway.Friday {
+		t.Errorf("expected Monday to Friday, got %v", train.Days)
+	}
+	if !train.OnWeekdays || train.OnWeekends {
+		t.Errorf("expected weekday-only train, got onWeekdays=%v onWeekends=%v", train.OnWeekdays, train.OnWeekends)
+	}
+
+	if len(train.Calls) == 0 {
+		t.Fatal("expected calls for train 401")
+	}
+	first := train.Calls[0]
+	if first.Order != 1 || first.StopID != "70261" {
+		t.Errorf("expected first call at 70261 with order 1, got %+v", first)
+	}
+	if first.DepartureTime != "05:43:00" {
+		t.Errorf("expected departure time '05:43:00', got '%s'", first.DepartureTime)
+	}
+	for i := 1; i < len(train.Calls); i++ {
+		if train.Calls[i].Order <= train.Calls[i-1].Order {
+			t.Errorf("expected calls in stop order, got %d after %d", train.Calls[i].Order, train.Calls[i-1].Order)
+		}
+	}
+
+	if _, ok := tc.GetTrain("999"); ok {
+		t.Error("expected train 999 not to be found")
+	}
+}
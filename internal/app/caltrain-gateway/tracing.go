@@ -0,0 +1,121 @@
+package caltraingateway
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the gateway's spans
+const tracerName = "caltrain-gateway"
+
+// Supported tracing exporters
+const (
+	TracingExporterNone   = "none"
+	TracingExporterStdout = "stdout"
+	TracingExporterOTLP   = "otlp"
+)
+
+// tracePropagator reads and writes W3C trace context and baggage headers
+var tracePropagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// NewTracerProvider creates a tracer provider exporting spans with the given exporter.
+// The stdout exporter writes to w, the OTLP exporter sends spans over HTTP and is
+// configured with the standard OTEL_EXPORTER_OTLP_* environment variables.
+// The returned function flushes and stops the exporter.
+func NewTracerProvider(ctx context.Context, exporter string, w io.Writer) (trace.TracerProvider, func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case TracingExporterNone, "":
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	case TracingExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(w))
+	case TracingExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, nil, fmt.Errorf("invalid tracing exporter %q, expected none, stdout or otlp", exporter)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create %s trace exporter: %w", exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", tracerName)))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	return tp, tp.Shutdown, nil
+}
+
+// newTracer returns the gateway's tracer from the provider, or from the global provider if nil
+func newTracer(tp trace.TracerProvider) trace.Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// endSpan records the error, if any, on the span and ends it.
+// Secrets in the error are redacted as in logs, since spans leave the gateway.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		err = redactError(err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// traceMiddleware starts a server span for each request, continuing the trace
+// of the client if it sent W3C trace context headers
+func traceMiddleware(tracer trace.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := tracePropagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer))
+		defer span.End()
+
+		r = r.WithContext(ctx)
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		span.SetAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.Int("http.response.status_code", rec.Status()),
+		)
+		if rec.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.Status()))
+		}
+	})
+}
+
+// traceRouteMiddleware names the request's server span after the route matched by
+// the mux. It must wrap the mux directly, as the mux only sets the pattern on the
+// request it receives.
+func traceRouteMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r)
+		if r.Pattern != "" {
+			span := trace.SpanFromContext(r.Context())
+			span.SetName(r.Pattern)
+			span.SetAttributes(attribute.String("http.route", r.Pattern))
+		}
+	})
+}
@@ -0,0 +1,153 @@
+package caltraingateway
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// findSpan returns the first recorded span with the given name
+func findSpan(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// spanAttribute returns the value of the span's attribute with the given key
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracing_Proxy(t *testing.T) {
+	mockAPI := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status": "ok"}`))
+	}))
+	defer mockAPI.Close()
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	cfg := DefaultConfig()
+	cfg.APIBaseURL = mockAPI.URL + "/"
+	handler, err := NewHandler(Deps{
+		Config:         cfg,
+		KeyPool:        NewKeyPool([]string{"trace-key"}, 100, 10),
+		Store:          newExampleStore(t),
+		TracerProvider: tp,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+
+	// The client's W3C trace context is continued by the gateway
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/transit/stops?agency=CT", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	spans := recorder.Ended()
+	server := findSpan(spans, "/")
+	if server == nil {
+		t.Fatal("Expected a server span named after the route")
+	}
+	if server.SpanKind() != trace.SpanKindServer {
+		t.Errorf("Expected server span kind, got %s", server.SpanKind())
+	}
+	if got := server.SpanContext().TraceID().String(); got != traceID {
+		t.Errorf("Expected trace ID %s, got %s", traceID, got)
+	}
+
+	for _, name := range []string{"cache lookup", "singleflight", "acquire API key", "511 GET transit/stops"} {
+		span := findSpan(spans, name)
+		if span == nil {
+			t.Errorf("Expected span %q", name)
+			continue
+		}
+		if span.SpanContext().TraceID().String() != traceID {
+			t.Errorf("Expected span %q to belong to trace %s", name, traceID)
+		}
+	}
+
+	if span := findSpan(spans, "cache lookup"); span != nil {
+		if v, _ := spanAttribute(span, "cache.result"); v.AsString() != "miss" {
+			t.Errorf("Expected cache.result 'miss', got '%s'", v.AsString())
+		}
+	}
+	if span := findSpan(spans, "acquire API key"); span != nil {
+		if v, _ := spanAttribute(span, "apikey.index"); v.AsInt64() != 1 {
+			t.Errorf("Expected apikey.index 1, got %d", v.AsInt64())
+		}
+	}
+	if span := findSpan(spans, "511 GET transit/stops"); span != nil {
+		if v, _ := spanAttribute(span, "http.response.status_code"); v.AsInt64() != http.StatusOK {
+			t.Errorf("Expected status code attribute %d, got %d", http.StatusOK, v.AsInt64())
+		}
+		if wait := findSpan(spans, "singleflight"); wait != nil && span.Parent().SpanID() != wait.SpanContext().SpanID() {
+			t.Error("Expected the upstream span to be a child of the singleflight span")
+		}
+	}
+}
+
+func TestEndSpan_RedactsError(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	_, span := newTracer(tp).Start(context.Background(), "511 GET transit/lines")
+	endSpan(span, errors.New(`Get "http://511.example/transit/lines?api_key=span-key": connection refused`))
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("Expected 1 span, got %d", len(spans))
+	}
+	if desc := spans[0].Status().Description; strings.Contains(desc, "span-key") || !strings.Contains(desc, "api_key=REDACTED") {
+		t.Errorf("Expected the status description to have the API key redacted, got %q", desc)
+	}
+	for _, event := range spans[0].Events() {
+		for _, kv := range event.Attributes {
+			if strings.Contains(kv.Value.Emit(), "span-key") {
+				t.Errorf("Expected event %q not to contain the API key, got %s=%q", event.Name, kv.Key, kv.Value.Emit())
+			}
+		}
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	if _, _, err := NewTracerProvider(context.Background(), "jaeger", nil); err == nil {
+		t.Error("Expected error for unknown exporter, got nil")
+	}
+
+	var buf bytes.Buffer
+	tp, shutdown, err := NewTracerProvider(context.Background(), TracingExporterStdout, &buf)
+	if err != nil {
+		t.Fatalf("NewTracerProvider() error: %v", err)
+	}
+	_, span := tp.Tracer("test").Start(context.Background(), "stdout span")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+	if !strings.Contains(buf.String(), "stdout span") {
+		t.Errorf("Expected the span to be written to stdout exporter, got %q", buf.String())
+	}
+}
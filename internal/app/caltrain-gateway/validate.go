@@ -0,0 +1,208 @@
+package caltraingateway
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Issue is a problem found in an operator directory by ValidateDir
+type Issue struct {
+	File    string `json:"file"`
+	Message string `json:"message"`
+	// Warning is set for problems the gateway can serve despite, e.g. a line without timetable
+	Warning bool `json:"warning,omitempty"`
+}
+
+// String formats the issue as "error: file: message" or "warning: file: message"
+func (i Issue) String() string {
+	level := "error"
+	if i.Warning {
+		level = "warning"
+	}
+	return fmt.Sprintf("%s: %s: %s", level, i.File, i.Message)
+}
+
+// HasErrors reports whether any of the issues is not a warning
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if !issue.Warning {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDir checks an operator directory in the layout read by LoadDatasetDir
+// for structural problems. Timetables that expired before now are reported as warnings.
+func ValidateDir(dir string, now time.Time) []Issue {
+	var issues []Issue
+	report := func(file string, warning bool, format string, args ...any) {
+		issues = append(issues, Issue{File: filepath.Join(dir, file), Message: fmt.Sprintf(format, args...), Warning: warning})
+	}
+
+	lines, err := LoadLinesFromFile(filepath.Join(dir, linesFileName))
+	if err != nil {
+		report(linesFileName, false, "%v", err)
+	} else if len(lines) == 0 {
+		report(linesFileName, false, "no lines")
+	}
+	lineIDs := make(map[string]bool)
+	for i, line := range lines {
+		switch {
+		case line.ID == "":
+			report(linesFileName, false, "line %d has no Id", i+1)
+		case lineIDs[line.ID]:
+			report(linesFileName, false, "duplicate line %s", line.ID)
+		}
+		lineIDs[line.ID] = true
+	}
+
+	var stopIDs map[string]bool
+	stops, err := LoadStopsFromFile(filepath.Join(dir, stopsFileName))
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		report(stopsFileName, true, "missing, trains will have no station names")
+	case err != nil:
+		report(stopsFileName, false, "%v", err)
+	default:
+		stopIDs = make(map[string]bool, len(stops))
+		for _, stop := range stops {
+			stopIDs[stop.ID] = true
+		}
+	}
+
+	filenames, err := filepath.Glob(filepath.Join(dir, timetablesDirName, "*.json"))
+	if err != nil {
+		report(timetablesDirName, false, "%v", err)
+	}
+	if len(filenames) == 0 {
+		report(timetablesDirName, false, "no timetables")
+	}
+	tc := NewTimetableCollection()
+	for _, filename := range filenames {
+		file, _ := filepath.Rel(dir, filename)
+		tt, err := LoadTimetable(filename)
+		if err != nil {
+			report(file, false, "%v", err)
+			continue
+		}
+		tc.AddTimetable(tt)
+
+		for _, problem := range tt.validate() {
+			report(file, false, "%s", problem)
+		}
+		for _, route := range tt.Content.ServiceFrame.Routes.Route {
+			if lines != nil && !lineIDs[route.LineRef.Ref] {
+				report(file, true, "route %s belongs to line %s, which is not in %s", route.ID, route.LineRef.Ref, linesFileName)
+			}
+		}
+		if unknown := tt.unknownStops(stopIDs); len(unknown) > 0 {
+			report(file, true, "%d stops are not in %s, e.g. %s", len(unknown), stopsFileName, unknown[0])
+		}
+		if _, to := tt.validity(); to != "" && to < now.Format(time.DateOnly) {
+			report(file, true, "expired on %s", to)
+		}
+	}
+
+	for _, line := range lines {
+		if line.ID != "" && !tc.HasLine(line.ID) {
+			report(linesFileName, true, "line %s has no timetable", line.ID)
+		}
+	}
+	return issues
+}
+
+// validate returns the structural problems of the timetable that would make
+// trains or departures disappear or show up wrong
+func (t *Timetable) validate() []string {
+	var problems []string
+
+	routes := make(map[string]bool)
+	for _, route := range t.Content.ServiceFrame.Routes.Route {
+		routes[route.ID] = true
+	}
+	if len(routes) == 0 {
+		problems = append(problems, "no routes")
+	}
+	dayTypes := make(map[string]bool)
+	for _, dayType := range t.Content.ServiceCalendarFrame.DayTypes.DayType {
+		dayTypes[dayType.ID] = true
+	}
+
+	journeys := 0
+	for _, frame := range t.Content.TimetableFrame {
+		if ref := frame.FrameValidityConditions.AvailabilityCondition.DayTypes.DayTypeRef.Ref; !dayTypes[ref] {
+			problems = append(problems, fmt.Sprintf("frame %s references unknown day type %q", frame.ID, ref))
+		}
+		for _, journey := range frame.VehicleJourneys.ServiceJourney {
+			journeys++
+			if journey.ID == "" {
+				problems = append(problems, fmt.Sprintf("frame %s has a train without id", frame.ID))
+				continue
+			}
+			if ref := journey.JourneyPatternView.RouteRef.Ref; !routes[ref] {
+				problems = append(problems, fmt.Sprintf("train %s references unknown route %q", journey.ID, ref))
+			}
+			if len(journey.Calls.Call) == 0 {
+				problems = append(problems, fmt.Sprintf("train %s has no calls", journey.ID))
+			}
+			for _, call := range journey.Calls.Call {
+				if call.ScheduledStopPointRef.Ref == "" {
+					problems = append(problems, fmt.Sprintf("train %s has a call without stop", journey.ID))
+					continue
+				}
+				for _, clock := range []string{call.Arrival.Time, call.Departure.Time} {
+					if _, err := time.Parse(time.TimeOnly, clock); err != nil {
+						problems = append(problems, fmt.Sprintf("train %s has invalid time %q at stop %s", journey.ID, clock, call.ScheduledStopPointRef.Ref))
+						break
+					}
+				}
+			}
+		}
+	}
+	if journeys == 0 {
+		problems = append(problems, "no trains")
+	}
+	return problems
+}
+
+// unknownStops returns the stops called at that are not in the given set,
+// or nil if the set is nil
+func (t *Timetable) unknownStops(stopIDs map[string]bool) []string {
+	if stopIDs == nil {
+		return nil
+	}
+	var unknown []string
+	seen := make(map[string]bool)
+	for _, frame := range t.Content.TimetableFrame {
+		for _, journey := range frame.VehicleJourneys.ServiceJourney {
+			for _, call := range journey.Calls.Call {
+				ref := call.ScheduledStopPointRef.Ref
+				if ref != "" && !stopIDs[ref] && !seen[ref] {
+					seen[ref] = true
+					unknown = append(unknown, ref)
+				}
+			}
+		}
+	}
+	return unknown
+}
+
+// validity returns the first and last date (YYYY-MM-DD) any frame of the timetable is valid on,
+// or empty strings if no frame has dates
+func (t *Timetable) validity() (from, to string) {
+	for _, frame := range t.Content.TimetableFrame {
+		condition := frame.FrameValidityConditions.AvailabilityCondition
+		if date, _, ok := strings.Cut(condition.FromDate, "T"); ok && (from == "" || date < from) {
+			from = date
+		}
+		if date, _, ok := strings.Cut(condition.ToDate, "T"); ok && date > to {
+			to = date
+		}
+	}
+	return from, to
+}
@@ -0,0 +1,133 @@
+package caltraingateway
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateDir(t *testing.T) {
+	// A day the example timetable is valid on
+	now := time.Date(2026, time.March, 2, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name             string
+		modify           func(t *testing.T, dir string)
+		now              time.Time
+		expectedErrors   []string
+		expectedWarnings []string
+	}{
+		{
+			name:             "example data",
+			now:              now,
+			expectedWarnings: []string{"line South County has no timetable", "line Express has no timetable"},
+		},
+		{
+			name:             "expired timetable",
+			now:              time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC),
+			expectedWarnings: []string{"expired on 2026-08-31"},
+		},
+		{
+			name: "missing lines and stops",
+			modify: func(t *testing.T, dir string) {
+				os.Remove(filepath.Join(dir, linesFileName))
+				os.Remove(filepath.Join(dir, stopsFileName))
+			},
+			now:              now,
+			expectedErrors:   []string{"failed to read lines file"},
+			expectedWarnings: []string{"missing, trains will have no station names"},
+		},
+		{
+			name: "broken timetable",
+			modify: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, timetablesDirName, "Local Weekday.json"), "{")
+			},
+			now:            now,
+			expectedErrors: []string{"Local Weekday.json: failed to parse timetable JSON"},
+		},
+		{
+			name: "timetable without trains",
+			modify: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, timetablesDirName, "Express.json"), `{"Content": {"ServiceFrame": {"routes": {"Route": [{"id": "1", "LineRef": {"ref": "Bullet"}}]}}}}`)
+			},
+			now:              now,
+			expectedErrors:   []string{"Express.json: no trains"},
+			expectedWarnings: []string{"route 1 belongs to line Bullet, which is not in lines.json"},
+		},
+		{
+			name: "invalid times and unknown stops",
+			modify: func(t *testing.T, dir string) {
+				filename := filepath.Join(dir, timetablesDirName, "Limited.json")
+				tt, err := LoadTimetable(filename)
+				if err != nil {
+					t.Fatalf("failed to load timetable: %v", err)
+				}
+				calls := tt.Content.TimetableFrame[0].VehicleJourneys.ServiceJourney[0].Calls.Call
+				calls[0].Arrival.Time = "5:43"
+				calls[1].ScheduledStopPointRef.Ref = "99999"
+				data, err := json.Marshal(tt)
+				if err != nil {
+					t.Fatalf("failed to encode timetable: %v", err)
+				}
+				writeTestFile(t, filename, string(data))
+			},
+			now:              now,
+			expectedErrors:   []string{`train 401 has invalid time "5:43" at stop 70261`},
+			expectedWarnings: []string{"1 stops are not in stops.json, e.g. 99999"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := OperatorDir(newExampleDataDir(t), "CT")
+			if tt.modify != nil {
+				tt.modify(t, dir)
+			}
+
+			issues := ValidateDir(dir, tt.now)
+
+			var errs, warnings []string
+			for _, issue := range issues {
+				if issue.Warning {
+					warnings = append(warnings, issue.String())
+				} else {
+					errs = append(errs, issue.String())
+				}
+			}
+			if HasErrors(issues) != (len(tt.expectedErrors) > 0) {
+				t.Errorf("Expected errors %v, got %v", tt.expectedErrors, errs)
+			}
+			for _, expected := range tt.expectedErrors {
+				if !containsSubstring(errs, expected) {
+					t.Errorf("Expected an error containing %q, got %v", expected, errs)
+				}
+			}
+			for _, expected := range tt.expectedWarnings {
+				if !containsSubstring(warnings, expected) {
+					t.Errorf("Expected a warning containing %q, got %v", expected, warnings)
+				}
+			}
+		})
+	}
+}
+
+// writeTestFile writes content to filename
+func writeTestFile(t *testing.T, filename, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+		t.Fatalf("failed to write %s: %v", filename, err)
+	}
+}
+
+// containsSubstring reports whether any of the strings contains substr
+func containsSubstring(s []string, substr string) bool {
+	for _, v := range s {
+		if strings.Contains(v, substr) {
+			return true
+		}
+	}
+	return false
+}
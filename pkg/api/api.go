@@ -0,0 +1,44 @@
+// Package api defines the requests and responses of the Caltrain gateway's /v1 API.
+// It is shared by the gateway and its clients and has no dependencies of its own.
+package api
+
+import "time"
+
+// APIError describes why a request failed
+type APIError struct {
+	// Status is the HTTP status code of the response
+	Status int `json:"-"`
+	// Code identifies the kind of error, e.g. "train_not_found"
+	Code string `json:"code"`
+	// Message is a human readable description of the error
+	Message string `json:"message"`
+	// UpstreamStatus is the status code returned by the 511 API, if it caused the error
+	UpstreamStatus int `json:"upstreamStatus,omitempty"`
+	// Retryable reports whether the same request may succeed later
+	Retryable bool `json:"retryable"`
+	// RequestID is the ID of the request in the gateway's logs
+	RequestID string `json:"requestId,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// ErrorEnvelope is the body of a failed /v1 response
+type ErrorEnvelope struct {
+	Error *APIError `json:"error"`
+}
+
+// Meta describes the data of a /v1 response
+type Meta struct {
+	// Version identifies the loaded timetable snapshot
+	Version string `json:"version,omitempty"`
+	// LoadedAt is when this version of the snapshot was first loaded
+	LoadedAt time.Time `json:"loadedAt,omitzero"`
+}
+
+// DataEnvelope is the body of a successful /v1 response
+type DataEnvelope[T any] struct {
+	Data T     `json:"data"`
+	Meta *Meta `json:"meta,omitempty"`
+}
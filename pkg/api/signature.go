@@ -0,0 +1,53 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a request signed with a client's signing key
+const (
+	SignatureClientHeader    = "X-Signature-Client"
+	SignatureTimestampHeader = "X-Signature-Timestamp"
+	SignatureNonceHeader     = "X-Signature-Nonce"
+	SignatureHeader          = "X-Signature"
+)
+
+// SignaturePayload returns the string signed for a request: the method, escaped
+// path, query, timestamp and nonce, separated by newlines. The query parameters
+// are sorted by key so clients need not preserve their order.
+func SignaturePayload(method, escapedPath string, query url.Values, timestamp, nonce string) string {
+	return strings.Join([]string{
+		method,
+		escapedPath,
+		query.Encode(),
+		timestamp,
+		nonce,
+	}, "\n")
+}
+
+// Sign returns the hex-encoded HMAC-SHA256 of the payload with the signing key
+func Sign(key, payload string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignRequest signs the request for the named client with its signing key,
+// setting the signature headers with the given time and a random nonce
+func SignRequest(r *http.Request, client, key string, now time.Time) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	nonce := rand.Text()
+
+	r.Header.Set(SignatureClientHeader, client)
+	r.Header.Set(SignatureTimestampHeader, timestamp)
+	r.Header.Set(SignatureNonceHeader, nonce)
+	r.Header.Set(SignatureHeader, Sign(key, SignaturePayload(r.Method, r.URL.EscapedPath(), r.URL.Query(), timestamp, nonce)))
+}
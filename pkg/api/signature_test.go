@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestSignaturePayload(t *testing.T) {
+	query := url.Values{"weekday": {"monday"}, "station": {"Palo Alto"}}
+	expected := "GET\n/v1/caltrain/timetable\nstation=Palo+Alto&weekday=monday\n1767225600\nq8ZL3kT0"
+	if got := SignaturePayload("GET", "/v1/caltrain/timetable", query, "1767225600", "q8ZL3kT0"); got != expected {
+		t.Errorf("Expected payload %q, got %q", expected, got)
+	}
+}
+
+func TestSignRequest(t *testing.T) {
+	req := httptest.NewRequest("GET", "/v1/caltrain/timetable?weekday=monday", nil)
+	now := time.Unix(1767225600, 0)
+	SignRequest(req, "display", "display-signing-key", now)
+
+	if req.Header.Get(SignatureClientHeader) != "display" || req.Header.Get(SignatureTimestampHeader) != "1767225600" {
+		t.Errorf("Unexpected signature headers: %v", req.Header)
+	}
+	nonce := req.Header.Get(SignatureNonceHeader)
+	expected := Sign("display-signing-key", SignaturePayload("GET", "/v1/caltrain/timetable", req.URL.Query(), "1767225600", nonce))
+	if got := req.Header.Get(SignatureHeader); got != expected {
+		t.Errorf("Expected signature %s, got %s", expected, got)
+	}
+}
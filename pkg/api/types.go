@@ -0,0 +1,145 @@
+package api
+
+import (
+	"strings"
+	"time"
+)
+
+// Line represents a transit line from the 511 API
+type Line struct {
+	ID            string `json:"Id"`
+	Name          string `json:"Name"`
+	FromDate      string `json:"FromDate"`
+	ToDate        string `json:"ToDate"`
+	TransportMode string `json:"TransportMode"`
+	PublicCode    string `json:"PublicCode"`
+	SiriLineRef   string `json:"SiriLineRef"`
+	Monitored     bool   `json:"Monitored"`
+	OperatorRef   string `json:"OperatorRef"`
+}
+
+// IsValidAt reports whether t falls within the line's FromDate and ToDate.
+// Missing or malformed dates are treated as unbounded.
+func (l Line) IsValidAt(t time.Time) bool {
+	if from, err := time.Parse(time.RFC3339, l.FromDate); err == nil && t.Before(from) {
+		return false
+	}
+	if to, err := time.Parse(time.RFC3339, l.ToDate); err == nil && t.After(to) {
+		return false
+	}
+	return true
+}
+
+// IsValidOn reports whether the line is valid on the given calendar date (YYYY-MM-DD).
+// The date is compared against the date part of FromDate and ToDate, which are
+// expressed in the operator's local time.
+func (l Line) IsValidOn(date string) bool {
+	if from, _, ok := strings.Cut(l.FromDate, "T"); ok && date < from {
+		return false
+	}
+	if to, _, ok := strings.Cut(l.ToDate, "T"); ok && date > to {
+		return false
+	}
+	return true
+}
+
+// LineDetail is a line together with its routes and stop sequences
+type LineDetail struct {
+	Line
+	Routes []LineRoute `json:"Routes"`
+}
+
+// LineRoute describes one route of a line with its ordered stops
+type LineRoute struct {
+	ID        string   `json:"id"`        // e.g., "3206643"
+	Name      string   `json:"name"`      // e.g., "Limited:N :Year Round starting 1/31/2026 (Weekday)"
+	Direction string   `json:"direction"` // e.g., "N"
+	Stops     []string `json:"stops"`     // stop IDs in travel order
+}
+
+// Stop represents a scheduled stop point from the 511 API
+type Stop struct {
+	ID       string       `json:"id"`
+	Name     string       `json:"Name"`
+	Location StopLocation `json:"Location"`
+}
+
+// StopLocation holds the coordinates of a stop
+type StopLocation struct {
+	Longitude string `json:"Longitude"`
+	Latitude  string `json:"Latitude"`
+}
+
+// TrainDeparture represents a train departure at a specific stop
+type TrainDeparture struct {
+	TrainID       string `json:"trainId"`       // e.g., "401"
+	Line          string `json:"line"`          // e.g., "Limited"
+	Direction     string `json:"direction"`     // e.g., "N" or "S"
+	ArrivalTime   string `json:"arrivalTime"`   // e.g., "05:43:00"
+	DepartureTime string `json:"departureTime"` // e.g., "05:43:00"
+	Destination   string `json:"destination"`   // e.g., "San Francisco"
+	DaysOffset    string `json:"daysOffset"`    // e.g., "0"
+	OnWeekdays    bool   `json:"onWeekdays"`    // true if this departure runs on weekdays
+	OnWeekends    bool   `json:"onWeekends"`    // true if this departure runs on weekends
+}
+
+// TrainDetail represents a single train with its full stopping pattern
+type TrainDetail struct {
+	TrainID    string      `json:"trainId"`    // e.g., "401"
+	Line       string      `json:"line"`       // e.g., "Limited"
+	Direction  string      `json:"direction"`  // e.g., "N"
+	Days       []Weekday   `json:"days"`       // days of the week the train operates
+	OnWeekdays bool        `json:"onWeekdays"` // true if the train runs on weekdays
+	OnWeekends bool        `json:"onWeekends"` // true if the train runs on weekends
+	Calls      []TrainCall `json:"calls"`      // stops in travel order
+}
+
+// TrainCall represents a single stop of a train in its stopping pattern
+type TrainCall struct {
+	Order               int    `json:"order"`               // e.g., 1
+	StopID              string `json:"stopId"`              // e.g., "70261"
+	StationName         string `json:"stationName"`         // e.g., "San Jose Diridon Caltrain Station Northbound"
+	ArrivalTime         string `json:"arrivalTime"`         // e.g., "05:43:00"
+	ArrivalDaysOffset   string `json:"arrivalDaysOffset"`   // e.g., "0"
+	DepartureTime       string `json:"departureTime"`       // e.g., "05:43:00"
+	DepartureDaysOffset string `json:"departureDaysOffset"` // e.g., "0"
+	Destination         string `json:"destination"`         // e.g., "San Francisco"
+}
+
+// Weekday represents a day of the week
+type Weekday string
+
+const (
+	Monday    Weekday = "Monday"
+	Tuesday   Weekday = "Tuesday"
+	Wednesday Weekday = "Wednesday"
+	Thursday  Weekday = "Thursday"
+	Friday    Weekday = "Friday"
+	Saturday  Weekday = "Saturday"
+	Sunday    Weekday = "Sunday"
+)
+
+// ParseWeekday converts a string to a Weekday, returns empty string if invalid
+func ParseWeekday(s string) Weekday {
+	switch s {
+	case "Monday", "monday":
+		return Monday
+	case "Tuesday", "tuesday":
+		return Tuesday
+	case "Wednesday", "wednesday":
+		return Wednesday
+	case "Thursday", "thursday":
+		return Thursday
+	case "Friday", "friday":
+		return Friday
+	case "Saturday", "saturday":
+		return Saturday
+	case "Sunday", "sunday":
+		return Sunday
+	default:
+		return ""
+	}
+}
+
+// Weekdays lists all days of the week starting with Monday
+var Weekdays = []Weekday{Monday, Tuesday, Wednesday, Thursday, Friday, Saturday, Sunday}
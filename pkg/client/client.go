@@ -0,0 +1,393 @@
+// Package client is a typed Go client for the Caltrain gateway's /v1 API
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"caltrain-gateway/pkg/api"
+)
+
+// Types returned by the gateway
+type (
+	TrainDeparture = api.TrainDeparture
+	Line           = api.Line
+	LineDetail     = api.LineDetail
+	TrainDetail    = api.TrainDetail
+	Stop           = api.Stop
+	Weekday        = api.Weekday
+	APIError       = api.APIError
+	Meta           = api.Meta
+)
+
+// Defaults of a new client
+const (
+	defaultMaxRetries      = 2
+	defaultMaxBackoff      = 10 * time.Second
+	defaultMaxCacheEntries = 256
+	initialBackoff         = 500 * time.Millisecond
+)
+
+// cachedResponse is a response body kept to answer conditional requests
+type cachedResponse struct {
+	etag string
+	body []byte
+}
+
+// Client calls the gateway's /v1 API. It is safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	auth       func(r *http.Request)
+	maxRetries int
+	maxBackoff time.Duration
+
+	cacheMu         sync.Mutex
+	cache           map[string]cachedResponse
+	maxCacheEntries int
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client used for requests. http.DefaultClient is used otherwise.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithSecret authenticates requests with a client secret in the X-API-SECRET header
+func WithSecret(secret string) Option {
+	return func(c *Client) {
+		c.auth = func(r *http.Request) {
+			r.Header.Set("X-API-SECRET", secret)
+		}
+	}
+}
+
+// WithBearerToken authenticates requests with a client secret or JWT in the Authorization header
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.auth = func(r *http.Request) {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+	}
+}
+
+// WithSigningKey signs every request for the named client with its signing key.
+// Each attempt gets a fresh timestamp and nonce, so retries are not rejected as replays.
+func WithSigningKey(client, key string) Option {
+	return func(c *Client) {
+		c.auth = func(r *http.Request) {
+			api.SignRequest(r, client, key, time.Now())
+		}
+	}
+}
+
+// WithRetries sets how often requests answered with 429 or 503 are retried and the
+// longest wait between attempts. A Retry-After longer than maxBackoff is not waited for.
+func WithRetries(maxRetries int, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithCacheSize sets how many responses are kept for conditional requests, 0 disables caching
+func WithCacheSize(entries int) Option {
+	return func(c *Client) {
+		c.maxCacheEntries = entries
+	}
+}
+
+// New creates a client for the gateway at baseURL, e.g. "https://gateway.example.com"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse base URL: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base URL must be an http or https URL, got %q", baseURL)
+	}
+	u.Path = strings.TrimSuffix(u.Path, "/")
+
+	c := &Client{
+		baseURL:         u,
+		httpClient:      http.DefaultClient,
+		maxRetries:      defaultMaxRetries,
+		maxBackoff:      defaultMaxBackoff,
+		cache:           make(map[string]cachedResponse),
+		maxCacheEntries: defaultMaxCacheEntries,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// TimetableQuery filters the departures of a timetable
+type TimetableQuery struct {
+	// Weekday only returns departures on this day, e.g. "Monday". All days if empty.
+	Weekday Weekday
+	// Station only returns departures from this GTFS stop ID. All stops if empty.
+	Station string
+}
+
+// LinesQuery filters the lines of an operator
+type LinesQuery struct {
+	// Monitored only returns monitored lines
+	Monitored bool
+	// Valid only returns lines valid right now
+	Valid bool
+	// Date only returns lines valid on this date, formatted as YYYY-MM-DD
+	Date string
+}
+
+// Timetable returns the operator's departures keyed by GTFS stop ID
+func (c *Client) Timetable(ctx context.Context, operator string, query TimetableQuery) (map[string][]TrainDeparture, error) {
+	q := url.Values{}
+	if query.Weekday != "" {
+		weekday := api.ParseWeekday(string(query.Weekday))
+		if weekday == "" {
+			return nil, fmt.Errorf("invalid weekday %q", query.Weekday)
+		}
+		q.Set("weekday", string(weekday))
+	}
+	if query.Station != "" {
+		q.Set("station", query.Station)
+	}
+
+	var departures map[string][]TrainDeparture
+	if err := c.getData(ctx, operatorPath(operator, "timetable"), q, &departures); err != nil {
+		return nil, err
+	}
+	return departures, nil
+}
+
+// Departures returns the departures from a station, optionally only on one weekday
+func (c *Client) Departures(ctx context.Context, operator, station string, weekday Weekday) ([]TrainDeparture, error) {
+	if station == "" {
+		return nil, errors.New("station must not be empty")
+	}
+	departures, err := c.Timetable(ctx, operator, TimetableQuery{Weekday: weekday, Station: station})
+	if err != nil {
+		return nil, err
+	}
+	return departures[station], nil
+}
+
+// Lines returns the lines loaded for the operator
+func (c *Client) Lines(ctx context.Context, operator string, query LinesQuery) ([]Line, error) {
+	q := url.Values{}
+	if query.Monitored {
+		q.Set("monitored", "true")
+	}
+	if query.Valid {
+		q.Set("valid", "true")
+	}
+	if query.Date != "" {
+		if _, err := time.Parse(time.DateOnly, query.Date); err != nil {
+			return nil, fmt.Errorf("invalid date %q, expected format YYYY-MM-DD", query.Date)
+		}
+		q.Set("date", query.Date)
+	}
+
+	var lines []Line
+	if err := c.getData(ctx, operatorPath(operator, "lines"), q, &lines); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// Line returns a line with its routes and stop sequences
+func (c *Client) Line(ctx context.Context, operator, id string) (*LineDetail, error) {
+	var line LineDetail
+	if err := c.getData(ctx, operatorPath(operator, "lines", id), nil, &line); err != nil {
+		return nil, err
+	}
+	return &line, nil
+}
+
+// Train returns a train with its full stopping pattern
+func (c *Client) Train(ctx context.Context, operator, id string) (*TrainDetail, error) {
+	var train TrainDetail
+	if err := c.getData(ctx, operatorPath(operator, "trains", id), nil, &train); err != nil {
+		return nil, err
+	}
+	return &train, nil
+}
+
+// Stops returns the stops loaded for the operator
+func (c *Client) Stops(ctx context.Context, operator string) ([]Stop, error) {
+	var stops []Stop
+	if err := c.getData(ctx, operatorPath(operator, "stops"), nil, &stops); err != nil {
+		return nil, err
+	}
+	return stops, nil
+}
+
+// Proxy calls an allowlisted 511 endpoint through the gateway, e.g.
+// "transit/StopMonitoring" with the agency parameter, and returns the 511 response body
+func (c *Client) Proxy(ctx context.Context, endpoint string, params url.Values) ([]byte, error) {
+	body, err := c.get(ctx, "/"+strings.TrimPrefix(endpoint, "/"), params)
+	if err != nil {
+		return nil, err
+	}
+	// The 511 API prefixes its JSON with a UTF-8 byte order mark
+	return bytes.TrimPrefix(body, []byte{0xEF, 0xBB, 0xBF}), nil
+}
+
+// operatorPath joins the escaped path segments of an operator route
+func operatorPath(operator string, segments ...string) string {
+	path := "/" + url.PathEscape(operator)
+	for _, segment := range segments {
+		path += "/" + url.PathEscape(segment)
+	}
+	return path
+}
+
+// getData requests a /v1 route and decodes the data of its envelope into v
+func (c *Client) getData(ctx context.Context, path string, q url.Values, v any) error {
+	body, err := c.get(ctx, path, q)
+	if err != nil {
+		return err
+	}
+	envelope := api.DataEnvelope[any]{Data: v}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// get requests a /v1 route by its escaped path and returns the body of a successful response.
+// Cached bodies are revalidated with their ETag, and 429 and 503 responses are retried.
+func (c *Client) get(ctx context.Context, path string, q url.Values) ([]byte, error) {
+	// The path is already escaped
+	target := c.baseURL.String() + "/v1" + path
+	if len(q) > 0 {
+		target += "?" + q.Encode()
+	}
+
+	for attempt := 0; ; attempt++ {
+		body, wait, err := c.do(ctx, target)
+		if wait < 0 || attempt >= c.maxRetries {
+			return body, err
+		}
+		if wait == 0 {
+			wait = min(initialBackoff<<attempt, c.maxBackoff)
+		}
+		if wait > c.maxBackoff {
+			return body, err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// do makes a single attempt. It returns how long to wait before retrying,
+// 0 if the server did not say, or -1 if the request must not be retried.
+func (c *Client) do(ctx context.Context, target string) ([]byte, time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.auth != nil {
+		c.auth(req)
+	}
+	cached, isCached := c.cached(target)
+	if isCached {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to request %s: %w", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		return cached.body, -1, nil
+	case resp.StatusCode == http.StatusOK:
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			c.store(target, cachedResponse{etag: etag, body: body})
+		}
+		return body, -1, nil
+	}
+
+	apiErr := decodeError(resp.StatusCode, body)
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return nil, -1, apiErr
+	}
+	var wait time.Duration
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	return nil, wait, apiErr
+}
+
+// decodeError returns the error of a failed response. Bodies that are not an
+// error envelope, e.g. from a proxy in front of the gateway, become the message.
+func decodeError(status int, body []byte) *APIError {
+	var envelope api.ErrorEnvelope
+	if err := json.Unmarshal(body, &envelope); err == nil && envelope.Error != nil {
+		envelope.Error.Status = status
+		return envelope.Error
+	}
+	message := strings.TrimSpace(string(body))
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &APIError{
+		Status:    status,
+		Message:   message,
+		Retryable: status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable,
+	}
+}
+
+// cached returns the cached response for the URL
+func (c *Client) cached(target string) (cachedResponse, bool) {
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	cached, ok := c.cache[target]
+	return cached, ok
+}
+
+// store caches the response for the URL, evicting another entry if the cache is full
+func (c *Client) store(target string, response cachedResponse) {
+	if c.maxCacheEntries <= 0 {
+		return
+	}
+	c.cacheMu.Lock()
+	defer c.cacheMu.Unlock()
+	if _, ok := c.cache[target]; !ok && len(c.cache) >= c.maxCacheEntries {
+		for key := range c.cache {
+			delete(c.cache, key)
+			break
+		}
+	}
+	c.cache[target] = response
+}
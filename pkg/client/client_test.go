@@ -0,0 +1,396 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	caltraingateway "caltrain-gateway/internal/app/caltrain-gateway"
+)
+
+const exampleDir = "../../internal/app/caltrain-gateway/"
+
+// newGateway starts a gateway serving the example timetable, with the 511 API at upstreamURL
+func newGateway(t *testing.T, secret, upstreamURL string) *httptest.Server {
+	t.Helper()
+
+	cfg := caltraingateway.DefaultConfig()
+	cfg.Secret = secret
+	if upstreamURL != "" {
+		cfg.APIBaseURL = upstreamURL
+	}
+	return startGateway(t, cfg, nil)
+}
+
+// startGateway starts a gateway serving the example timetable to the given
+// clients, or to the shared secrets of the config if nil
+func startGateway(t *testing.T, cfg *caltraingateway.Config, clients *caltraingateway.ClientRegistry) *httptest.Server {
+	t.Helper()
+
+	lines, err := caltraingateway.LoadLinesFromFile(exampleDir + "example_lines.json")
+	if err != nil {
+		t.Fatalf("failed to load lines: %v", err)
+	}
+	stops, err := caltraingateway.LoadStopsFromFile(exampleDir + "example_stops.json")
+	if err != nil {
+		t.Fatalf("failed to load stops: %v", err)
+	}
+	tc := caltraingateway.NewTimetableCollection()
+	if err := tc.LoadTimetableFiles(exampleDir + "example_timetable.json"); err != nil {
+		t.Fatalf("failed to load timetable: %v", err)
+	}
+	store := caltraingateway.NewStore([]caltraingateway.Operator{caltraingateway.NewOperator("CT")})
+	store.Set("CT", &caltraingateway.Dataset{Lines: lines, Stops: stops, Timetables: tc})
+
+	handler, err := caltraingateway.NewHandler(caltraingateway.Deps{
+		Config:  cfg,
+		KeyPool: caltraingateway.NewKeyPool([]string{"key"}, 100, 100),
+		Store:   store,
+		Clients: clients,
+	})
+	if err != nil {
+		t.Fatalf("NewHandler() error: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClient(t *testing.T, baseURL string, opts ...Option) *Client {
+	t.Helper()
+	c, err := New(baseURL, opts...)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return c
+}
+
+func TestClient_Timetable(t *testing.T) {
+	gateway := newGateway(t, "mysecret", "")
+	c := newClient(t, gateway.URL, WithSecret("mysecret"))
+	ctx := context.Background()
+
+	departures, err := c.Departures(ctx, "caltrain", "70261", "monday")
+	if err != nil {
+		t.Fatalf("Departures failed: %v", err)
+	}
+	if len(departures) == 0 {
+		t.Fatal("Expected departures from station 70261")
+	}
+	for _, d := range departures {
+		if !d.OnWeekdays {
+			t.Errorf("Expected only weekday departures, got %+v", d)
+		}
+	}
+
+	train, err := c.Train(ctx, "caltrain", "401")
+	if err != nil {
+		t.Fatalf("Train failed: %v", err)
+	}
+	if train.TrainID != "401" || len(train.Calls) == 0 {
+		t.Errorf("Unexpected train: %+v", train)
+	}
+
+	line, err := c.Line(ctx, "CT", "Limited")
+	if err != nil {
+		t.Fatalf("Line failed: %v", err)
+	}
+	if line.ID != "Limited" || len(line.Routes) == 0 {
+		t.Errorf("Unexpected line: %+v", line)
+	}
+
+	lines, err := c.Lines(ctx, "CT", LinesQuery{Monitored: true})
+	if err != nil {
+		t.Fatalf("Lines failed: %v", err)
+	}
+	if len(lines) == 0 {
+		t.Error("Expected monitored lines")
+	}
+
+	stops, err := c.Stops(ctx, "caltrain")
+	if err != nil {
+		t.Fatalf("Stops failed: %v", err)
+	}
+	if len(stops) != 32 || stops[0].ID == "" || stops[0].Name == "" {
+		t.Errorf("Expected 32 named stops, got %d: %+v", len(stops), stops)
+	}
+}
+
+func TestClient_SigningKey(t *testing.T) {
+	clients, err := caltraingateway.NewClientRegistry([]caltraingateway.Client{
+		{Name: "display", SigningKey: "display-signing-key", Scopes: []caltraingateway.Scope{caltraingateway.ScopeTimetable}},
+	})
+	if err != nil {
+		t.Fatalf("failed to create clients: %v", err)
+	}
+	gateway := startGateway(t, caltraingateway.DefaultConfig(), clients)
+	ctx := context.Background()
+
+	c := newClient(t, gateway.URL, WithSigningKey("display", "display-signing-key"))
+	// Every request is signed with a fresh nonce, so repeating it is no replay
+	for range 2 {
+		lines, err := c.Lines(ctx, "CT", LinesQuery{})
+		if err != nil {
+			t.Fatalf("Lines failed: %v", err)
+		}
+		if len(lines) == 0 {
+			t.Error("Expected lines")
+		}
+	}
+
+	c = newClient(t, gateway.URL, WithSigningKey("display", "some-other-signing-key"))
+	var apiErr *APIError
+	if _, err := c.Lines(ctx, "CT", LinesQuery{}); !errors.As(err, &apiErr) || apiErr.Status != http.StatusUnauthorized {
+		t.Errorf("Expected status %d for a wrong signing key, got %v", http.StatusUnauthorized, err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	gateway := newGateway(t, "mysecret", "")
+	ctx := context.Background()
+
+	tests := []struct {
+		name         string
+		opts         []Option
+		call         func(c *Client) error
+		expectedCode string
+	}{
+		{
+			name: "invalid weekday is rejected before sending",
+			opts: []Option{WithSecret("mysecret")},
+			call: func(c *Client) error {
+				_, err := c.Timetable(ctx, "caltrain", TimetableQuery{Weekday: "Someday"})
+				return err
+			},
+		},
+		{
+			name: "invalid date is rejected before sending",
+			opts: []Option{WithSecret("mysecret")},
+			call: func(c *Client) error {
+				_, err := c.Lines(ctx, "caltrain", LinesQuery{Date: "tomorrow"})
+				return err
+			},
+		},
+		{
+			name: "unknown train",
+			opts: []Option{WithSecret("mysecret")},
+			call: func(c *Client) error {
+				_, err := c.Train(ctx, "caltrain", "999")
+				return err
+			},
+			expectedCode: "train_not_found",
+		},
+		{
+			name: "missing credentials",
+			call: func(c *Client) error {
+				_, err := c.Train(ctx, "caltrain", "401")
+				return err
+			},
+			expectedCode: "unauthorized",
+		},
+		{
+			name: "wrong bearer token",
+			opts: []Option{WithBearerToken("wrong")},
+			call: func(c *Client) error {
+				_, err := c.Train(ctx, "caltrain", "401")
+				return err
+			},
+			expectedCode: "unauthorized",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(newClient(t, gateway.URL, tt.opts...))
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			var apiErr *APIError
+			isAPIErr := errors.As(err, &apiErr)
+			if tt.expectedCode == "" {
+				if isAPIErr {
+					t.Errorf("Expected a validation error, got API error %v", err)
+				}
+				return
+			}
+			if !isAPIErr {
+				t.Fatalf("Expected *APIError, got %T: %v", err, err)
+			}
+			if apiErr.Code != tt.expectedCode {
+				t.Errorf("Expected code '%s', got '%s'", tt.expectedCode, apiErr.Code)
+			}
+			if apiErr.RequestID == "" {
+				t.Error("Expected request ID in error")
+			}
+		})
+	}
+}
+
+func TestClient_Proxy(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("\xEF\xBB\xBF{\"path\":\"" + r.URL.Path + "\"}"))
+	}))
+	defer upstream.Close()
+	gateway := newGateway(t, "mysecret", upstream.URL)
+
+	c := newClient(t, gateway.URL, WithBearerToken("mysecret"))
+	body, err := c.Proxy(context.Background(), "transit/StopMonitoring", url.Values{"agency": {"CT"}})
+	if err != nil {
+		t.Fatalf("Proxy failed: %v", err)
+	}
+	if string(body) != `{"path":"/transit/StopMonitoring"}` {
+		t.Errorf("Expected 511 body without byte order mark, got '%s'", body)
+	}
+
+	_, err = c.Proxy(context.Background(), "transit/secret", url.Values{"agency": {"CT"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "endpoint_not_allowed" {
+		t.Errorf("Expected endpoint_not_allowed error, got %v", err)
+	}
+}
+
+func TestClient_Retries(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		failures      int32
+		expectedCalls int32
+		expectSuccess bool
+	}{
+		{name: "service unavailable is retried", status: http.StatusServiceUnavailable, failures: 2, expectedCalls: 3, expectSuccess: true},
+		{name: "rate limit is retried", status: http.StatusTooManyRequests, failures: 1, expectedCalls: 2, expectSuccess: true},
+		{name: "retries run out", status: http.StatusServiceUnavailable, failures: 5, expectedCalls: 3},
+		{name: "not found is not retried", status: http.StatusNotFound, failures: 1, expectedCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if calls.Add(1) <= tt.failures {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(tt.status)
+					w.Write([]byte(`{"error":{"code":"timetable_not_loaded","message":"Timetable not loaded","retryable":true}}`))
+					return
+				}
+				w.Write([]byte(`{"data":{"trainId":"401"}}`))
+			}))
+			defer server.Close()
+
+			c := newClient(t, server.URL, WithRetries(2, 10*time.Millisecond))
+			train, err := c.Train(context.Background(), "caltrain", "401")
+
+			if calls.Load() != tt.expectedCalls {
+				t.Errorf("Expected %d calls, got %d", tt.expectedCalls, calls.Load())
+			}
+			if tt.expectSuccess {
+				if err != nil || train.TrainID != "401" {
+					t.Errorf("Expected train 401, got %+v, %v", train, err)
+				}
+				return
+			}
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) || apiErr.Status != tt.status {
+				t.Errorf("Expected API error with status %d, got %v", tt.status, err)
+			}
+		})
+	}
+}
+
+func TestClient_RetryAfterLongerThanMaxBackoff(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("Retry-After", "60")
+		http.Error(w, "Rate limit exceeded for client", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	c := newClient(t, server.URL, WithRetries(2, time.Second))
+	_, err := c.Train(context.Background(), "caltrain", "401")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Message != "Rate limit exceeded for client" || !apiErr.Retryable {
+		t.Errorf("Expected retryable rate limit error, got %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("Expected 1 call, got %d", calls.Load())
+	}
+}
+
+func TestClient_ConditionalRequests(t *testing.T) {
+	var calls, notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Write([]byte(`{"data":{"70261":[{"trainId":"401"}]}}`))
+	}))
+	defer server.Close()
+
+	c := newClient(t, server.URL)
+	for i := range 3 {
+		departures, err := c.Departures(context.Background(), "caltrain", "70261", "")
+		if err != nil {
+			t.Fatalf("Request %d failed: %v", i, err)
+		}
+		if len(departures) != 1 || departures[0].TrainID != "401" {
+			t.Errorf("Request %d: unexpected departures %+v", i, departures)
+		}
+	}
+	if calls.Load() != 3 || notModified.Load() != 2 {
+		t.Errorf("Expected 3 calls with 2 revalidated, got %d calls with %d revalidated", calls.Load(), notModified.Load())
+	}
+
+	// Without a cache every request is unconditional
+	notModified.Store(0)
+	c = newClient(t, server.URL, WithCacheSize(0))
+	for range 2 {
+		if _, err := c.Departures(context.Background(), "caltrain", "70261", ""); err != nil {
+			t.Fatalf("Request failed: %v", err)
+		}
+	}
+	if notModified.Load() != 0 {
+		t.Errorf("Expected no revalidated requests without a cache, got %d", notModified.Load())
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		baseURL     string
+		expectError bool
+	}{
+		{baseURL: "https://gateway.example.com"},
+		{baseURL: "https://gateway.example.com/prefix/"},
+		{baseURL: "gateway.example.com", expectError: true},
+		{baseURL: "ftp://gateway.example.com", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.baseURL, func(t *testing.T) {
+			c, err := New(tt.baseURL)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if strings.HasSuffix(c.baseURL.Path, "/") {
+				t.Errorf("Expected base path without trailing slash, got '%s'", c.baseURL.Path)
+			}
+		})
+	}
+}